@@ -0,0 +1,223 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rohan/stock-simulator/exchange"
+)
+
+// ErrNotOwner is returned when an agent cancels an order it did not submit
+var ErrNotOwner = errors.New("order belongs to another agent")
+
+// Fill is an execution of one of an agent's orders
+type Fill struct {
+	TradeID string
+	OrderID string
+	// Side is the side (BUY or SELL) of the agent's order
+	Side     string
+	Price    exchange.TransactionAmtDataType
+	Quantity exchange.TransactionQtyDataType
+	Time     time.Time
+}
+
+// Strategy is the trading logic of an agent. The scheduler calls it from the agent's
+// own goroutine, one callback at a time, so a strategy needs no locking of its own.
+// The exchange's callbacks are asynchronous, so price updates and fills can arrive
+// slightly out of order; the agent's accessors always show the current state.
+type Strategy interface {
+	// Start is called once before any other callback
+	Start(agent *Agent)
+	// OnPrice is called when the last traded price changes
+	OnPrice(agent *Agent, price exchange.TransactionAmtDataType)
+	// OnBook is called with the price levels changed by every operation on the book
+	OnBook(agent *Agent, update exchange.BookUpdate)
+	// OnFill is called for every execution of one of the agent's orders
+	OnFill(agent *Agent, fill Fill)
+	// OnTick is called every tick of the scheduler's clock
+	OnTick(agent *Agent, now time.Time)
+	// Stop is called once after the last callback when the run ends
+	Stop(agent *Agent)
+}
+
+// BaseStrategy ignores every callback. Strategies embed it and implement only
+// the callbacks they need.
+type BaseStrategy struct{}
+
+func (BaseStrategy) Start(agent *Agent)                                          {}
+func (BaseStrategy) OnPrice(agent *Agent, price exchange.TransactionAmtDataType) {}
+func (BaseStrategy) OnBook(agent *Agent, update exchange.BookUpdate)             {}
+func (BaseStrategy) OnFill(agent *Agent, fill Fill)                              {}
+func (BaseStrategy) OnTick(agent *Agent, now time.Time)                          {}
+func (BaseStrategy) Stop(agent *Agent)                                           {}
+
+// Agent is a trader run by a scheduler. It trades through its own account on the
+// scheduler's exchange.
+type Agent struct {
+	ID        string
+	strategy  Strategy
+	scheduler *Scheduler
+	// starting is the equity the agent's P&L is measured from
+	starting float64
+	// rng is the agent's random source, seeded by the scheduler
+	rng *rand.Rand
+
+	// events holds the callbacks waiting to be run on the agent's goroutine and
+	// ready is signalled when it is no longer empty
+	events []func()
+	ready  chan struct{}
+
+	mutex    sync.Mutex
+	nextID   int
+	orders   int
+	rejected int
+	fills    int
+	volume   int64
+}
+
+// Symbol returns the symbol the agent trades
+func (agent *Agent) Symbol() string {
+	return agent.scheduler.exch.Symbol
+}
+
+// Now returns the time of the scheduler's clock
+func (agent *Agent) Now() time.Time {
+	return agent.scheduler.clock.Now()
+}
+
+// LastTradedPrice returns the current last traded price
+func (agent *Agent) LastTradedPrice() exchange.TransactionAmtDataType {
+	return agent.scheduler.exch.LTP()
+}
+
+// Depth returns the best depth price levels of each side of the book
+func (agent *Agent) Depth(depth int) exchange.Depth {
+	return agent.scheduler.exch.GetDepth(depth)
+}
+
+// Rand returns the agent's random source. Strategies draw all their random numbers
+// from it, so that a run can be reproduced by seeding the scheduler. It is only
+// safe to use from the strategy's callbacks.
+func (agent *Agent) Rand() *rand.Rand {
+	return agent.rng
+}
+
+// Cash returns the agent's cash balance
+func (agent *Agent) Cash() int64 {
+	cash, _ := agent.scheduler.accounts.Cash(agent.ID)
+	return cash
+}
+
+// Position returns the agent's position in the symbol it trades
+func (agent *Agent) Position() exchange.Position {
+	position, _ := agent.scheduler.accounts.Position(agent.ID, agent.Symbol())
+	return position
+}
+
+// OpenOrders returns the agent's orders still resting in the book
+func (agent *Agent) OpenOrders() []exchange.OrderReport {
+	open := make([]exchange.OrderReport, 0)
+	for _, report := range agent.scheduler.accounts.OpenOrders(agent.ID) {
+		if report.Symbol == agent.Symbol() {
+			open = append(open, report)
+		}
+	}
+	return open
+}
+
+// Submit sends an order for the agent's account and returns its report. An order
+// without an ID is given one made of the agent's ID and a counter. Rejected orders
+// return a *exchange.Rejection as the error.
+func (agent *Agent) Submit(txn exchange.Transaction) (exchange.OrderReport, error) {
+	agent.mutex.Lock()
+	if txn.ID == "" {
+		agent.nextID++
+		txn.ID = fmt.Sprintf("%s-%d", agent.ID, agent.nextID)
+	}
+	agent.orders++
+	agent.mutex.Unlock()
+
+	txn.AccountID = agent.ID
+	// The owner is known before the order can trade, so none of its fills are missed
+	agent.scheduler.own(txn.ID, agent)
+	report, err := agent.scheduler.exch.Submit(txn)
+	if err != nil {
+		agent.mutex.Lock()
+		agent.rejected++
+		agent.mutex.Unlock()
+	}
+	return report, err
+}
+
+// orderNumber returns the counter of an order ID that Submit generated for an agent
+func orderNumber(agentID, orderID string) (int, bool) {
+	suffix, ok := strings.CutPrefix(orderID, agentID+"-")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(suffix)
+	return n, err == nil
+}
+
+// Cancel cancels one of the agent's resting orders
+func (agent *Agent) Cancel(orderID string) (exchange.OrderReport, error) {
+	if agent.scheduler.owner(orderID) != agent {
+		return exchange.OrderReport{}, fmt.Errorf("%w: %s", ErrNotOwner, orderID)
+	}
+	return agent.scheduler.exch.CancelOrder(orderID)
+}
+
+// CancelAll cancels every resting order of the agent
+func (agent *Agent) CancelAll() {
+	for _, report := range agent.OpenOrders() {
+		agent.scheduler.exch.CancelOrder(report.OrderID)
+	}
+}
+
+// post queues a callback to run on the agent's goroutine
+func (agent *Agent) post(event func()) {
+	agent.mutex.Lock()
+	agent.events = append(agent.events, event)
+	agent.mutex.Unlock()
+
+	select {
+	case agent.ready <- struct{}{}:
+	default:
+	}
+}
+
+// run runs the agent's callbacks in the order they were posted until stop is closed
+func (agent *Agent) run(stop <-chan struct{}) {
+	agent.strategy.Start(agent)
+	for {
+		select {
+		case <-stop:
+			agent.strategy.Stop(agent)
+			return
+		case <-agent.ready:
+			agent.mutex.Lock()
+			events := agent.events
+			agent.events = nil
+			agent.mutex.Unlock()
+
+			for _, event := range events {
+				event()
+			}
+		}
+	}
+}
+
+// fill records an execution of one of the agent's orders and passes it to the strategy
+func (agent *Agent) fill(fill Fill) {
+	agent.mutex.Lock()
+	agent.fills++
+	agent.volume += int64(fill.Quantity)
+	agent.mutex.Unlock()
+
+	agent.post(func() { agent.strategy.OnFill(agent, fill) })
+}
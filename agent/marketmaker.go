@@ -0,0 +1,137 @@
+package agent
+
+import (
+	"math"
+
+	"github.com/rohan/stock-simulator/exchange"
+)
+
+// MarketMakerConfig parameterizes a MarketMaker
+type MarketMakerConfig struct {
+	// FairValue is the price quoted around; zero follows the last traded price
+	FairValue exchange.TransactionAmtDataType
+	// Spread is the distance between the bid and the ask
+	Spread exchange.TransactionAmtDataType
+	// Size is the quantity of each quote
+	Size exchange.TransactionQtyDataType
+	// Skew moves both quotes down by this much for every unit held long and up for
+	// every unit held short, so fills in one direction are worked off in the other
+	Skew float64
+	// MaxPosition is the largest position held long or short. Quotes are cut so
+	// that filling them never goes beyond it; zero leaves the position unlimited.
+	MaxPosition int64
+}
+
+// DefaultMarketMakerConfig quotes 5 a side two apart around the last traded price
+var DefaultMarketMakerConfig = MarketMakerConfig{Spread: 2, Size: 5, Skew: 0.1, MaxPosition: 100}
+
+// MarketMaker is a strategy that keeps a bid and an ask in the book around a fair
+// value, skewed by its inventory. It requotes whenever the last traded price or its
+// position changes, cancelling its previous quotes first. It is a source of
+// liquidity for tests and a template for other strategies.
+type MarketMaker struct {
+	BaseStrategy
+	config MarketMakerConfig
+
+	// bid and ask are the IDs of the resting quotes, empty when there is none
+	bid string
+	ask string
+	// fair and position are what the resting quotes were computed from
+	fair     exchange.TransactionAmtDataType
+	position int64
+	quoted   bool
+}
+
+// NewMarketMaker creates a market maker. A spread below 1 is quoted as 1.
+func NewMarketMaker(config MarketMakerConfig) *MarketMaker {
+	if config.Spread < 1 {
+		config.Spread = 1
+	}
+	return &MarketMaker{config: config}
+}
+
+// Start places the first quotes, after cancelling any orders the account already
+// has resting, such as the quotes of a run before a restart
+func (mm *MarketMaker) Start(agent *Agent) {
+	agent.CancelAll()
+	mm.requote(agent)
+}
+
+// OnPrice requotes when the last traded price has moved. The price is read from
+// the exchange rather than the update, which may be stale.
+func (mm *MarketMaker) OnPrice(agent *Agent, price exchange.TransactionAmtDataType) {
+	mm.requote(agent)
+}
+
+// OnFill requotes for the new inventory
+func (mm *MarketMaker) OnFill(agent *Agent, fill Fill) {
+	mm.requote(agent)
+}
+
+// Stop pulls the quotes
+func (mm *MarketMaker) Stop(agent *Agent) {
+	mm.cancel(agent)
+}
+
+// requote replaces the quotes if the fair value or the position has changed since
+// they were placed
+func (mm *MarketMaker) requote(agent *Agent) {
+	fair := mm.config.FairValue
+	if fair == 0 {
+		fair = agent.LastTradedPrice()
+	}
+	if mm.quoted && fair == mm.fair && agent.Position().Quantity == mm.position {
+		return
+	}
+
+	// Once the quotes are cancelled the position can no longer change under us
+	mm.cancel(agent)
+	position := agent.Position().Quantity
+	bid, ask := mm.quotes(fair, position)
+	if bid.Quantity > 0 {
+		if report, err := agent.Submit(bid); err == nil && report.IsOpen() {
+			mm.bid = report.OrderID
+		}
+	}
+	if ask.Quantity > 0 {
+		if report, err := agent.Submit(ask); err == nil && report.IsOpen() {
+			mm.ask = report.OrderID
+		}
+	}
+	mm.fair, mm.position, mm.quoted = fair, position, true
+}
+
+// cancel pulls whichever quotes are still resting
+func (mm *MarketMaker) cancel(agent *Agent) {
+	for _, id := range []string{mm.bid, mm.ask} {
+		if id != "" {
+			agent.Cancel(id)
+		}
+	}
+	mm.bid, mm.ask = "", ""
+}
+
+// quotes returns the bid and ask for a fair value and position. A side that would
+// take the position beyond the limit, or a bid below the minimum price of 1, has
+// no quantity.
+func (mm *MarketMaker) quotes(fair exchange.TransactionAmtDataType, position int64) (exchange.Transaction, exchange.Transaction) {
+	center := float64(fair) - mm.config.Skew*float64(position)
+	bidPrice := exchange.TransactionAmtDataType(math.Floor(center - float64(mm.config.Spread)/2))
+	askPrice := bidPrice + mm.config.Spread
+
+	bidSize, askSize := int64(mm.config.Size), int64(mm.config.Size)
+	if mm.config.MaxPosition > 0 {
+		bidSize = min(bidSize, mm.config.MaxPosition-position)
+		askSize = min(askSize, mm.config.MaxPosition+position)
+	}
+	if bidPrice < 1 {
+		bidSize = 0
+	}
+	if askPrice < 1 {
+		askPrice = 1
+	}
+
+	bid := exchange.Transaction{Type: exchange.BuyTransactionType, Amount: bidPrice, Quantity: exchange.TransactionQtyDataType(max(bidSize, 0))}
+	ask := exchange.Transaction{Type: exchange.SellTransactionType, Amount: askPrice, Quantity: exchange.TransactionQtyDataType(max(askSize, 0))}
+	return bid, ask
+}
@@ -0,0 +1,169 @@
+package agent
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/rohan/stock-simulator/exchange"
+)
+
+func TestMarketMakerQuotes(t *testing.T) {
+	testCases := []struct {
+		name            string
+		config          MarketMakerConfig
+		fair            exchange.TransactionAmtDataType
+		position        int64
+		expectedBid     exchange.TransactionAmtDataType
+		expectedAsk     exchange.TransactionAmtDataType
+		expectedBidSize exchange.TransactionQtyDataType
+		expectedAskSize exchange.TransactionQtyDataType
+	}{
+		{
+			name:   "Flat",
+			config: DefaultMarketMakerConfig,
+			fair:   100, position: 0,
+			expectedBid: 99, expectedAsk: 101, expectedBidSize: 5, expectedAskSize: 5,
+		},
+		{
+			name:   "Odd Spread",
+			config: MarketMakerConfig{Spread: 3, Size: 1},
+			fair:   100, position: 0,
+			expectedBid: 98, expectedAsk: 101, expectedBidSize: 1, expectedAskSize: 1,
+		},
+		{
+			name:   "Long Skews Down",
+			config: MarketMakerConfig{Spread: 2, Size: 5, Skew: 0.5},
+			fair:   100, position: 10,
+			expectedBid: 94, expectedAsk: 96, expectedBidSize: 5, expectedAskSize: 5,
+		},
+		{
+			name:   "Short Skews Up",
+			config: MarketMakerConfig{Spread: 2, Size: 5, Skew: 0.5},
+			fair:   100, position: -10,
+			expectedBid: 104, expectedAsk: 106, expectedBidSize: 5, expectedAskSize: 5,
+		},
+		{
+			name:   "Bid Cut At Limit",
+			config: MarketMakerConfig{Spread: 2, Size: 5, MaxPosition: 8},
+			fair:   100, position: 6,
+			expectedBid: 99, expectedAsk: 101, expectedBidSize: 2, expectedAskSize: 5,
+		},
+		{
+			name:   "No Ask When Short At Limit",
+			config: MarketMakerConfig{Spread: 2, Size: 5, MaxPosition: 8},
+			fair:   100, position: -8,
+			expectedBid: 99, expectedAsk: 101, expectedBidSize: 5, expectedAskSize: 0,
+		},
+		{
+			name:   "No Bid Below Minimum Price",
+			config: MarketMakerConfig{Spread: 2, Size: 5},
+			fair:   1, position: 0,
+			expectedBid: 0, expectedAsk: 2, expectedBidSize: 0, expectedAskSize: 5,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			bid, ask := NewMarketMaker(tc.config).quotes(tc.fair, tc.position)
+			if bid.Amount != tc.expectedBid || bid.Quantity != tc.expectedBidSize {
+				t.Errorf("Expected a bid of %d at %d, got %d at %d", tc.expectedBidSize, tc.expectedBid, bid.Quantity, bid.Amount)
+			}
+			if ask.Amount != tc.expectedAsk || ask.Quantity != tc.expectedAskSize {
+				t.Errorf("Expected an ask of %d at %d, got %d at %d", tc.expectedAskSize, tc.expectedAsk, ask.Quantity, ask.Amount)
+			}
+		})
+	}
+}
+
+// signalling is a market maker that signals every price update and fill it has handled
+type signalling struct {
+	*MarketMaker
+	handled chan bool
+}
+
+func (s *signalling) OnPrice(agent *Agent, price exchange.TransactionAmtDataType) {
+	s.MarketMaker.OnPrice(agent, price)
+	s.handled <- true
+}
+
+func (s *signalling) OnFill(agent *Agent, fill Fill) {
+	s.MarketMaker.OnFill(agent, fill)
+	s.handled <- true
+}
+
+func (s *signalling) Start(agent *Agent) {
+	s.MarketMaker.Start(agent)
+	s.handled <- true
+}
+
+func TestMarketMakerRequotes(t *testing.T) {
+	exch, _ := newTestExchange()
+	scheduler := NewScheduler(exch, 0)
+	mm := &signalling{
+		MarketMaker: NewMarketMaker(MarketMakerConfig{Spread: 2, Size: 5, Skew: 0.1, MaxPosition: 5}),
+		handled:     make(chan bool, 10),
+	}
+	maker, _ := scheduler.Add("maker", 100000, mm)
+	scheduler.Start()
+	receive(t, mm.handled, 1)
+
+	// quotes returns the agent's resting orders, bids first
+	quotes := func() []exchange.OrderReport {
+		open := maker.OpenOrders()
+		sort.Slice(open, func(i, j int) bool { return open[i].Type < open[j].Type })
+		return open
+	}
+
+	if open := quotes(); len(open) != 2 || open[0].Price != 99 || open[1].Price != 101 {
+		t.Fatalf("Expected quotes at 99 and 101, got %+v", open)
+	}
+
+	// A buyer lifts the whole ask, leaving the market maker short at its limit
+	exch.Submit(exchange.Transaction{Type: exchange.BuyTransactionType, OrderType: exchange.MarketOrderType, Quantity: 5})
+	receive(t, mm.handled, 2)
+
+	// The bid is skewed up around the new price of 101 and no ask is quoted
+	open := quotes()
+	if len(open) != 1 || open[0].Type != exchange.BuyTransactionType || open[0].Price != 100 || open[0].Quantity != 5 {
+		t.Errorf("Expected only a bid of 5 at 100, got %+v", open)
+	}
+
+	report := scheduler.Stop()
+	if open := maker.OpenOrders(); len(open) != 0 {
+		t.Errorf("Expected the quotes to be pulled when the run ends, got %+v", open)
+	}
+	if agent := report.Agents[0]; agent.Position != -5 || agent.PnL != 0 || agent.Strategy != "signalling" {
+		t.Errorf("Expected a short of 5 without P&L at 101, got %+v", agent)
+	}
+}
+
+func TestMarketMakerReplacesRecoveredQuotes(t *testing.T) {
+	exch, _ := newTestExchange()
+	scheduler := NewScheduler(exch, 0)
+
+	// The account still has the quotes of a run that was not stopped
+	exch.Accounts().Open("maker", 100000)
+	for _, quote := range []exchange.Transaction{
+		{ID: "maker-1", AccountID: "maker", Type: exchange.BuyTransactionType, Amount: 99, Quantity: 5},
+		{ID: "maker-2", AccountID: "maker", Type: exchange.SellTransactionType, Amount: 101, Quantity: 5},
+	} {
+		if _, err := exch.Submit(quote); err != nil {
+			t.Fatalf("Failed to submit %s: %v", quote.ID, err)
+		}
+	}
+
+	mm := &signalling{MarketMaker: NewMarketMaker(DefaultMarketMakerConfig), handled: make(chan bool, 10)}
+	maker, _ := scheduler.Add("maker", 100000, mm)
+	scheduler.Start()
+	defer scheduler.Stop()
+	receive(t, mm.handled, 1)
+
+	open := maker.OpenOrders()
+	sort.Slice(open, func(i, j int) bool { return open[i].OrderID < open[j].OrderID })
+	if len(open) != 2 || open[0].OrderID != "maker-3" || open[1].OrderID != "maker-4" {
+		t.Errorf("Expected only the new quotes maker-3 and maker-4, got %+v", open)
+	}
+	if depth := exch.GetDepth(0); len(depth.Bids) != 1 || depth.Bids[0].Quantity != 5 || depth.Asks[0].Quantity != 5 {
+		t.Errorf("Expected one quote of 5 a side in the book, got %+v", depth)
+	}
+}
@@ -0,0 +1,340 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"reflect"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rohan/stock-simulator/exchange"
+)
+
+// ErrSchedulerStarted is returned when agents are added to a running scheduler
+var ErrSchedulerStarted = errors.New("scheduler already started")
+
+// Scheduler runs a population of agents concurrently against one exchange. Each
+// agent trades through its own account and runs its strategy on its own goroutine,
+// fed with the exchange's price updates, book updates and the fills of its orders,
+// and with a tick of the clock every interval.
+type Scheduler struct {
+	exch     *exchange.Exchange
+	accounts *exchange.AccountManager
+	clock    exchange.Clock
+	interval time.Duration
+	// rng seeds the random source of every agent added
+	rng *rand.Rand
+
+	agents []*Agent
+	// owners maps the ID of every order submitted by an agent to the agent
+	owners  map[string]*Agent
+	started bool
+	stopped bool
+	stop    chan struct{}
+	wg      sync.WaitGroup
+	mutex   sync.RWMutex
+}
+
+// NewScheduler creates a scheduler for the agents trading on an exchange, ticking
+// them every interval of the exchange's clock; an interval of zero disables ticks.
+// An exchange without accounts is given an account manager, in which case the
+// scheduler must be created before AcceptTrades is started.
+func NewScheduler(exch *exchange.Exchange, interval time.Duration) *Scheduler {
+	accounts := exch.Accounts()
+	if accounts == nil {
+		accounts = exchange.NewAccountManager()
+		exch.SetAccounts(accounts)
+	}
+
+	return &Scheduler{
+		exch:     exch,
+		accounts: accounts,
+		clock:    exch.Clock(),
+		interval: interval,
+		rng:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		owners:   make(map[string]*Agent),
+		stop:     make(chan struct{}),
+	}
+}
+
+// SetSeed seeds the random sources of the agents added from now on, so that agents
+// added in the same order draw the same numbers on every run
+func (s *Scheduler) SetSeed(seed int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.rng = rand.New(rand.NewSource(seed))
+}
+
+// Add opens an account for a new agent with its starting cash and returns the agent.
+// An account that is already open, such as one recovered from the journal, is taken
+// over as it is and the agent's P&L is measured from its equity at that point. The
+// agent then owns the account's resting orders on the exchange, so their fills reach
+// its strategy, and numbers its new orders after those the account already has.
+func (s *Scheduler) Add(id string, cash int64, strategy Strategy) (*Agent, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.started {
+		return nil, ErrSchedulerStarted
+	}
+	for _, agent := range s.agents {
+		if agent.ID == id {
+			return nil, fmt.Errorf("%w: %s", exchange.ErrDuplicateAccount, id)
+		}
+	}
+
+	starting := float64(cash)
+	err := s.accounts.Open(id, cash)
+	adopted := errors.Is(err, exchange.ErrDuplicateAccount)
+	if adopted {
+		var summary exchange.AccountSummary
+		summary, err = s.accounts.Summary(id, map[string]exchange.TransactionAmtDataType{s.exch.Symbol: s.exch.LTP()})
+		starting = summary.Equity
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	agent := &Agent{
+		ID:        id,
+		strategy:  strategy,
+		scheduler: s,
+		starting:  starting,
+		rng:       rand.New(rand.NewSource(s.rng.Int63())),
+		ready:     make(chan struct{}, 1),
+	}
+	if adopted {
+		orders, _ := s.accounts.Orders(id)
+		for _, report := range append(orders, s.accounts.OpenOrders(id)...) {
+			if n, ok := orderNumber(id, report.OrderID); ok && n > agent.nextID {
+				agent.nextID = n
+			}
+			if report.IsOpen() && report.Symbol == s.exch.Symbol {
+				s.owners[report.OrderID] = agent
+			}
+		}
+	}
+	s.agents = append(s.agents, agent)
+	return agent, nil
+}
+
+// Agents returns the agents in the order they were added
+func (s *Scheduler) Agents() []*Agent {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return append([]*Agent(nil), s.agents...)
+}
+
+// Start starts every agent. Each strategy's Start is called before it receives
+// any market data.
+func (s *Scheduler) Start() {
+	s.mutex.Lock()
+	if s.started {
+		s.mutex.Unlock()
+		return
+	}
+	s.started = true
+	s.mutex.Unlock()
+
+	s.exch.RegisterPriceUpdateCallback(func(price int) {
+		s.broadcast(func(agent *Agent) {
+			agent.strategy.OnPrice(agent, exchange.TransactionAmtDataType(price))
+		})
+	})
+	s.exch.RegisterBookUpdateCallback(func(update exchange.BookUpdate) {
+		s.broadcast(func(agent *Agent) {
+			agent.strategy.OnBook(agent, update)
+		})
+	})
+	s.exch.RegisterTradeCallback(s.routeTrade)
+
+	for _, agent := range s.agents {
+		s.wg.Add(1)
+		go func(agent *Agent) {
+			defer s.wg.Done()
+			agent.run(s.stop)
+		}(agent)
+	}
+	if s.interval > 0 {
+		ticker := s.clock.NewTicker(s.interval)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer ticker.Stop()
+			for {
+				select {
+				case <-s.stop:
+					return
+				case now := <-ticker.C():
+					s.broadcast(func(agent *Agent) {
+						agent.strategy.OnTick(agent, now)
+					})
+				}
+			}
+		}()
+	}
+}
+
+// Stop stops every agent once the callback it is running returns, calls each
+// strategy's Stop and reports the outcome of the run. Callbacks still queued are
+// dropped.
+func (s *Scheduler) Stop() Report {
+	s.mutex.Lock()
+	if s.started && !s.stopped {
+		s.stopped = true
+		close(s.stop)
+	}
+	s.mutex.Unlock()
+	s.wg.Wait()
+
+	return s.Report()
+}
+
+// broadcast queues a callback for every agent of a running scheduler
+func (s *Scheduler) broadcast(callback func(agent *Agent)) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.stopped {
+		return
+	}
+	for _, agent := range s.agents {
+		agent := agent
+		agent.post(func() { callback(agent) })
+	}
+}
+
+// routeTrade passes an execution to the agents that own either of its orders
+func (s *Scheduler) routeTrade(trade exchange.Trade) {
+	for _, side := range []struct {
+		orderID string
+		txnType string
+	}{
+		{trade.BuyOrderID, exchange.BuyTransactionType},
+		{trade.SellOrderID, exchange.SellTransactionType},
+	} {
+		agent := s.owner(side.orderID)
+		if agent == nil {
+			continue
+		}
+		agent.fill(Fill{
+			TradeID:  trade.ID,
+			OrderID:  side.orderID,
+			Side:     side.txnType,
+			Price:    trade.Price,
+			Quantity: trade.Quantity,
+			Time:     trade.Timestamp,
+		})
+	}
+}
+
+// own records the agent that submitted an order
+func (s *Scheduler) own(orderID string, agent *Agent) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.owners[orderID] = agent
+}
+
+// owner returns the agent that submitted an order, or nil
+func (s *Scheduler) owner(orderID string) *Agent {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.owners[orderID]
+}
+
+// AgentReport is the activity and profit and loss of one agent
+type AgentReport struct {
+	ID       string `json:"id"`
+	Strategy string `json:"strategy"`
+	// Orders counts the orders submitted and Rejected those the exchange refused
+	Orders   int   `json:"orders"`
+	Rejected int   `json:"rejected"`
+	Fills    int   `json:"fills"`
+	Volume   int64 `json:"volume"`
+	// Position is the quantity held at the end, negative when short
+	Position      int64   `json:"position"`
+	Cash          int64   `json:"cash"`
+	RealizedPnL   float64 `json:"realizedPnl"`
+	UnrealizedPnL float64 `json:"unrealizedPnl"`
+	// PnL is the agent's equity less its equity when it was added, which is its
+	// starting cash unless it took over an existing account
+	PnL float64 `json:"pnl"`
+}
+
+// Report is the outcome of a run of a scheduler's agents, with every position
+// marked to the last traded price
+type Report struct {
+	Symbol          string                          `json:"symbol"`
+	LastTradedPrice exchange.TransactionAmtDataType `json:"lastTradedPrice"`
+	Agents          []AgentReport                   `json:"agents"`
+}
+
+// Report returns the activity and profit and loss of every agent so far, most
+// profitable first
+func (s *Scheduler) Report() Report {
+	ltp := s.exch.LTP()
+	report := Report{Symbol: s.exch.Symbol, LastTradedPrice: ltp, Agents: make([]AgentReport, 0)}
+	marks := map[string]exchange.TransactionAmtDataType{s.exch.Symbol: ltp}
+
+	for _, agent := range s.Agents() {
+		summary, err := s.accounts.Summary(agent.ID, marks)
+		if err != nil {
+			continue
+		}
+
+		agent.mutex.Lock()
+		agentReport := AgentReport{
+			ID:            agent.ID,
+			Strategy:      strategyName(agent.strategy),
+			Orders:        agent.orders,
+			Rejected:      agent.rejected,
+			Fills:         agent.fills,
+			Volume:        agent.volume,
+			Cash:          summary.Cash,
+			RealizedPnL:   summary.RealizedPnL,
+			UnrealizedPnL: summary.UnrealizedPnL,
+			PnL:           summary.Equity - agent.starting,
+		}
+		agent.mutex.Unlock()
+		for _, position := range summary.Positions {
+			if position.Symbol == s.exch.Symbol {
+				agentReport.Position = position.Quantity
+			}
+		}
+		report.Agents = append(report.Agents, agentReport)
+	}
+
+	sort.SliceStable(report.Agents, func(i, j int) bool {
+		return report.Agents[i].PnL > report.Agents[j].PnL
+	})
+	return report
+}
+
+// WriteTable writes the report as a table with one agent per line
+func (report Report) WriteTable(w io.Writer) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(table, "Agent\tStrategy\tOrders\tRejected\tFills\tVolume\tPosition\tCash\tRealized\tUnrealized\tP&L\t\n")
+	for _, agent := range report.Agents {
+		fmt.Fprintf(table, "%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%.2f\t%.2f\t%.2f\t\n",
+			agent.ID, agent.Strategy, agent.Orders, agent.Rejected, agent.Fills, agent.Volume,
+			agent.Position, agent.Cash, agent.RealizedPnL, agent.UnrealizedPnL, agent.PnL)
+	}
+	return table.Flush()
+}
+
+// strategyName returns the type name of a strategy
+func strategyName(strategy Strategy) string {
+	t := reflect.TypeOf(strategy)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
@@ -0,0 +1,327 @@
+package agent
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rohan/stock-simulator/exchange"
+)
+
+// scripted is a strategy that runs the given functions and records what it receives
+type scripted struct {
+	BaseStrategy
+	start   func(agent *Agent)
+	tick    func(agent *Agent, now time.Time)
+	fills   chan Fill
+	prices  chan exchange.TransactionAmtDataType
+	stopped chan bool
+}
+
+func newScripted() *scripted {
+	return &scripted{
+		fills:   make(chan Fill, 100),
+		prices:  make(chan exchange.TransactionAmtDataType, 100),
+		stopped: make(chan bool, 1),
+	}
+}
+
+func (s *scripted) Start(agent *Agent) {
+	if s.start != nil {
+		s.start(agent)
+	}
+}
+
+func (s *scripted) OnTick(agent *Agent, now time.Time) {
+	if s.tick != nil {
+		s.tick(agent, now)
+	}
+}
+
+func (s *scripted) OnPrice(agent *Agent, price exchange.TransactionAmtDataType) {
+	s.prices <- price
+}
+
+func (s *scripted) OnFill(agent *Agent, fill Fill) {
+	s.fills <- fill
+}
+
+func (s *scripted) Stop(agent *Agent) {
+	s.stopped <- true
+}
+
+// receive waits for n values from a channel
+func receive[T any](t *testing.T, channel chan T, n int) []T {
+	t.Helper()
+	received := make([]T, 0, n)
+	for len(received) < n {
+		select {
+		case value := <-channel:
+			received = append(received, value)
+		case <-time.After(time.Second):
+			t.Fatalf("Expected %d values, got %d", n, len(received))
+		}
+	}
+	return received
+}
+
+func newTestExchange() (*exchange.Exchange, *exchange.SimulatedClock) {
+	exch := exchange.NewExchange(100)
+	clock := exchange.NewSimulatedClock(time.Date(2025, 4, 27, 15, 0, 0, 0, time.UTC))
+	exch.SetClock(clock)
+	return &exch, clock
+}
+
+func TestScheduler(t *testing.T) {
+	exch, clock := newTestExchange()
+	scheduler := NewScheduler(exch, time.Second)
+
+	// The seller offers 6 when it starts and the buyer takes 2 every tick
+	seller := newScripted()
+	offered := make(chan bool, 1)
+	seller.start = func(agent *Agent) {
+		agent.Submit(exchange.NewTransactionWithQuantity(exchange.SellTransactionType, 100, 6))
+		offered <- true
+	}
+	buyer := newScripted()
+	buyer.tick = func(agent *Agent, now time.Time) {
+		agent.Submit(exchange.Transaction{Type: exchange.BuyTransactionType, Amount: 100, Quantity: 2})
+	}
+	watcher := newScripted()
+
+	scheduler.Add("seller", 10000, seller)
+	scheduler.Add("buyer", 10000, buyer)
+	scheduler.Add("watcher", 10000, watcher)
+	if _, err := scheduler.Add("buyer", 10000, buyer); !errors.Is(err, exchange.ErrDuplicateAccount) {
+		t.Errorf("Expected ErrDuplicateAccount, got %v", err)
+	}
+	if _, err := scheduler.Add("bad id", 10000, buyer); !errors.Is(err, exchange.ErrInvalidAccount) {
+		t.Errorf("Expected ErrInvalidAccount, got %v", err)
+	}
+
+	scheduler.Start()
+	if _, err := scheduler.Add("late", 10000, newScripted()); !errors.Is(err, ErrSchedulerStarted) {
+		t.Errorf("Expected ErrSchedulerStarted, got %v", err)
+	}
+	clock.WaitForTickers(1)
+	// The seller's order rests before the first tick
+	receive(t, offered, 1)
+
+	for i := 0; i < 3; i++ {
+		clock.Advance(time.Second)
+		fills := receive(t, buyer.fills, 1)
+		if fills[0].Side != exchange.BuyTransactionType || fills[0].Quantity != 2 || fills[0].OrderID != fmt.Sprintf("buyer-%d", i+1) {
+			t.Errorf("Expected buyer-%d to buy 2, got %+v", i+1, fills[0])
+		}
+		receive(t, seller.fills, 1)
+		receive(t, watcher.prices, 1)
+	}
+	if fills := len(watcher.fills); fills != 0 {
+		t.Errorf("Expected the watcher to get no fills, got %d", fills)
+	}
+
+	// An anonymous trade moves the last traded price to 110
+	exch.Submit(exchange.NewTransactionWithQuantity(exchange.SellTransactionType, 110, 1))
+	exch.Submit(exchange.NewTransactionWithQuantity(exchange.BuyTransactionType, 110, 1))
+
+	report := scheduler.Stop()
+	for _, strategy := range []*scripted{seller, buyer, watcher} {
+		receive(t, strategy.stopped, 1)
+	}
+
+	if report.LastTradedPrice != 110 || len(report.Agents) != 3 {
+		t.Fatalf("Expected three agents marked at 110, got %+v", report)
+	}
+	expected := []struct {
+		id       string
+		orders   int
+		position int64
+		pnl      float64
+	}{
+		{"buyer", 3, 6, 60},
+		{"watcher", 0, 0, 0},
+		{"seller", 1, -6, -60},
+	}
+	for i, e := range expected {
+		agent := report.Agents[i]
+		if agent.ID != e.id || agent.Orders != e.orders || agent.Position != e.position || agent.PnL != e.pnl {
+			t.Errorf("Expected %s with %d orders, position %d and P&L %.0f, got %+v", e.id, e.orders, e.position, e.pnl, agent)
+		}
+	}
+	if report.Agents[0].Strategy != "scripted" || report.Agents[0].Volume != 6 {
+		t.Errorf("Expected the buyer's strategy and volume, got %+v", report.Agents[0])
+	}
+
+	var table bytes.Buffer
+	report.WriteTable(&table)
+	if lines := strings.Split(strings.TrimSpace(table.String()), "\n"); len(lines) != 4 || !strings.Contains(lines[1], "buyer") {
+		t.Errorf("Expected a header and a line per agent, got\n%s", table.String())
+	}
+}
+
+func TestAgentCancel(t *testing.T) {
+	exch, _ := newTestExchange()
+	scheduler := NewScheduler(exch, 0)
+	alice, _ := scheduler.Add("alice", 10000, newScripted())
+	bob, _ := scheduler.Add("bob", 10000, newScripted())
+
+	report, err := alice.Submit(exchange.Transaction{Type: exchange.BuyTransactionType, Amount: 90, Quantity: 1})
+	if err != nil {
+		t.Fatalf("Failed to submit: %v", err)
+	}
+	alice.Submit(exchange.Transaction{Type: exchange.BuyTransactionType, Amount: 91, Quantity: 1})
+
+	if _, err := bob.Cancel(report.OrderID); !errors.Is(err, ErrNotOwner) {
+		t.Errorf("Expected ErrNotOwner, got %v", err)
+	}
+	if _, err := alice.Cancel(report.OrderID); err != nil {
+		t.Errorf("Expected alice to cancel her order, got %v", err)
+	}
+	if open := alice.OpenOrders(); len(open) != 1 {
+		t.Errorf("Expected 1 open order, got %d", len(open))
+	}
+
+	alice.CancelAll()
+	if open := alice.OpenOrders(); len(open) != 0 {
+		t.Errorf("Expected no open orders, got %d", len(open))
+	}
+	if position := alice.Position(); position.Quantity != 0 || alice.Cash() != 10000 {
+		t.Errorf("Expected no position and untouched cash, got %+v and %d", position, alice.Cash())
+	}
+}
+
+func TestAgentRand(t *testing.T) {
+	draws := func(seed int64) []int64 {
+		exch, _ := newTestExchange()
+		scheduler := NewScheduler(exch, 0)
+		scheduler.SetSeed(seed)
+		values := make([]int64, 0)
+		for _, id := range []string{"alice", "bob"} {
+			agent, err := scheduler.Add(id, 10000, newScripted())
+			if err != nil {
+				t.Fatalf("Failed to add %s: %v", id, err)
+			}
+			values = append(values, agent.Rand().Int63(), agent.Rand().Int63())
+		}
+		return values
+	}
+
+	first, second := draws(42), draws(42)
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("Expected the same draws with the same seed, got %v and %v", first, second)
+		}
+	}
+	if first[0] == first[2] {
+		t.Errorf("Expected agents to draw from different sources, got %v", first)
+	}
+	if other := draws(43); other[0] == first[0] {
+		t.Errorf("Expected different draws with another seed, got %v and %v", first, other)
+	}
+}
+
+func TestAddRecoveredAccount(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.log")
+	// session starts the exchange from the journal, as the simulator does on startup
+	session := func() (*exchange.Exchange, *exchange.Journal) {
+		registry := exchange.NewInstrumentRegistry()
+		registry.Add("SIM", 100)
+		journal, _, err := registry.Recover(path, exchange.RecoveryOptions{Journal: exchange.JournalOptions{Sync: exchange.SyncNever}})
+		if err != nil {
+			t.Fatalf("Failed to recover: %v", err)
+		}
+		exch, _ := registry.Get("SIM")
+		return exch, journal
+	}
+	buy := func(price exchange.TransactionAmtDataType) exchange.Transaction {
+		return exchange.Transaction{Type: exchange.BuyTransactionType, Amount: price, Quantity: 2}
+	}
+
+	// The first run leaves two of bob's orders resting
+	exch, journal := session()
+	bob, _ := NewScheduler(exch, 0).Add("bob", 10000, newScripted())
+	bob.Submit(buy(95))
+	bob.Submit(buy(96))
+	journal.Close()
+
+	exch, journal = session()
+	defer journal.Close()
+	scheduler := NewScheduler(exch, 0)
+	strategy := newScripted()
+	bob, err := scheduler.Add("bob", 10000, strategy)
+	if err != nil {
+		t.Fatalf("Failed to take over the recovered account: %v", err)
+	}
+
+	// New orders are numbered after the recovered ones instead of colliding with them
+	report, err := bob.Submit(buy(94))
+	if err != nil || report.OrderID != "bob-3" {
+		t.Fatalf("Expected order bob-3 to be accepted, got %+v and %v", report, err)
+	}
+
+	// The recovered orders belong to the agent
+	scheduler.Start()
+	defer scheduler.Stop()
+	exch.Submit(exchange.Transaction{Type: exchange.SellTransactionType, Amount: 96, Quantity: 2})
+	if fill := receive(t, strategy.fills, 1)[0]; fill.OrderID != "bob-2" || fill.Quantity != 2 {
+		t.Errorf("Expected a fill of 2 on bob-2, got %+v", fill)
+	}
+	if _, err := bob.Cancel("bob-1"); err != nil {
+		t.Errorf("Expected bob to cancel the recovered order, got %v", err)
+	}
+}
+
+func TestConcurrentAgents(t *testing.T) {
+	exch, _ := newTestExchange()
+	scheduler := NewScheduler(exch, 0)
+	for i := 1; i <= 3; i++ {
+		config := MarketMakerConfig{Spread: 2, Size: 3, Skew: 0.1, MaxPosition: 30}
+		if _, err := scheduler.Add(fmt.Sprintf("maker-%d", i), 1000000, NewMarketMaker(config)); err != nil {
+			t.Fatalf("Failed to add maker-%d: %v", i, err)
+		}
+	}
+	scheduler.Start()
+
+	// Anonymous market orders only trade with the makers, so they end up holding
+	// the opposite of what the submitters bought and sold
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var bought int64
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				side, sign := exchange.BuyTransactionType, int64(1)
+				if (i+j)%2 == 1 {
+					side, sign = exchange.SellTransactionType, -1
+				}
+				report, _ := exch.Submit(exchange.Transaction{Type: side, OrderType: exchange.MarketOrderType, Quantity: 2})
+				mutex.Lock()
+				bought += sign * int64(report.Filled)
+				mutex.Unlock()
+				scheduler.Report()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	report := scheduler.Stop()
+	var held int64
+	for _, agent := range report.Agents {
+		held += agent.Position
+	}
+	if held != -bought {
+		t.Errorf("Expected the makers to hold %d, got %d", -bought, held)
+	}
+	for _, agent := range scheduler.Agents() {
+		if open := agent.OpenOrders(); len(open) != 0 {
+			t.Errorf("Expected %s to pull its quotes, got %+v", agent.ID, open)
+		}
+	}
+}
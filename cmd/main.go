@@ -1,47 +1,254 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"math/rand"
 	"os"
 	"os/signal"
+	"github.com/rohan/stock-simulator/agent"
 	"github.com/rohan/stock-simulator/exchange"
+	"github.com/rohan/stock-simulator/generator"
 	"github.com/rohan/stock-simulator/ui"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 )
 
 func main() {
-	// As of Go 1.20, rand.Seed is deprecated and no longer needed
-	// The default global random source is automatically seeded with a random value
+	symbols := flag.String("symbols", exchange.DefaultSymbol, "Comma separated list of symbols to simulate")
+	accounts := flag.String("accounts", "", "Comma separated list of trader accounts to open as id:cash")
+	maxShort := flag.Int64("max-short", 0, "Largest short position an account may hold in a symbol")
+	maxOrderSize := flag.Int("max-order-size", 0, "Largest quantity of a single order (0 disables the check)")
+	maxNotional := flag.Int64("max-notional", 0, "Largest price times quantity of a single order (0 disables the check)")
+	maxOpenOrders := flag.Int("max-open-orders", 0, "Most orders an account may have resting (0 disables the check)")
+	priceCollar := flag.Int("price-collar", 0, "Largest percentage a limit price may be away from the LTP (0 disables the check)")
+	journalPath := flag.String("journal", "", "File to journal accepted orders, cancels and trades to (empty disables the journal)")
+	journalSync := flag.String("journal-sync", string(exchange.SyncInterval), "When the journal is fsynced: always, interval or never")
+	journalSyncInterval := flag.Duration("journal-sync-interval", 100*time.Millisecond, "Time between fsyncs of the journal with -journal-sync=interval")
+	snapshotDir := flag.String("snapshot-dir", "", "Directory to write snapshots of the books and accounts to, so a restart replays only the journal after the latest one (requires -journal)")
+	snapshotInterval := flag.Duration("snapshot-interval", 5*time.Minute, "Time between snapshots with -snapshot-dir")
+	replayPath := flag.String("replay", "", "Backtest a recorded order stream (journal, .csv or .jsonl) on a simulated clock and exit")
+	replayTrades := flag.String("replay-trades", "", "File to write the trades of -replay to, one JSON trade per line")
+	replayState := flag.String("replay-state", "", "File to write the final books and accounts of -replay to as JSON")
+	journalTruncate := flag.Bool("journal-truncate", false, "Drop a damaged record at the end of the journal and everything after it instead of refusing to start")
+	var generators generatorSpecs
+	flag.Var(&generators, "generator", "Order flow model to run on every instrument, as model or model:name=value,... (repeat to mix models; one of "+strings.Join(generator.Models(), ", ")+")")
+	generateInterval := flag.Duration("generate-interval", time.Second, "Time between ticks of the order flow generators")
+	marketMakers := flag.Int("market-makers", 0, "Number of market-making agents quoting on every instrument")
+	marketMakerSpread := flag.Int("market-maker-spread", int(agent.DefaultMarketMakerConfig.Spread), "Distance between the bid and the ask of a market maker")
+	marketMakerSize := flag.Int("market-maker-size", int(agent.DefaultMarketMakerConfig.Size), "Quantity of each quote of a market maker")
+	marketMakerSkew := flag.Float64("market-maker-skew", agent.DefaultMarketMakerConfig.Skew, "Price a market maker moves its quotes per unit of inventory")
+	marketMakerMaxPosition := flag.Int64("market-maker-max-position", agent.DefaultMarketMakerConfig.MaxPosition, "Largest position a market maker holds long or short (0 is unlimited)")
+	marketMakerCash := flag.Int64("market-maker-cash", 1000000, "Starting cash of each market maker")
+	seed := flag.Int64("seed", 0, "Seed of the random numbers of the order flow generators and agents, to reproduce a run (0 picks one from the time)")
+	flag.Parse()
 
 	// Create a logger for the main component
 	logger := exchange.NewLogger("Main")
 	logger.Info("Starting Stock Market Simulator")
 
+	// All randomness is drawn from one seeded source, so a run can be reproduced
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(*seed))
+	logger.Info(fmt.Sprintf("Random seed: %d (rerun with -seed %d to reproduce)", *seed, *seed))
+
 	var ltp exchange.TransactionAmtDataType = 100
-	logger.Info("Initializing exchange with LTP: 100")
-	stockExchange := exchange.NewExchange(ltp)
+	registry := exchange.NewInstrumentRegistry()
+	for _, symbol := range strings.Split(*symbols, ",") {
+		if _, err := registry.Add(symbol, ltp); err != nil {
+			logger.Fatal("Failed to add instrument: " + err.Error())
+		}
+		logger.Info(fmt.Sprintf("Initializing %s exchange with LTP: %d", exchange.NormalizeSymbol(symbol), ltp))
+	}
 
-	// Start the trade processing goroutine
-	go stockExchange.ProcessTrades()
+	if *replayPath != "" && *journalPath != "" {
+		logger.Fatal("-replay cannot be combined with -journal")
+	}
 
-	// Start the trade acceptance goroutine
-	go stockExchange.AcceptTrades()
+	// Recover the state recorded in the journal, then record every new event in it so
+	// the exchange can be reconstructed after a crash
+	if *journalPath != "" {
+		policy, err := exchange.ParseSyncPolicy(*journalSync)
+		if err != nil {
+			logger.Fatal("Invalid journal sync policy: " + err.Error())
+		}
+		journal, recovery, err := registry.Recover(*journalPath, exchange.RecoveryOptions{
+			Journal: exchange.JournalOptions{
+				Sync:         policy,
+				SyncInterval: *journalSyncInterval,
+			},
+			TruncateCorruptTail: *journalTruncate,
+			SnapshotDir:         *snapshotDir,
+		})
+		if errors.Is(err, exchange.ErrJournalCorrupted) && !*journalTruncate {
+			logger.Fatal("Failed to recover from journal: " + err.Error() + " (restart with -journal-truncate to drop the damaged tail)")
+		}
+		if err != nil {
+			logger.Fatal("Failed to recover from journal: " + err.Error())
+		}
+		defer func() {
+			if err := registry.Checkpoint(); err != nil {
+				logger.Error("Failed to checkpoint journal: " + err.Error())
+			}
+			if *snapshotDir != "" {
+				if _, err := registry.WriteSnapshot(*snapshotDir); err != nil {
+					logger.Error("Failed to write snapshot: " + err.Error())
+				}
+			}
+			journal.Close()
+		}()
 
-	// Start the random trade generation goroutine
-	go func() {
-		generateRandomTrades(&stockExchange, logger)
-	}()
+		if recovery.TruncatedBytes > 0 {
+			logger.Warn(fmt.Sprintf("Truncated %d damaged bytes from the end of the journal", recovery.TruncatedBytes))
+		}
+		if len(recovery.Unjournaled) > 0 {
+			logger.Warn(fmt.Sprintf("Journaled %d trades reproduced by the replay that were missing from the journal", len(recovery.Unjournaled)))
+		}
+		if recovery.Snapshot > 0 {
+			logger.Info(fmt.Sprintf("Loaded snapshot at journal sequence %d", recovery.Snapshot))
+		}
+		logger.Info(fmt.Sprintf("Recovered %d events (%d accounts, %d orders, %d trades, %d checkpoints) from %s",
+			recovery.Events, recovery.Accounts, recovery.Orders, recovery.Trades, recovery.Checkpoints, *journalPath))
+		logger.Info(fmt.Sprintf("Journaling to %s with fsync policy %s", *journalPath, policy))
+	}
+
+	if *snapshotDir != "" && *journalPath == "" {
+		logger.Fatal("Snapshots require a journal, set -journal as well as -snapshot-dir")
+	}
+
+	// Open the trader accounts shared by every instrument
+	if *accounts != "" {
+		for _, account := range strings.Split(*accounts, ",") {
+			id, cash, err := parseAccount(account)
+			if err == nil && registry.Accounts().Exists(id) {
+				logger.Info(fmt.Sprintf("Account %s was recovered from the journal", id))
+				continue
+			}
+			if err == nil {
+				err = registry.Accounts().Open(id, cash)
+			}
+			if err != nil {
+				logger.Fatal("Failed to open account: " + err.Error())
+			}
+			logger.Info(fmt.Sprintf("Opened account %s with cash: %d", id, cash))
+		}
+	}
+
+	// Configure the pre-trade risk checks of every instrument
+	registry.AddRiskCheck(exchange.CashCheck())
+	registry.AddRiskCheck(exchange.PositionCheck(*maxShort))
+	if *maxOrderSize > 0 {
+		registry.AddRiskCheck(exchange.MaxOrderSizeCheck(exchange.TransactionQtyDataType(*maxOrderSize)))
+	}
+	if *maxNotional > 0 {
+		registry.AddRiskCheck(exchange.MaxNotionalCheck(*maxNotional))
+	}
+	if *maxOpenOrders > 0 {
+		registry.AddRiskCheck(exchange.OpenOrderLimitCheck(*maxOpenOrders))
+	}
+	if *priceCollar > 0 {
+		registry.AddRiskCheck(exchange.PriceCollarCheck(*priceCollar))
+	}
+
+	// Backtest a recorded order stream instead of running the simulator
+	if *replayPath != "" {
+		if err := runReplay(registry, *replayPath, *replayTrades, *replayState, logger); err != nil {
+			logger.Fatal("Replay failed: " + err.Error())
+		}
+		return
+	}
+
+	// Start the trade processing and acceptance goroutines of every instrument
+	registry.Start()
+
+	// Snapshot the books and accounts so a restart does not replay the whole journal
+	if *snapshotDir != "" {
+		go registry.SnapshotPeriodically(*snapshotDir, *snapshotInterval)
+	}
+
+	// Start the order flow generators of every instrument
+	if len(generators) == 0 {
+		generators = generatorSpecs{generator.DefaultSpec}
+	}
+	for _, spec := range generators {
+		logger.Info(fmt.Sprintf("Generating order flow with %s every %v", spec, *generateInterval))
+	}
+	for _, stockExchange := range registry.Exchanges() {
+		for _, spec := range generators {
+			gen, err := generator.New(spec, rand.New(rand.NewSource(rng.Int63())))
+			if err != nil {
+				logger.Fatal("Failed to create generator: " + err.Error())
+			}
+			go generator.Run(stockExchange, gen, registry.Clock(), *generateInterval, nil)
+		}
+	}
+
+	// Start the market-making agents of every instrument
+	schedulers := make([]*agent.Scheduler, 0)
+	if *marketMakers > 0 {
+		config := agent.MarketMakerConfig{
+			Spread:      exchange.TransactionAmtDataType(*marketMakerSpread),
+			Size:        exchange.TransactionQtyDataType(*marketMakerSize),
+			Skew:        *marketMakerSkew,
+			MaxPosition: *marketMakerMaxPosition,
+		}
+		if *maxShort < config.MaxPosition {
+			logger.Warn(fmt.Sprintf("Market makers can only go %d short, raise -max-short to let them reach -market-maker-max-position", *maxShort))
+		}
+		for _, stockExchange := range registry.Exchanges() {
+			scheduler := agent.NewScheduler(stockExchange, 0)
+			scheduler.SetSeed(rng.Int63())
+			for i := 1; i <= *marketMakers; i++ {
+				id := fmt.Sprintf("mm-%s-%d", strings.ToLower(stockExchange.Symbol), i)
+				if _, err := scheduler.Add(id, *marketMakerCash, agent.NewMarketMaker(config)); err != nil {
+					logger.Fatal("Failed to add market maker: " + err.Error())
+				}
+			}
+			scheduler.Start()
+			schedulers = append(schedulers, scheduler)
+		}
+		logger.Info(fmt.Sprintf("Started %d market makers on every instrument with %+v", *marketMakers, config))
+	}
 
 	// Start the UI server
 	logger.Info("Starting UI server")
-	uiServer := ui.NewServer(&stockExchange)
+	uiServer := ui.NewRegistryServer(registry)
+
+	for _, stockExchange := range registry.Exchanges() {
+		symbol := stockExchange.Symbol
+
+		// Register a callback to broadcast price updates to UI clients
+		stockExchange.RegisterPriceUpdateCallback(func(price int) {
+			uiServer.BroadcastSymbolPriceUpdate(symbol, price)
+		})
 
-	// Register a callback to broadcast price updates to UI clients
-	stockExchange.RegisterPriceUpdateCallback(func(price int) {
-		uiServer.BroadcastPriceUpdate(price)
-	})
+		// Register a callback to publish executed trades to UI clients
+		stockExchange.RegisterTradeCallback(func(trade exchange.Trade) {
+			uiServer.BroadcastTrade(trade)
+		})
+
+		// Register a callback to stream price level changes to UI clients
+		stockExchange.RegisterBookUpdateCallback(func(update exchange.BookUpdate) {
+			uiServer.BroadcastBookUpdate(update)
+		})
+
+		// Register a callback to stream candle updates to UI clients
+		stockExchange.RegisterCandleCallback(func(candle exchange.Candle) {
+			uiServer.BroadcastCandle(candle)
+		})
+
+		// Register a callback to publish order reports to the clients following their account
+		stockExchange.RegisterOrderReportCallback(func(report exchange.OrderReport) {
+			uiServer.BroadcastOrderReport(report)
+		})
+	}
 
 	// Start the UI server on port 8080
 	uiServer.Start("8080")
@@ -54,68 +261,115 @@ func main() {
 		memStatsTicker := time.NewTicker(30 * time.Second)
 		for {
 			<-memStatsTicker.C
-			stats := stockExchange.GetMemoryStats()
-			logger.Info(fmt.Sprintf("Memory stats - Allocated: %d, Recycled: %d, Saved: %d nodes",
-				stats["TotalAllocated"], stats["TotalRecycled"], stats["MemorySaved"]))
+			for _, stockExchange := range registry.Exchanges() {
+				stats := stockExchange.GetMemoryStats()
+				logger.Info(fmt.Sprintf("[%s] Memory stats - Allocated: %d, Recycled: %d, Saved: %d nodes",
+					stockExchange.Symbol, stats["TotalAllocated"], stats["TotalRecycled"], stats["MemorySaved"]))
+			}
+
+			// Checkpoints let a replay of the journal verify the state it rebuilds
+			if err := registry.Checkpoint(); err != nil {
+				logger.Error("Failed to checkpoint journal: " + err.Error())
+			}
+
+			wsStats := uiServer.WebSocketStats()
+			logger.Info(fmt.Sprintf("WebSocket stats - Clients: %d, Dropped: %d, Conflated: %d, Slow disconnects: %d",
+				wsStats["Clients"], wsStats["DroppedMessages"], wsStats["ConflatedSnapshots"], wsStats["SlowClientDisconnects"]))
 		}
 	}()
 	
 	blockUntilSigInt(logger)
+
+	// Report how the agents did, with their quotes pulled
+	for _, scheduler := range schedulers {
+		report := scheduler.Stop()
+		var table bytes.Buffer
+		report.WriteTable(&table)
+		logger.Info(fmt.Sprintf("[%s] Agent P&L marked at %d:\n%s", report.Symbol, report.LastTradedPrice, table.String()))
+	}
 }
 
-// generateRandomTrades generates random buy and sell orders at regular intervals
-func generateRandomTrades(stkExch *exchange.Exchange, logger *exchange.Logger) {
-	logger.Info("Starting random trade generation")
-	ticker := time.NewTicker(time.Second)
-
-	for {
-		<-ticker.C
-		currentPrice := int(stkExch.LastTradedPrice)
-
-		for i := 0; i < 5; i++ {
-			// Generate buy order
-			buyPrice := getRandomIntForBuy(currentPrice)
-			buyTxn := exchange.NewTransaction(
-				exchange.BuyTransactionType,
-				exchange.TransactionAmtDataType(buyPrice),
-			)
-			stkExch.IncomingTrades <- buyTxn
-			logger.Debug("Generated buy order with price: " + fmt.Sprintf("%d", buyPrice))
-
-			// Generate sell order
-			sellPrice := getRandomIntForSell(currentPrice)
-			sellTxn := exchange.NewTransaction(
-				exchange.SellTransactionType,
-				exchange.TransactionAmtDataType(sellPrice),
-			)
-			stkExch.IncomingTrades <- sellTxn
-			logger.Debug("Generated sell order with price: " + fmt.Sprintf("%d", sellPrice))
-		}
+// parseAccount parses an account given as id:cash
+func parseAccount(value string) (string, int64, error) {
+	id, cashValue, found := strings.Cut(strings.TrimSpace(value), ":")
+	if !found {
+		return "", 0, fmt.Errorf("account %q must be given as id:cash", value)
+	}
+	cash, err := strconv.ParseInt(cashValue, 10, 64)
+	if err != nil || cash < 0 {
+		return "", 0, fmt.Errorf("account %q has an invalid cash balance", value)
 	}
+	return id, cash, nil
 }
 
-// getRandomIntForBuy generates a random price for a buy order
-// Ensures the price is at least 1 (minimum valid price)
-func getRandomIntForBuy(target int) int {
-	// Set minimum price to max(1, target-100)
-	min := max(1, target-100)
+// runReplay backtests a recorded order stream on a simulated clock starting at the
+// time of its first event and writes the trades and final state it produces
+func runReplay(registry *exchange.InstrumentRegistry, path, tradesPath, statePath string, logger *exchange.Logger) error {
+	events, err := exchange.ReadOrderStream(path)
+	if err != nil {
+		return err
+	}
+	start := time.Unix(0, 0).UTC()
+	for _, event := range events {
+		if !event.Time.IsZero() {
+			start = event.Time
+			break
+		}
+	}
 
-	// Set maximum price to max(target, min+1)
-	maxPrice := max(target, min+1)
+	began := time.Now()
+	result, err := registry.Backtest(events, exchange.NewSimulatedClock(start))
+	if err != nil {
+		return err
+	}
+	logger.Info(fmt.Sprintf("Replayed %d events in %v: %d orders, %d rejected, %d trades",
+		result.Events, time.Since(began), result.Orders, result.Rejected, len(result.Trades)))
 
-	return rand.Intn(maxPrice-min+1) + min
+	if tradesPath != "" {
+		var trades bytes.Buffer
+		encoder := json.NewEncoder(&trades)
+		for _, trade := range result.Trades {
+			if err := encoder.Encode(trade); err != nil {
+				return err
+			}
+		}
+		if err := os.WriteFile(tradesPath, trades.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	if statePath != "" {
+		state, err := json.MarshalIndent(result.Final, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(statePath, append(state, '\n'), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// getRandomIntForSell generates a random price for a sell order
-// Ensures the price is at least 1 (minimum valid price)
-func getRandomIntForSell(target int) int {
-	// Set minimum price to max(1, target-25)
-	min := max(1, target-25)
+// generatorSpecs collects the generators given with repeated -generator flags
+type generatorSpecs []generator.Spec
 
-	// Set maximum price to max(target+100, min+1)
-	maxPrice := max(target+100, min+1)
+func (specs *generatorSpecs) String() string {
+	values := make([]string, len(*specs))
+	for i, spec := range *specs {
+		values[i] = spec.String()
+	}
+	return strings.Join(values, " ")
+}
 
-	return rand.Intn(maxPrice-min+1) + min
+func (specs *generatorSpecs) Set(value string) error {
+	spec, err := generator.ParseSpec(value)
+	if err == nil {
+		err = spec.Validate()
+	}
+	if err != nil {
+		return err
+	}
+	*specs = append(*specs, spec)
+	return nil
 }
 
 // blockUntilSigInt blocks until a SIGINT (Ctrl+C) is received
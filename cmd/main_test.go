@@ -1,101 +1,64 @@
 package main
 
 import (
+	"errors"
 	"testing"
-	"time"
-	
-	"github.com/rohan/stock-simulator/exchange"
+
+	"github.com/rohan/stock-simulator/generator"
 )
 
-// TestMainInitialization tests that the main package initializes correctly
-// This is a basic smoke test to ensure the main functions don't panic
-func TestMainInitialization(t *testing.T) {
-	// Test the random price generation functions
+// TestGeneratorSpecs tests that repeated -generator flags are parsed and validated
+func TestGeneratorSpecs(t *testing.T) {
 	testCases := []struct {
-		name       string
-		targetPrice int
-		minExpected int
-		maxExpected int
-		testFunc    func(int) int
+		name          string
+		values        []string
+		expected      string
+		expectedError error
 	}{
 		{
-			name:       "Buy price generation",
-			targetPrice: 100,
-			minExpected: 1,
-			maxExpected: 100,
-			testFunc:    getRandomIntForBuy,
+			name:     "Single model",
+			values:   []string{"uniform"},
+			expected: "uniform",
 		},
 		{
-			name:       "Sell price generation",
-			targetPrice: 100,
-			minExpected: 75,
-			maxExpected: 200,
-			testFunc:    getRandomIntForSell,
+			name:     "Mixed models with parameters",
+			values:   []string{"randomwalk:step=2,orders=8", "marketmaker:spread=4"},
+			expected: "randomwalk:orders=8,step=2 marketmaker:spread=4",
 		},
 		{
-			name:       "Buy price generation with low target",
-			targetPrice: 10,
-			minExpected: 1,
-			maxExpected: 10,
-			testFunc:    getRandomIntForBuy,
+			name:          "Unknown model",
+			values:        []string{"oracle"},
+			expectedError: generator.ErrUnknownModel,
 		},
 		{
-			name:       "Sell price generation with low target",
-			targetPrice: 10,
-			minExpected: 1,
-			maxExpected: 110,
-			testFunc:    getRandomIntForSell,
+			name:          "Unknown parameter",
+			values:        []string{"gbm:colour=1"},
+			expectedError: generator.ErrInvalidParameter,
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			// Run the function multiple times to check range
-			for i := 0; i < 100; i++ {
-				result := tc.testFunc(tc.targetPrice)
-				
-				// Check that the result is within the expected range
-				if result < tc.minExpected || result > tc.maxExpected {
-					t.Errorf("Expected result between %d and %d, got %d", 
-						tc.minExpected, tc.maxExpected, result)
+			var specs generatorSpecs
+			var err error
+			for _, value := range tc.values {
+				if err = specs.Set(value); err != nil {
+					break
 				}
 			}
-		})
-	}
-}
 
-// TestGenerateRandomTradesDoesNotPanic tests that the generateRandomTrades function doesn't panic
-func TestGenerateRandomTradesDoesNotPanic(t *testing.T) {
-	// This is a very basic test that just ensures the function doesn't panic
-	// We'll create a mock exchange and logger and run the function for a short time
-	
-	// Create a mock exchange
-	mockExchange := exchange.NewExchange(100)
-	mockLogger := exchange.NewLogger("TestLogger")
-	
-	// Start the function in a goroutine
-	done := make(chan bool)
-	go func() {
-		// We'll catch any panics
-		defer func() {
-			if r := recover(); r != nil {
-				t.Errorf("generateRandomTrades panicked: %v", r)
+			if tc.expectedError != nil {
+				if !errors.Is(err, tc.expectedError) {
+					t.Errorf("Expected error %v, got %v", tc.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
 			}
-			done <- true
-		}()
-		
-		// Start the function
-		go generateRandomTrades(&mockExchange, mockLogger)
-		
-		// Let it run for a short time
-		time.Sleep(100 * time.Millisecond)
-	}()
-	
-	// Wait for the test to complete
-	select {
-	case <-done:
-		// Test completed successfully
-	case <-time.After(1 * time.Second):
-		t.Errorf("Test timed out")
+			if specs.String() != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, specs.String())
+			}
+		})
 	}
 }
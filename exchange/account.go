@@ -0,0 +1,337 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// orderHistorySize is the number of orders remembered per account
+const orderHistorySize = 1000
+
+var (
+	// ErrUnknownAccount is returned when no account is open with an ID
+	ErrUnknownAccount = errors.New("unknown account")
+	// ErrDuplicateAccount is returned when an account ID is opened twice
+	ErrDuplicateAccount = errors.New("account already exists")
+	// ErrInvalidAccount is returned when an account ID is empty or contains whitespace or '/'
+	ErrInvalidAccount = errors.New("invalid account id")
+)
+
+// Position is an account's holding in one symbol. Quantity is negative for a
+// short position and AveragePrice is the average price it was opened at.
+type Position struct {
+	Symbol       string  `json:"symbol"`
+	Quantity     int64   `json:"quantity"`
+	AveragePrice float64 `json:"averagePrice"`
+	RealizedPnL  float64 `json:"realizedPnl"`
+}
+
+// PositionSummary is a position marked to the Last Traded Price of its symbol
+type PositionSummary struct {
+	Position
+	LastPrice     TransactionAmtDataType `json:"lastPrice"`
+	MarketValue   float64                `json:"marketValue"`
+	UnrealizedPnL float64                `json:"unrealizedPnl"`
+}
+
+// AccountSummary is the cash, positions and profit and loss of an account
+type AccountSummary struct {
+	ID            string            `json:"id"`
+	Cash          int64             `json:"cash"`
+	Positions     []PositionSummary `json:"positions"`
+	RealizedPnL   float64           `json:"realizedPnl"`
+	UnrealizedPnL float64           `json:"unrealizedPnl"`
+	// Equity is the cash plus the market value of every position
+	Equity float64 `json:"equity"`
+}
+
+// Account is a trader's cash balance, positions and recent orders
+type Account struct {
+	ID        string
+	Cash      int64
+	positions map[string]*Position
+	// orders holds the latest report of each order, orderIDs the order they were submitted in
+	orders   map[string]OrderReport
+	orderIDs []string
+	// open holds the orders still resting in a book
+	open map[string]OrderReport
+}
+
+// AccountManager keeps the accounts trading on one or more exchanges and
+// updates them as their orders are processed and filled
+type AccountManager struct {
+	accounts map[string]*Account
+	mutex    sync.RWMutex
+	// orderLock is held by an exchange from the risk checks of an account order until
+	// it is placed, so orders on different instruments cannot spend the same cash
+	orderLock sync.Mutex
+	// journal records every opened account, if set
+	journal *Journal
+}
+
+// NewAccountManager creates an account manager without any accounts
+func NewAccountManager() *AccountManager {
+	return &AccountManager{
+		accounts: make(map[string]*Account),
+	}
+}
+
+// SetJournal attaches the journal that opened accounts are written to.
+// It must be called before any account is opened.
+func (am *AccountManager) SetJournal(journal *Journal) {
+	am.journal = journal
+}
+
+// Open creates an account with an initial cash balance
+func (am *AccountManager) Open(id string, cash int64) error {
+	if id == "" || strings.ContainsAny(id, " \t\r\n/") {
+		return fmt.Errorf("%w: %q", ErrInvalidAccount, id)
+	}
+
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
+
+	if _, exists := am.accounts[id]; exists {
+		return fmt.Errorf("%w: %s", ErrDuplicateAccount, id)
+	}
+	if am.journal != nil {
+		if _, err := am.journal.Append(JournalEvent{Type: JournalAccount, AccountID: id, Cash: cash}); err != nil {
+			return err
+		}
+	}
+	am.accounts[id] = &Account{
+		ID:        id,
+		Cash:      cash,
+		positions: make(map[string]*Position),
+		orders:    make(map[string]OrderReport),
+		open:      make(map[string]OrderReport),
+	}
+	return nil
+}
+
+// Exists reports whether an account is open
+func (am *AccountManager) Exists(id string) bool {
+	am.mutex.RLock()
+	defer am.mutex.RUnlock()
+
+	_, ok := am.accounts[id]
+	return ok
+}
+
+// IDs returns the ID of every account in alphabetical order
+func (am *AccountManager) IDs() []string {
+	am.mutex.RLock()
+	defer am.mutex.RUnlock()
+
+	ids := make([]string, 0, len(am.accounts))
+	for id := range am.accounts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Cash returns the cash balance of an account
+func (am *AccountManager) Cash(id string) (int64, error) {
+	am.mutex.RLock()
+	defer am.mutex.RUnlock()
+
+	account, ok := am.accounts[id]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownAccount, id)
+	}
+	return account.Cash, nil
+}
+
+// Position returns an account's position in a symbol
+func (am *AccountManager) Position(id, symbol string) (Position, error) {
+	am.mutex.RLock()
+	defer am.mutex.RUnlock()
+
+	account, ok := am.accounts[id]
+	if !ok {
+		return Position{}, fmt.Errorf("%w: %s", ErrUnknownAccount, id)
+	}
+	if position, ok := account.positions[symbol]; ok {
+		return *position, nil
+	}
+	return Position{Symbol: symbol}, nil
+}
+
+// Summary returns the cash and positions of an account with each position marked
+// to the price given for its symbol. Symbols without a mark are valued at their
+// average price.
+func (am *AccountManager) Summary(id string, marks map[string]TransactionAmtDataType) (AccountSummary, error) {
+	am.mutex.RLock()
+	defer am.mutex.RUnlock()
+
+	account, ok := am.accounts[id]
+	if !ok {
+		return AccountSummary{}, fmt.Errorf("%w: %s", ErrUnknownAccount, id)
+	}
+
+	summary := AccountSummary{
+		ID:        account.ID,
+		Cash:      account.Cash,
+		Positions: make([]PositionSummary, 0, len(account.positions)),
+		Equity:    float64(account.Cash),
+	}
+	for _, position := range account.positions {
+		mark, ok := marks[position.Symbol]
+		markPrice := float64(mark)
+		if !ok {
+			markPrice = position.AveragePrice
+		}
+
+		positionSummary := PositionSummary{
+			Position:      *position,
+			LastPrice:     mark,
+			MarketValue:   markPrice * float64(position.Quantity),
+			UnrealizedPnL: (markPrice - position.AveragePrice) * float64(position.Quantity),
+		}
+		summary.Positions = append(summary.Positions, positionSummary)
+		summary.RealizedPnL += position.RealizedPnL
+		summary.UnrealizedPnL += positionSummary.UnrealizedPnL
+		summary.Equity += positionSummary.MarketValue
+	}
+
+	sort.Slice(summary.Positions, func(i, j int) bool {
+		return summary.Positions[i].Symbol < summary.Positions[j].Symbol
+	})
+	return summary, nil
+}
+
+// Orders returns the latest report of each order submitted by an account, oldest first
+func (am *AccountManager) Orders(id string) ([]OrderReport, error) {
+	am.mutex.RLock()
+	defer am.mutex.RUnlock()
+
+	account, ok := am.accounts[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownAccount, id)
+	}
+
+	orders := make([]OrderReport, 0, len(account.orderIDs))
+	for _, orderID := range account.orderIDs {
+		orders = append(orders, account.orders[orderID])
+	}
+	return orders, nil
+}
+
+// OpenOrders returns the orders of an account that are still resting on any instrument
+func (am *AccountManager) OpenOrders(id string) []OrderReport {
+	am.mutex.RLock()
+	defer am.mutex.RUnlock()
+
+	account, ok := am.accounts[id]
+	if !ok {
+		return nil
+	}
+
+	open := make([]OrderReport, 0, len(account.open))
+	for _, report := range account.open {
+		open = append(open, report)
+	}
+	return open
+}
+
+// recordOrder stores the latest report of an order in its account's history
+func (am *AccountManager) recordOrder(report OrderReport) {
+	if report.AccountID == "" {
+		return
+	}
+
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
+
+	account, ok := am.accounts[report.AccountID]
+	if !ok {
+		return
+	}
+	account.recordOrder(report)
+}
+
+// recordOrder stores a report, forgetting the oldest order once the history is full
+func (account *Account) recordOrder(report OrderReport) {
+	if _, seen := account.orders[report.OrderID]; !seen {
+		if len(account.orderIDs) >= orderHistorySize {
+			delete(account.orders, account.orderIDs[0])
+			account.orderIDs = account.orderIDs[1:]
+		}
+		account.orderIDs = append(account.orderIDs, report.OrderID)
+	}
+	account.orders[report.OrderID] = report
+
+	if report.IsOpen() {
+		account.open[report.OrderID] = report
+	} else {
+		delete(account.open, report.OrderID)
+	}
+}
+
+// applyFill updates the cash, positions and order history of the accounts behind
+// both sides of a trade. Orders without an account are ignored.
+func (am *AccountManager) applyFill(symbol string, buy, sell Transaction, price TransactionAmtDataType, qty TransactionQtyDataType) {
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
+
+	if account, ok := am.accounts[buy.AccountID]; ok {
+		account.fill(symbol, int64(qty), price)
+		account.recordOrder(newOrderReport(buy, 0))
+	}
+	if account, ok := am.accounts[sell.AccountID]; ok {
+		account.fill(symbol, -int64(qty), price)
+		account.recordOrder(newOrderReport(sell, 0))
+	}
+}
+
+// fill applies a signed change in position at the given price. Any part of the
+// fill that reduces an existing position realizes profit or loss against its
+// average price; the rest opens or grows the position.
+func (account *Account) fill(symbol string, delta int64, price TransactionAmtDataType) {
+	account.Cash -= delta * int64(price)
+
+	position, ok := account.positions[symbol]
+	if !ok {
+		position = &Position{Symbol: symbol}
+		account.positions[symbol] = position
+	}
+
+	if position.Quantity != 0 && (position.Quantity > 0) != (delta > 0) {
+		closed := abs64(delta)
+		if abs64(position.Quantity) < closed {
+			closed = abs64(position.Quantity)
+		}
+		if position.Quantity > 0 {
+			position.RealizedPnL += float64(closed) * (float64(price) - position.AveragePrice)
+		} else {
+			position.RealizedPnL += float64(closed) * (position.AveragePrice - float64(price))
+		}
+
+		position.Quantity += delta
+		switch {
+		case position.Quantity == 0:
+			position.AveragePrice = 0
+		case (position.Quantity > 0) == (delta > 0):
+			// The fill flipped the position, the remainder was opened at this price
+			position.AveragePrice = float64(price)
+		}
+		return
+	}
+
+	held := float64(abs64(position.Quantity))
+	added := float64(abs64(delta))
+	position.AveragePrice = (position.AveragePrice*held + float64(price)*added) / (held + added)
+	position.Quantity += delta
+}
+
+// abs64 returns the absolute value of n
+func abs64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
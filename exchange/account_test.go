@@ -0,0 +1,136 @@
+package exchange
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAccountFills(t *testing.T) {
+	accounts := NewAccountManager()
+	if err := accounts.Open("alice", 10000); err != nil {
+		t.Fatalf("Failed to open account: %v", err)
+	}
+	if err := accounts.Open("alice", 500); !errors.Is(err, ErrDuplicateAccount) {
+		t.Errorf("Expected ErrDuplicateAccount, got %v", err)
+	}
+	if err := accounts.Open("bad id", 500); !errors.Is(err, ErrInvalidAccount) {
+		t.Errorf("Expected ErrInvalidAccount, got %v", err)
+	}
+
+	buy := Transaction{ID: "BUY-1", AccountID: "alice", Type: BuyTransactionType}
+	sell := Transaction{ID: "SELL-1", AccountID: "alice", Type: SellTransactionType}
+
+	steps := []struct {
+		name             string
+		order            Transaction
+		price            TransactionAmtDataType
+		qty              TransactionQtyDataType
+		expectedCash     int64
+		expectedQuantity int64
+		expectedAverage  float64
+		expectedRealized float64
+	}{
+		{"Open long", buy, 100, 10, 9000, 10, 100, 0},
+		{"Add to long", buy, 110, 10, 7900, 20, 105, 0},
+		{"Reduce long", sell, 115, 5, 8475, 15, 105, 50},
+		{"Flip to short", sell, 95, 20, 10375, -5, 95, -100},
+		{"Cover short", buy, 90, 5, 9925, 0, 0, -75},
+	}
+
+	for _, step := range steps {
+		if step.order.Type == BuyTransactionType {
+			accounts.applyFill("SIM", step.order, Transaction{}, step.price, step.qty)
+		} else {
+			accounts.applyFill("SIM", Transaction{}, step.order, step.price, step.qty)
+		}
+
+		cash, _ := accounts.Cash("alice")
+		position, _ := accounts.Position("alice", "SIM")
+		if cash != step.expectedCash {
+			t.Errorf("%s: Expected cash %d, got %d", step.name, step.expectedCash, cash)
+		}
+		if position.Quantity != step.expectedQuantity {
+			t.Errorf("%s: Expected quantity %d, got %d", step.name, step.expectedQuantity, position.Quantity)
+		}
+		if position.AveragePrice != step.expectedAverage {
+			t.Errorf("%s: Expected average price %v, got %v", step.name, step.expectedAverage, position.AveragePrice)
+		}
+		if position.RealizedPnL != step.expectedRealized {
+			t.Errorf("%s: Expected realized P&L %v, got %v", step.name, step.expectedRealized, position.RealizedPnL)
+		}
+	}
+}
+
+func TestAccountSummary(t *testing.T) {
+	accounts := NewAccountManager()
+	accounts.Open("bob", 5000)
+	accounts.applyFill("AAPL", Transaction{AccountID: "bob"}, Transaction{}, 100, 10)
+	accounts.applyFill("MSFT", Transaction{}, Transaction{AccountID: "bob"}, 50, 4)
+
+	summary, err := accounts.Summary("bob", map[string]TransactionAmtDataType{"AAPL": 120, "MSFT": 60})
+	if err != nil {
+		t.Fatalf("Failed to get summary: %v", err)
+	}
+
+	if summary.Cash != 4200 {
+		t.Errorf("Expected cash 4200, got %d", summary.Cash)
+	}
+	if len(summary.Positions) != 2 || summary.Positions[0].Symbol != "AAPL" {
+		t.Fatalf("Expected AAPL and MSFT positions, got %+v", summary.Positions)
+	}
+	// Long 10 AAPL up 20 and short 4 MSFT up 10
+	if summary.UnrealizedPnL != 160 {
+		t.Errorf("Expected unrealized P&L 160, got %v", summary.UnrealizedPnL)
+	}
+	if summary.Equity != 4200+1200-240 {
+		t.Errorf("Expected equity %d, got %v", 4200+1200-240, summary.Equity)
+	}
+
+	if _, err := accounts.Summary("nobody", nil); !errors.Is(err, ErrUnknownAccount) {
+		t.Errorf("Expected ErrUnknownAccount, got %v", err)
+	}
+}
+
+func TestExchangeUpdatesAccounts(t *testing.T) {
+	registry := NewInstrumentRegistry()
+	exchange, _ := registry.Add("SIM", 100)
+	accounts := registry.Accounts()
+	accounts.Open("buyer", 10000)
+	accounts.Open("seller", 0)
+	logger := NewLogger("TestExchangeUpdatesAccounts")
+
+	sell := NewTransactionWithQuantity(SellTransactionType, 101, 10)
+	sell.AccountID = "seller"
+	exchange.accept(sell, logger)
+
+	buy := NewTransactionWithQuantity(BuyTransactionType, 102, 4)
+	buy.AccountID = "buyer"
+	exchange.accept(buy, logger)
+
+	buyerCash, _ := accounts.Cash("buyer")
+	sellerCash, _ := accounts.Cash("seller")
+	if buyerCash != 10000-404 || sellerCash != 404 {
+		t.Errorf("Expected cash 9596 and 404, got %d and %d", buyerCash, sellerCash)
+	}
+
+	summary, _ := registry.AccountSummary("seller")
+	if len(summary.Positions) != 1 || summary.Positions[0].Quantity != -4 || summary.Positions[0].LastPrice != 101 {
+		t.Errorf("Expected a short position of 4 marked at 101, got %+v", summary.Positions)
+	}
+
+	// The resting sell order's history follows its fills and cancellation
+	orders, _ := accounts.Orders("seller")
+	if len(orders) != 1 || orders[0].Status != OrderStatusPartiallyFilled || orders[0].Filled != 4 {
+		t.Fatalf("Expected one partially filled order, got %+v", orders)
+	}
+	exchange.CancelOrder(sell.ID)
+	orders, _ = accounts.Orders("seller")
+	if orders[0].Status != OrderStatusCancelled || orders[0].Cancelled != 6 {
+		t.Errorf("Expected the order to be cancelled with quantity 6, got %+v", orders[0])
+	}
+
+	orders, _ = accounts.Orders("buyer")
+	if len(orders) != 1 || orders[0].Status != OrderStatusFilled {
+		t.Errorf("Expected one filled order, got %+v", orders)
+	}
+}
@@ -0,0 +1,250 @@
+package exchange
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidOrderStream is returned when a recorded order stream cannot be parsed
+var ErrInvalidOrderStream = errors.New("invalid order stream")
+
+// ReadOrderStream reads a recorded stream of accounts, orders, cancels and amendments.
+// A file ending in .csv holds one event per row under a header naming its columns
+// after the JSON fields of JournalEvent, a file ending in .jsonl or .ndjson holds one
+// JournalEvent as JSON per line and any other file is read as a journal. Events
+// without a type are orders.
+func ReadOrderStream(path string) ([]JournalEvent, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return readStreamFile(path, readCSVStream)
+	case ".jsonl", ".ndjson":
+		return readStreamFile(path, readJSONLStream)
+	}
+	return ReadJournal(path)
+}
+
+// readStreamFile opens a stream file and parses it with read
+func readStreamFile(path string, read func(io.Reader) ([]JournalEvent, error)) ([]JournalEvent, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return read(file)
+}
+
+// readJSONLStream parses one JournalEvent per line, skipping blank lines
+func readJSONLStream(r io.Reader) ([]JournalEvent, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	events := make([]JournalEvent, 0)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var event JournalEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %s", ErrInvalidOrderStream, line, err.Error())
+		}
+		if event.Type == "" {
+			event.Type = JournalOrder
+		}
+		events = append(events, event)
+	}
+	return events, scanner.Err()
+}
+
+// readCSVStream parses one event per row. Columns may appear in any order and
+// empty cells leave their field unset.
+func readCSVStream(r io.Reader) ([]JournalEvent, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return []JournalEvent{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidOrderStream, err.Error())
+	}
+	for _, column := range header {
+		if _, ok := csvColumns[column]; !ok {
+			return nil, fmt.Errorf("%w: unknown column %q", ErrInvalidOrderStream, column)
+		}
+	}
+
+	events := make([]JournalEvent, 0)
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidOrderStream, err.Error())
+		}
+
+		event := JournalEvent{Type: JournalOrder}
+		for i, value := range row {
+			if value == "" {
+				continue
+			}
+			if err := csvColumns[header[i]](&event, value); err != nil {
+				line, _ := reader.FieldPos(i)
+				return nil, fmt.Errorf("%w: line %d: column %s: %s", ErrInvalidOrderStream, line, header[i], err.Error())
+			}
+		}
+		events = append(events, event)
+	}
+}
+
+// csvColumns sets the field of an event named by each CSV column
+var csvColumns = map[string]func(event *JournalEvent, value string) error{
+	"time": func(event *JournalEvent, value string) (err error) {
+		event.Time, err = parseStreamTime(value)
+		return err
+	},
+	"type":      func(event *JournalEvent, value string) error { event.Type = JournalEventType(value); return nil },
+	"symbol":    func(event *JournalEvent, value string) error { event.Symbol = value; return nil },
+	"orderId":   func(event *JournalEvent, value string) error { event.OrderID = value; return nil },
+	"accountId": func(event *JournalEvent, value string) error { event.AccountID = value; return nil },
+	"side":      func(event *JournalEvent, value string) error { event.Side = strings.ToUpper(value); return nil },
+	"orderType": func(event *JournalEvent, value string) error { event.OrderType = strings.ToUpper(value); return nil },
+	"price": func(event *JournalEvent, value string) error {
+		price, err := strconv.ParseInt(value, 10, 32)
+		event.Price = TransactionAmtDataType(price)
+		return err
+	},
+	"quantity": func(event *JournalEvent, value string) error {
+		quantity, err := strconv.ParseInt(value, 10, 32)
+		event.Quantity = TransactionQtyDataType(quantity)
+		return err
+	},
+	"cash": func(event *JournalEvent, value string) (err error) {
+		event.Cash, err = strconv.ParseInt(value, 10, 64)
+		return err
+	},
+}
+
+// parseStreamTime parses a time given as Unix seconds or in RFC 3339 format
+func parseStreamTime(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+// BacktestResult is the outcome of a backtest
+type BacktestResult struct {
+	Events int
+	// Orders counts the orders submitted and Rejected the orders, cancels and
+	// amendments the exchange refused
+	Orders   int
+	Rejected int
+	// Trades holds every execution in the order it happened
+	Trades []Trade
+	// Final is the state of the books and accounts at the end of the run
+	Final *Snapshot
+}
+
+// Backtest submits a recorded stream to the registry's instruments as fast as
+// possible on a simulated clock, which is moved to the time of each event before it is
+// processed. Unlike a replay of the journal, orders are validated and risk checked
+// again, so a stream can be run against a different configuration. Instruments in
+// batch matching mode match their books whenever the clock passes a whole second, as
+// ProcessTrades would, and once more at the end. Trades and the other events that
+// record the outcome of a run are skipped. The same stream and configuration always
+// produce the same trades and final state. Start must not be called on the registry.
+func (reg *InstrumentRegistry) Backtest(events []JournalEvent, clock *SimulatedClock) (BacktestResult, error) {
+	reg.SetClock(clock)
+	logger := reg.newLogger("Backtest")
+
+	result := BacktestResult{Events: len(events), Trades: make([]Trade, 0)}
+	exchanges := reg.Exchanges()
+	for _, exch := range exchanges {
+		exch.matchLock.Lock()
+		exch.onTrade = func(trade Trade) {
+			result.Trades = append(result.Trades, trade)
+		}
+		exch.matchLock.Unlock()
+	}
+	defer func() {
+		for _, exch := range exchanges {
+			exch.matchLock.Lock()
+			exch.onTrade = nil
+			exch.matchLock.Unlock()
+		}
+	}()
+
+	for _, event := range events {
+		if !event.Time.IsZero() {
+			reg.advanceBacktest(clock, event.Time, logger)
+		}
+
+		switch event.Type {
+		case JournalAccount:
+			if err := reg.accounts.Open(event.AccountID, event.Cash); err != nil {
+				return result, fmt.Errorf("event %d: %w", event.Sequence, err)
+			}
+		case JournalOrder:
+			result.Orders++
+			txn := event.Transaction()
+			txn.Seq = 0
+			if _, err := reg.Submit(txn); err != nil {
+				result.Rejected++
+			}
+		case JournalCancel, JournalAmend:
+			// Like orders, cancels and amendments without a symbol are for the default instrument
+			exch := reg.Default()
+			if event.Symbol != "" {
+				exch, _ = reg.Get(event.Symbol)
+			}
+			if exch == nil {
+				logger.Warn(fmt.Sprintf("Refused %s of order %s: %s: %s", event.Type, event.OrderID, ErrUnknownSymbol.Error(), event.Symbol))
+				result.Rejected++
+				continue
+			}
+			var err error
+			if event.Type == JournalCancel {
+				_, err = exch.CancelOrder(event.OrderID)
+			} else {
+				_, err = exch.AmendOrder(event.OrderID, event.Price, event.Quantity)
+			}
+			if err != nil {
+				logger.Warn(fmt.Sprintf("Refused %s of order %s: %s", event.Type, event.OrderID, err.Error()))
+				result.Rejected++
+			}
+		}
+	}
+
+	// The next tick of ProcessTrades matches whatever the last orders left crossed
+	reg.advanceBacktest(clock, clock.Now().Truncate(time.Second).Add(time.Second), logger)
+
+	result.Final = reg.capture(reg.Journal())
+	return result, nil
+}
+
+// advanceBacktest moves the clock to t, first running the batch of every instrument
+// in batch matching mode if t passes a whole second
+func (reg *InstrumentRegistry) advanceBacktest(clock *SimulatedClock, t time.Time, logger *Logger) {
+	next := clock.Now().Truncate(time.Second).Add(time.Second)
+	if !t.Before(next) {
+		clock.Set(next)
+		for _, exch := range reg.Exchanges() {
+			if exch.matchingMode == BatchMatching {
+				exch.matchBatch(logger)
+			}
+		}
+	}
+	clock.Set(t)
+}
@@ -0,0 +1,171 @@
+package exchange
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const backtestCSV = `time,type,symbol,orderId,accountId,side,orderType,price,quantity,cash
+2025-04-27T15:00:00Z,account,,,alice,,,,,10000
+2025-04-27T15:00:00.100Z,,AAPL,,,SELL,,101,5,
+2025-04-27T15:00:00.200Z,,AAPL,S2,,sell,,102,5,
+2025-04-27T15:00:01.500Z,order,AAPL,B1,alice,BUY,,102,7,
+2025-04-27T15:00:02Z,amend,AAPL,S2,,,,103,5,
+2025-04-27T15:00:02.500Z,,AAPL,,,BUY,MARKET,,2,
+2025-04-27T15:00:03Z,cancel,AAPL,MISSING,,,,,,
+`
+
+func TestReadOrderStream(t *testing.T) {
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "orders.csv")
+	os.WriteFile(csvPath, []byte(backtestCSV), 0644)
+
+	events, err := ReadOrderStream(csvPath)
+	if err != nil {
+		t.Fatalf("Failed to read CSV: %v", err)
+	}
+	if len(events) != 7 {
+		t.Fatalf("Expected 7 events, got %d", len(events))
+	}
+	if events[0].Type != JournalAccount || events[0].AccountID != "alice" || events[0].Cash != 10000 {
+		t.Errorf("Expected alice's account, got %+v", events[0])
+	}
+	if events[2].Type != JournalOrder || events[2].Side != SellTransactionType || events[2].Price != 102 {
+		t.Errorf("Expected an order to sell at 102, got %+v", events[2])
+	}
+	if !events[5].Time.Equal(time.Date(2025, 4, 27, 15, 0, 2, 5e8, time.UTC)) || events[5].OrderType != MarketOrderType {
+		t.Errorf("Expected a market order at 15:00:02.5, got %+v", events[5])
+	}
+
+	// The same events as JSON lines, and as a journal
+	var jsonl bytes.Buffer
+	for _, event := range events {
+		json.NewEncoder(&jsonl).Encode(event)
+		jsonl.WriteString("\n")
+	}
+	jsonlPath := filepath.Join(dir, "orders.jsonl")
+	os.WriteFile(jsonlPath, jsonl.Bytes(), 0644)
+
+	journalPath := filepath.Join(dir, "orders.journal")
+	journal, _ := OpenJournal(journalPath, JournalOptions{Sync: SyncNever})
+	for _, event := range events {
+		journal.Append(event)
+	}
+	journal.Close()
+
+	for _, path := range []string{jsonlPath, journalPath} {
+		read, err := ReadOrderStream(path)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", filepath.Base(path), err)
+		}
+		if len(read) != len(events) {
+			t.Fatalf("%s: expected %d events, got %d", filepath.Base(path), len(events), len(read))
+		}
+		for i := range read {
+			if read[i].Type != events[i].Type || read[i].OrderID != events[i].OrderID || !read[i].Time.Equal(events[i].Time) {
+				t.Errorf("%s: expected event %+v, got %+v", filepath.Base(path), events[i], read[i])
+			}
+		}
+	}
+
+	invalid := []struct {
+		name    string
+		content string
+	}{
+		{"Unknown Column", "time,colour\n"},
+		{"Invalid Price", "symbol,side,price,quantity\nAAPL,BUY,cheap,1\n"},
+		{"Invalid Time", "time,side\nyesterday,BUY\n"},
+	}
+	for _, tc := range invalid {
+		path := filepath.Join(dir, "invalid.csv")
+		os.WriteFile(path, []byte(tc.content), 0644)
+		if _, err := ReadOrderStream(path); !errors.Is(err, ErrInvalidOrderStream) {
+			t.Errorf("%s: expected ErrInvalidOrderStream, got %v", tc.name, err)
+		}
+	}
+}
+
+func TestBacktestDeterminism(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orders.csv")
+	os.WriteFile(path, []byte(backtestCSV), 0644)
+	events, err := ReadOrderStream(path)
+	if err != nil {
+		t.Fatalf("Failed to read stream: %v", err)
+	}
+
+	run := func(mode MatchingMode) ([]byte, BacktestResult) {
+		registry := NewInstrumentRegistry()
+		exch, _ := registry.Add("AAPL", 100)
+		exch.SetMatchingMode(mode)
+		result, err := registry.Backtest(events, NewSimulatedClock(events[0].Time))
+		if err != nil {
+			t.Fatalf("Backtest failed: %v", err)
+		}
+		output, _ := json.Marshal(result)
+		return output, result
+	}
+
+	first, result := run(ContinuousMatching)
+	second, _ := run(ContinuousMatching)
+	if !bytes.Equal(first, second) {
+		t.Errorf("Expected identical runs, got\n%s\n%s", first, second)
+	}
+
+	if result.Orders != 4 || result.Rejected != 1 || len(result.Trades) != 3 {
+		t.Fatalf("Expected 4 orders, 1 refused cancel and 3 trades, got %+v", result)
+	}
+	// Trades are stamped with the simulated time of the order that caused them
+	if expected := time.Date(2025, 4, 27, 15, 0, 1, 5e8, time.UTC); !result.Trades[0].Timestamp.Equal(expected) {
+		t.Errorf("Expected the first trade at %v, got %v", expected, result.Trades[0].Timestamp)
+	}
+	if len(result.Final.Accounts) != 1 || result.Final.Accounts[0].Positions[0].Quantity != 7 {
+		t.Errorf("Expected alice to hold 7, got %+v", result.Final.Accounts)
+	}
+
+	// In batch mode the books only match once a simulated second has passed
+	batchFirst, batch := run(BatchMatching)
+	batchSecond, _ := run(BatchMatching)
+	if !bytes.Equal(batchFirst, batchSecond) {
+		t.Errorf("Expected identical batch runs, got\n%s\n%s", batchFirst, batchSecond)
+	}
+	if len(batch.Trades) == 0 || batch.Trades[0].Timestamp.Nanosecond() != 0 {
+		t.Errorf("Expected batch trades on whole seconds, got %+v", batch.Trades)
+	}
+}
+
+func TestBacktestWithoutSymbols(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orders.csv")
+	os.WriteFile(path, []byte(`time,type,orderId,side,price,quantity
+2025-04-27T15:00:00Z,order,S1,SELL,101,5
+2025-04-27T15:00:01Z,order,S2,SELL,102,5
+2025-04-27T15:00:02Z,amend,S1,,103,4
+2025-04-27T15:00:03Z,cancel,S2,,,
+2025-04-27T15:00:04Z,order,B1,BUY,103,4
+`), 0644)
+	events, err := ReadOrderStream(path)
+	if err != nil {
+		t.Fatalf("Failed to read stream: %v", err)
+	}
+
+	// Cancels and amendments go to the default instrument along with the orders
+	registry := NewInstrumentRegistry()
+	registry.Add("AAPL", 100)
+	result, err := registry.Backtest(events, NewSimulatedClock(events[0].Time))
+	if err != nil {
+		t.Fatalf("Backtest failed: %v", err)
+	}
+	if result.Orders != 3 || result.Rejected != 0 {
+		t.Errorf("Expected 3 orders and nothing refused, got %+v", result)
+	}
+	if len(result.Trades) != 1 || result.Trades[0].SellOrderID != "S1" || result.Trades[0].Price != 103 || result.Trades[0].Quantity != 4 {
+		t.Errorf("Expected the amended S1 to trade 4 at 103, got %+v", result.Trades)
+	}
+	if aapl, _ := registry.Get("AAPL"); len(aapl.GetDepth(0).Asks) != 0 {
+		t.Errorf("Expected the cancelled S2 to have left the book, got %+v", aapl.GetDepth(0).Asks)
+	}
+}
@@ -0,0 +1,134 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CandleInterval is the length of time covered by a candle
+type CandleInterval string
+
+const (
+	Interval1s CandleInterval = "1s"
+	Interval5s CandleInterval = "5s"
+	Interval1m CandleInterval = "1m"
+	Interval5m CandleInterval = "5m"
+	Interval1h CandleInterval = "1h"
+)
+
+// CandleIntervals are the intervals candles are built for, shortest first
+var CandleIntervals = []CandleInterval{Interval1s, Interval5s, Interval1m, Interval5m, Interval1h}
+
+// candleHistorySize is the number of candles kept per interval
+const candleHistorySize = 1000
+
+// ErrUnknownInterval is returned for a candle interval that is not built
+var ErrUnknownInterval = errors.New("unknown candle interval")
+
+// ParseCandleInterval returns the candle interval with the given name
+func ParseCandleInterval(name string) (CandleInterval, error) {
+	for _, interval := range CandleIntervals {
+		if string(interval) == name {
+			return interval, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnknownInterval, name)
+}
+
+// Duration returns the length of the interval
+func (interval CandleInterval) Duration() time.Duration {
+	duration, _ := time.ParseDuration(string(interval))
+	return duration
+}
+
+// Candle is the open, high, low and close price and the volume of the trades of a
+// symbol in one interval. Intervals without trades have no candle.
+type Candle struct {
+	Symbol   string                 `json:"symbol"`
+	Interval CandleInterval         `json:"interval"`
+	Start    time.Time              `json:"start"`
+	Open     TransactionAmtDataType `json:"open"`
+	High     TransactionAmtDataType `json:"high"`
+	Low      TransactionAmtDataType `json:"low"`
+	Close    TransactionAmtDataType `json:"close"`
+	Volume   int64                  `json:"volume"`
+	Trades   int                    `json:"trades"`
+}
+
+// CandleAggregator builds candles of every interval from the trades of a symbol and
+// keeps the most recent ones
+type CandleAggregator struct {
+	candles map[CandleInterval][]Candle
+	mutex   sync.RWMutex
+}
+
+// NewCandleAggregator creates an aggregator without any candles
+func NewCandleAggregator() *CandleAggregator {
+	return &CandleAggregator{
+		candles: make(map[CandleInterval][]Candle),
+	}
+}
+
+// Add adds a trade to the current candle of every interval, starting a new candle
+// when the trade falls in a later interval, and returns the updated candles
+func (ca *CandleAggregator) Add(trade Trade) []Candle {
+	ca.mutex.Lock()
+	defer ca.mutex.Unlock()
+
+	updated := make([]Candle, 0, len(CandleIntervals))
+	for _, interval := range CandleIntervals {
+		candles := ca.candles[interval]
+		start := trade.Timestamp.Truncate(interval.Duration())
+
+		if n := len(candles); n > 0 && !start.After(candles[n-1].Start) {
+			// Trades are added in execution order, so a trade never starts an earlier candle
+			candle := &candles[n-1]
+			if trade.Price > candle.High {
+				candle.High = trade.Price
+			}
+			if trade.Price < candle.Low {
+				candle.Low = trade.Price
+			}
+			candle.Close = trade.Price
+			candle.Volume += int64(trade.Quantity)
+			candle.Trades++
+		} else {
+			if len(candles) >= candleHistorySize {
+				candles = candles[1:]
+			}
+			candles = append(candles, Candle{
+				Symbol:   trade.Symbol,
+				Interval: interval,
+				Start:    start,
+				Open:     trade.Price,
+				High:     trade.Price,
+				Low:      trade.Price,
+				Close:    trade.Price,
+				Volume:   int64(trade.Quantity),
+				Trades:   1,
+			})
+		}
+
+		ca.candles[interval] = candles
+		updated = append(updated, candles[len(candles)-1])
+	}
+	return updated
+}
+
+// Candles returns the candles of an interval starting at or after from and before
+// to, oldest first. A zero from or to leaves that end of the range open.
+func (ca *CandleAggregator) Candles(interval CandleInterval, from, to time.Time) []Candle {
+	ca.mutex.RLock()
+	defer ca.mutex.RUnlock()
+
+	candles := make([]Candle, 0)
+	for _, candle := range ca.candles[interval] {
+		if candle.Start.Before(from) || (!to.IsZero() && !candle.Start.Before(to)) {
+			continue
+		}
+		candles = append(candles, candle)
+	}
+	return candles
+}
@@ -0,0 +1,135 @@
+package exchange
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCandleAggregator(t *testing.T) {
+	aggregator := NewCandleAggregator()
+	start := time.Date(2025, 4, 27, 15, 0, 0, 0, time.UTC)
+
+	trades := []struct {
+		offset   time.Duration
+		price    TransactionAmtDataType
+		quantity TransactionQtyDataType
+	}{
+		{0, 100, 1},
+		{200 * time.Millisecond, 104, 2},
+		{700 * time.Millisecond, 98, 3},
+		{1500 * time.Millisecond, 101, 4},
+		{6 * time.Second, 99, 5},
+		{61 * time.Second, 103, 6},
+	}
+	for _, trade := range trades {
+		updated := aggregator.Add(Trade{Symbol: "SIM", Price: trade.price, Quantity: trade.quantity, Timestamp: start.Add(trade.offset)})
+		if len(updated) != len(CandleIntervals) {
+			t.Fatalf("Expected %d updated candles, got %d", len(CandleIntervals), len(updated))
+		}
+	}
+
+	tests := []struct {
+		interval CandleInterval
+		expected []Candle
+	}{
+		{Interval1s, []Candle{
+			{Start: start, Open: 100, High: 104, Low: 98, Close: 98, Volume: 6, Trades: 3},
+			{Start: start.Add(time.Second), Open: 101, High: 101, Low: 101, Close: 101, Volume: 4, Trades: 1},
+			{Start: start.Add(6 * time.Second), Open: 99, High: 99, Low: 99, Close: 99, Volume: 5, Trades: 1},
+			{Start: start.Add(61 * time.Second), Open: 103, High: 103, Low: 103, Close: 103, Volume: 6, Trades: 1},
+		}},
+		{Interval5s, []Candle{
+			{Start: start, Open: 100, High: 104, Low: 98, Close: 101, Volume: 10, Trades: 4},
+			{Start: start.Add(5 * time.Second), Open: 99, High: 99, Low: 99, Close: 99, Volume: 5, Trades: 1},
+			{Start: start.Add(60 * time.Second), Open: 103, High: 103, Low: 103, Close: 103, Volume: 6, Trades: 1},
+		}},
+		{Interval1m, []Candle{
+			{Start: start, Open: 100, High: 104, Low: 98, Close: 99, Volume: 15, Trades: 5},
+			{Start: start.Add(time.Minute), Open: 103, High: 103, Low: 103, Close: 103, Volume: 6, Trades: 1},
+		}},
+		{Interval1h, []Candle{
+			{Start: start, Open: 100, High: 104, Low: 98, Close: 103, Volume: 21, Trades: 6},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.interval), func(t *testing.T) {
+			candles := aggregator.Candles(test.interval, time.Time{}, time.Time{})
+			if len(candles) != len(test.expected) {
+				t.Fatalf("Expected %d candles, got %d: %+v", len(test.expected), len(candles), candles)
+			}
+			for i, expected := range test.expected {
+				expected.Symbol = "SIM"
+				expected.Interval = test.interval
+				if !candles[i].Start.Equal(expected.Start) {
+					t.Errorf("Candle %d: expected start %v, got %v", i, expected.Start, candles[i].Start)
+				}
+				candles[i].Start = expected.Start
+				if candles[i] != expected {
+					t.Errorf("Candle %d: expected %+v, got %+v", i, expected, candles[i])
+				}
+			}
+		})
+	}
+
+	// from is inclusive and to exclusive
+	candles := aggregator.Candles(Interval1s, start.Add(time.Second), start.Add(61*time.Second))
+	if len(candles) != 2 || candles[0].Open != 101 || candles[1].Open != 99 {
+		t.Errorf("Expected the candles at 1s and 6s, got %+v", candles)
+	}
+}
+
+func TestCandleHistoryLimit(t *testing.T) {
+	aggregator := NewCandleAggregator()
+	start := time.Date(2025, 4, 27, 15, 0, 0, 0, time.UTC)
+	for i := 0; i < candleHistorySize+10; i++ {
+		aggregator.Add(Trade{Price: TransactionAmtDataType(i + 1), Quantity: 1, Timestamp: start.Add(time.Duration(i) * time.Second)})
+	}
+
+	candles := aggregator.Candles(Interval1s, time.Time{}, time.Time{})
+	if len(candles) != candleHistorySize {
+		t.Fatalf("Expected %d candles, got %d", candleHistorySize, len(candles))
+	}
+	if candles[0].Open != 11 {
+		t.Errorf("Expected the oldest candles to be dropped, got a first open of %d", candles[0].Open)
+	}
+}
+
+func TestParseCandleInterval(t *testing.T) {
+	for _, name := range []string{"1s", "5s", "1m", "5m", "1h"} {
+		interval, err := ParseCandleInterval(name)
+		if err != nil || string(interval) != name {
+			t.Errorf("Expected interval %s, got %s (%v)", name, interval, err)
+		}
+	}
+	if _, err := ParseCandleInterval("2m"); !errors.Is(err, ErrUnknownInterval) {
+		t.Errorf("Expected ErrUnknownInterval, got %v", err)
+	}
+	if Interval5m.Duration() != 5*time.Minute {
+		t.Errorf("Expected 5m to last 5 minutes, got %v", Interval5m.Duration())
+	}
+}
+
+func TestExchangeCandles(t *testing.T) {
+	exch := NewExchange(100)
+	var candles []Candle
+	exch.RegisterCandleCallback(func(candle Candle) {
+		candles = append(candles, candle)
+	})
+
+	exch.Submit(NewTransactionWithQuantity(SellTransactionType, 101, 5))
+	exch.Submit(NewTransactionWithQuantity(BuyTransactionType, 101, 3))
+
+	if len(candles) != len(CandleIntervals) {
+		t.Fatalf("Expected a candle per interval, got %+v", candles)
+	}
+	for i, candle := range candles {
+		if candle.Interval != CandleIntervals[i] || candle.Close != 101 || candle.Volume != 3 {
+			t.Errorf("Expected a %s candle closing at 101 with volume 3, got %+v", CandleIntervals[i], candle)
+		}
+	}
+	if stored := exch.GetCandles(Interval1m, time.Time{}, time.Time{}); len(stored) != 1 || stored[0].Trades != 1 {
+		t.Errorf("Expected one stored 1m candle, got %+v", stored)
+	}
+}
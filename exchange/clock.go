@@ -0,0 +1,147 @@
+package exchange
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of time of the exchange. Components use the real clock unless
+// another one is set, such as a SimulatedClock for deterministic replays.
+type Clock interface {
+	Now() time.Time
+	// NewTicker returns a ticker that delivers the time on its channel every d
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks of a Clock
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// RealClock is the wall clock
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t realTicker) Stop() {
+	t.ticker.Stop()
+}
+
+// SimulatedClock is a clock that only moves when it is set or advanced, which makes
+// it the clock of tests as well as of replays. Its tickers tick as time passes them;
+// like those of the real clock they drop ticks a slow receiver has not taken.
+type SimulatedClock struct {
+	now     time.Time
+	tickers []*simulatedTicker
+	mutex   sync.Mutex
+	// changed is signalled whenever a ticker is created
+	changed *sync.Cond
+}
+
+// NewSimulatedClock creates a simulated clock showing the given time
+func NewSimulatedClock(start time.Time) *SimulatedClock {
+	clock := &SimulatedClock{now: start}
+	clock.changed = sync.NewCond(&clock.mutex)
+	return clock
+}
+
+// Now returns the simulated time
+func (clock *SimulatedClock) Now() time.Time {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	return clock.now
+}
+
+// Set moves the clock forward to t, ticking every ticker due on the way.
+// Times before the current time leave the clock where it is.
+func (clock *SimulatedClock) Set(t time.Time) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	if !t.After(clock.now) {
+		return
+	}
+	clock.now = t
+	for _, ticker := range clock.tickers {
+		for !ticker.next.After(t) {
+			select {
+			case ticker.channel <- ticker.next:
+			default:
+			}
+			ticker.next = ticker.next.Add(ticker.period)
+		}
+	}
+}
+
+// Advance moves the clock forward by d
+func (clock *SimulatedClock) Advance(d time.Duration) {
+	clock.Set(clock.Now().Add(d))
+}
+
+// WaitForTickers blocks until at least n tickers are running, so a test can advance
+// the clock once a goroutine it started is waiting for its ticks.
+func (clock *SimulatedClock) WaitForTickers(n int) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	for len(clock.tickers) < n {
+		clock.changed.Wait()
+	}
+}
+
+// NewTicker returns a ticker that ticks every d of simulated time
+func (clock *SimulatedClock) NewTicker(d time.Duration) Ticker {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	ticker := &simulatedTicker{
+		clock:   clock,
+		channel: make(chan time.Time, 1),
+		period:  d,
+		next:    clock.now.Add(d),
+	}
+	clock.tickers = append(clock.tickers, ticker)
+	clock.changed.Broadcast()
+	return ticker
+}
+
+type simulatedTicker struct {
+	clock   *SimulatedClock
+	channel chan time.Time
+	period  time.Duration
+	next    time.Time
+}
+
+func (ticker *simulatedTicker) C() <-chan time.Time {
+	return ticker.channel
+}
+
+func (ticker *simulatedTicker) Stop() {
+	ticker.clock.mutex.Lock()
+	defer ticker.clock.mutex.Unlock()
+
+	for i, t := range ticker.clock.tickers {
+		if t == ticker {
+			ticker.clock.tickers = append(ticker.clock.tickers[:i], ticker.clock.tickers[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package exchange
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSimulatedClock(t *testing.T) {
+	start := time.Date(2025, 4, 27, 15, 0, 0, 0, time.UTC)
+	clock := NewSimulatedClock(start)
+	ticker := clock.NewTicker(time.Second)
+
+	ticks := func() []time.Time {
+		received := make([]time.Time, 0)
+		for {
+			select {
+			case tick := <-ticker.C():
+				received = append(received, tick)
+			default:
+				return received
+			}
+		}
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	if got := ticks(); len(got) != 0 {
+		t.Errorf("Expected no tick before a second has passed, got %v", got)
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	if got := ticks(); len(got) != 1 || !got[0].Equal(start.Add(time.Second)) {
+		t.Errorf("Expected a tick at %v, got %v", start.Add(time.Second), got)
+	}
+
+	// Ticks a receiver has not taken are dropped, as with a real ticker
+	clock.Advance(3 * time.Second)
+	if got := ticks(); len(got) != 1 || !got[0].Equal(start.Add(2*time.Second)) {
+		t.Errorf("Expected only the first missed tick, got %v", got)
+	}
+
+	// The clock never moves backwards
+	clock.Set(start)
+	if !clock.Now().Equal(start.Add(4 * time.Second)) {
+		t.Errorf("Expected the clock to stay at %v, got %v", start.Add(4*time.Second), clock.Now())
+	}
+
+	ticker.Stop()
+	clock.Advance(time.Minute)
+	if got := ticks(); len(got) != 0 {
+		t.Errorf("Expected a stopped ticker not to tick, got %v", got)
+	}
+}
+
+func TestExchangeClock(t *testing.T) {
+	start := time.Date(2025, 4, 27, 15, 0, 0, 0, time.UTC)
+	clock := NewSimulatedClock(start)
+	exch := NewExchange(100)
+	exch.SetClock(clock)
+
+	exch.Submit(NewTransactionWithQuantity(SellTransactionType, 101, 5))
+	clock.Advance(time.Second)
+	report, _ := exch.Submit(Transaction{Type: BuyTransactionType, Amount: 101, Quantity: 2})
+
+	// IDs generated on a simulated clock only depend on its time
+	if expected := fmt.Sprintf("BUY-%d", start.Add(time.Second).UnixNano()); report.OrderID != expected {
+		t.Errorf("Expected order ID %s, got %s", expected, report.OrderID)
+	}
+	if trades := exch.GetTrades(0); len(trades) != 1 || !trades[0].Timestamp.Equal(start.Add(time.Second)) {
+		t.Errorf("Expected a trade at %v, got %+v", start.Add(time.Second), trades)
+	}
+	if book := exch.GetOrderBook(); !book.Timestamp.Equal(start.Add(time.Second)) {
+		t.Errorf("Expected the book stamped %v, got %v", start.Add(time.Second), book.Timestamp)
+	}
+}
@@ -9,6 +9,8 @@ type ConcurrentTxnBST struct {
 	tree     TxnBST
 	rwLock   sync.RWMutex
 	nodePool *NodePool
+	// bidOrdering keeps later sequence numbers first among equal prices
+	bidOrdering bool
 }
 
 // NewConcurrentTxnBST creates a new concurrent transaction binary search tree
@@ -19,6 +21,33 @@ func NewConcurrentTxnBST() *ConcurrentTxnBST {
 	}
 }
 
+// newBidTxnBST creates a tree for resting buy orders. Orders at the same price
+// are kept newest first so that walking the tree from the highest price down
+// visits them in price-time priority.
+func newBidTxnBST() *ConcurrentTxnBST {
+	bst := NewConcurrentTxnBST()
+	bst.bidOrdering = true
+	return bst
+}
+
+// compare orders transactions by price and then by sequence number.
+// Returns a negative number if a sorts before b, positive if after and 0 on a tie.
+func (ct *ConcurrentTxnBST) compare(a, b Transaction) int {
+	if a.Amount != b.Amount {
+		if a.Amount < b.Amount {
+			return -1
+		}
+		return 1
+	}
+	if a.Seq == b.Seq {
+		return 0
+	}
+	if (a.Seq < b.Seq) != ct.bidOrdering {
+		return -1
+	}
+	return 1
+}
+
 // Insert adds a transaction to the tree in a thread-safe manner
 func (ct *ConcurrentTxnBST) Insert(value Transaction) {
 	ct.rwLock.Lock()
@@ -37,7 +66,7 @@ func (ct *ConcurrentTxnBST) insertNodeWithPool(node *treeNode, value Transaction
 		return newNode
 	}
 
-	if value.Amount <= node.Value.Amount {
+	if ct.compare(value, node.Value) <= 0 {
 		node.Left = ct.insertNodeWithPool(node.Left, value)
 	} else {
 		node.Right = ct.insertNodeWithPool(node.Right, value)
@@ -50,23 +79,23 @@ func (ct *ConcurrentTxnBST) insertNodeWithPool(node *treeNode, value Transaction
 	balance := node.balanceFactor()
 
 	// Left-Left Case
-	if balance > 1 && value.Amount <= node.Left.Value.Amount {
+	if balance > 1 && ct.compare(value, node.Left.Value) <= 0 {
 		return rotateRight(node)
 	}
 
 	// Right-Right Case
-	if balance < -1 && value.Amount > node.Right.Value.Amount {
+	if balance < -1 && ct.compare(value, node.Right.Value) > 0 {
 		return rotateLeft(node)
 	}
 
 	// Left-Right Case
-	if balance > 1 && value.Amount > node.Left.Value.Amount {
+	if balance > 1 && ct.compare(value, node.Left.Value) > 0 {
 		node.Left = rotateLeft(node.Left)
 		return rotateRight(node)
 	}
 
 	// Right-Left Case
-	if balance < -1 && value.Amount <= node.Right.Value.Amount {
+	if balance < -1 && ct.compare(value, node.Right.Value) <= 0 {
 		node.Right = rotateRight(node.Right)
 		return rotateLeft(node)
 	}
@@ -93,6 +122,40 @@ func (ct *ConcurrentTxnBST) InorderTraversal() []Transaction {
 	return result
 }
 
+// Ascend calls fn for each transaction from the lowest to the highest ordered one
+// until fn returns false
+func (ct *ConcurrentTxnBST) Ascend(fn func(Transaction) bool) {
+	ct.rwLock.RLock()
+	defer ct.rwLock.RUnlock()
+
+	ascend(ct.tree.Root, fn)
+}
+
+// ascend walks the subtree in order and returns false once fn asks to stop
+func ascend(node *treeNode, fn func(Transaction) bool) bool {
+	if node == nil {
+		return true
+	}
+	return ascend(node.Left, fn) && fn(node.Value) && ascend(node.Right, fn)
+}
+
+// Descend calls fn for each transaction from the highest to the lowest ordered one
+// until fn returns false
+func (ct *ConcurrentTxnBST) Descend(fn func(Transaction) bool) {
+	ct.rwLock.RLock()
+	defer ct.rwLock.RUnlock()
+
+	descend(ct.tree.Root, fn)
+}
+
+// descend walks the subtree in reverse order and returns false once fn asks to stop
+func descend(node *treeNode, fn func(Transaction) bool) bool {
+	if node == nil {
+		return true
+	}
+	return descend(node.Right, fn) && fn(node.Value) && descend(node.Left, fn)
+}
+
 // Remove removes a transaction from the tree in a thread-safe manner
 func (ct *ConcurrentTxnBST) Remove(value Transaction) {
 	ct.rwLock.Lock()
@@ -115,19 +178,24 @@ func (ct *ConcurrentTxnBST) removeNodeWithRecycling(node *treeNode, value Transa
 	}
 
 	// Standard BST deletion
-	if value.Amount < node.Value.Amount {
+	cmp := ct.compare(value, node.Value)
+	if cmp < 0 {
 		// Value is in the left subtree.
 		node.Left = ct.removeNodeWithRecycling(node.Left, value, nodesToRecycle)
-	} else if value.Amount > node.Value.Amount {
+	} else if cmp > 0 {
 		// Value is in the right subtree.
 		node.Right = ct.removeNodeWithRecycling(node.Right, value, nodesToRecycle)
 	} else {
 		// Node to be deleted found.
-		// Check if it's the exact transaction (by ID) or just same amount
+		// Check if it's the exact transaction (by ID) or just same price and sequence
 		if node.Value.ID != value.ID {
-			// If IDs don't match, look for the exact transaction in the right subtree
-			// (since we might have multiple transactions with the same amount)
-			node.Right = ct.removeNodeWithRecycling(node.Right, value, nodesToRecycle)
+			// If IDs don't match, the exact transaction may sit on either side
+			// since ties are inserted to the left and rotations can move them
+			recycled := len(*nodesToRecycle)
+			node.Left = ct.removeNodeWithRecycling(node.Left, value, nodesToRecycle)
+			if len(*nodesToRecycle) == recycled {
+				node.Right = ct.removeNodeWithRecycling(node.Right, value, nodesToRecycle)
+			}
 		} else {
 			// This is the exact transaction to remove
 			if node.Left == nil && node.Right == nil {
@@ -192,6 +260,68 @@ func (ct *ConcurrentTxnBST) removeNodeWithRecycling(node *treeNode, value Transa
 	return node
 }
 
+// Update replaces a transaction in place, keeping its position in the tree.
+// The price and sequence number must be unchanged. Returns false if the
+// transaction is not in the tree.
+func (ct *ConcurrentTxnBST) Update(value Transaction) bool {
+	ct.rwLock.Lock()
+	defer ct.rwLock.Unlock()
+
+	node := ct.findNode(ct.tree.Root, value)
+	if node == nil {
+		return false
+	}
+	node.Value = value
+	return true
+}
+
+// findNode returns the node holding the exact transaction (by ID) in the subtree
+func (ct *ConcurrentTxnBST) findNode(node *treeNode, value Transaction) *treeNode {
+	for node != nil {
+		cmp := ct.compare(value, node.Value)
+		if cmp < 0 {
+			node = node.Left
+		} else if cmp > 0 {
+			node = node.Right
+		} else if node.Value.ID == value.ID {
+			return node
+		} else {
+			// Ties may sit on either side of the node
+			if found := ct.findNode(node.Left, value); found != nil {
+				return found
+			}
+			node = node.Right
+		}
+	}
+	return nil
+}
+
+// Min returns the lowest ordered transaction in the tree
+func (ct *ConcurrentTxnBST) Min() (Transaction, bool) {
+	ct.rwLock.RLock()
+	defer ct.rwLock.RUnlock()
+
+	if ct.tree.Root == nil {
+		return Transaction{}, false
+	}
+	return findMinValue(ct.tree.Root), true
+}
+
+// Max returns the highest ordered transaction in the tree
+func (ct *ConcurrentTxnBST) Max() (Transaction, bool) {
+	ct.rwLock.RLock()
+	defer ct.rwLock.RUnlock()
+
+	current := ct.tree.Root
+	if current == nil {
+		return Transaction{}, false
+	}
+	for current.Right != nil {
+		current = current.Right
+	}
+	return current.Value, true
+}
+
 // GetStats returns statistics about the node pool
 func (ct *ConcurrentTxnBST) GetStats() (allocated, recycled int64) {
 	return ct.nodePool.Stats()
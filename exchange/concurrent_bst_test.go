@@ -1,6 +1,7 @@
 package exchange
 
 import (
+	"fmt"
 	"sync"
 	"testing"
 	"time"
@@ -226,3 +227,117 @@ func TestConcurrentTxnBST(t *testing.T) {
 		t.Logf("Memory stats: allocated=%d, recycled=%d", allocated, recycled)
 	})
 }
+
+func TestConcurrentTxnBSTPriceTimeOrdering(t *testing.T) {
+	newTxn := func(price TransactionAmtDataType, seq uint64) Transaction {
+		txn := NewTransaction(SellTransactionType, price)
+		txn.Seq = seq
+		return txn
+	}
+
+	t.Run("Ask Ordering", func(t *testing.T) {
+		bst := NewConcurrentTxnBST()
+		bst.Insert(newTxn(100, 2))
+		bst.Insert(newTxn(100, 1))
+		bst.Insert(newTxn(105, 3))
+
+		best, ok := bst.Min()
+		if !ok || best.Amount != 100 || best.Seq != 1 {
+			t.Errorf("Expected best ask at 100 with seq 1, got price %d seq %d", best.Amount, best.Seq)
+		}
+	})
+
+	t.Run("Bid Ordering", func(t *testing.T) {
+		bst := newBidTxnBST()
+		bst.Insert(newTxn(100, 1))
+		bst.Insert(newTxn(100, 2))
+		bst.Insert(newTxn(95, 3))
+
+		best, ok := bst.Max()
+		if !ok || best.Amount != 100 || best.Seq != 1 {
+			t.Errorf("Expected best bid at 100 with seq 1, got price %d seq %d", best.Amount, best.Seq)
+		}
+	})
+
+	t.Run("Empty Tree", func(t *testing.T) {
+		bst := NewConcurrentTxnBST()
+		if _, ok := bst.Min(); ok {
+			t.Errorf("Expected Min on an empty tree to report no transaction")
+		}
+		if _, ok := bst.Max(); ok {
+			t.Errorf("Expected Max on an empty tree to report no transaction")
+		}
+	})
+
+	t.Run("Remove Duplicate Keys", func(t *testing.T) {
+		bst := NewConcurrentTxnBST()
+		txns := make([]Transaction, 0, 20)
+		for i := 0; i < 20; i++ {
+			txn := NewTransaction(SellTransactionType, 100)
+			txn.ID = fmt.Sprintf("SELL-%d", i)
+			txns = append(txns, txn)
+			bst.Insert(txn)
+		}
+
+		for _, txn := range txns {
+			bst.Remove(txn)
+		}
+
+		if result := bst.InorderTraversal(); len(result) != 0 {
+			t.Errorf("Expected all duplicate-price transactions to be removed, %d remain", len(result))
+		}
+	})
+}
+
+func TestConcurrentTxnBSTUpdate(t *testing.T) {
+	bst := NewConcurrentTxnBST()
+
+	txn := NewTransactionWithQuantity(SellTransactionType, 100, 10)
+	txn.Seq = 1
+	bst.Insert(txn)
+	other := NewTransactionWithQuantity(SellTransactionType, 100, 10)
+	other.Seq = 2
+	bst.Insert(other)
+
+	txn.Filled = 4
+	if !bst.Update(txn) {
+		t.Fatalf("Expected Update to find the transaction")
+	}
+
+	best, _ := bst.Min()
+	if best.ID != txn.ID || best.Remaining() != 6 {
+		t.Errorf("Expected updated transaction to keep its position with 6 remaining, got %s with %d",
+			best.ID, best.Remaining())
+	}
+
+	missing := NewTransaction(SellTransactionType, 100)
+	if bst.Update(missing) {
+		t.Errorf("Expected Update of a missing transaction to return false")
+	}
+}
+
+func TestConcurrentTxnBSTWalk(t *testing.T) {
+	bst := NewConcurrentTxnBST()
+	for _, price := range []TransactionAmtDataType{30, 10, 50, 20, 40} {
+		bst.Insert(NewTransaction(SellTransactionType, price))
+	}
+
+	collect := func(walk func(func(Transaction) bool), limit int) []TransactionAmtDataType {
+		prices := []TransactionAmtDataType{}
+		walk(func(txn Transaction) bool {
+			prices = append(prices, txn.Amount)
+			return len(prices) < limit
+		})
+		return prices
+	}
+
+	ascending := collect(bst.Ascend, 3)
+	if len(ascending) != 3 || ascending[0] != 10 || ascending[1] != 20 || ascending[2] != 30 {
+		t.Errorf("Expected ascending walk to stop after [10 20 30], got %v", ascending)
+	}
+
+	descending := collect(bst.Descend, 10)
+	if len(descending) != 5 || descending[0] != 50 || descending[4] != 10 {
+		t.Errorf("Expected descending walk [50 40 30 20 10], got %v", descending)
+	}
+}
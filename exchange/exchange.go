@@ -1,22 +1,85 @@
 package exchange
 
 import (
+	"errors"
 	"fmt"
-	"sort"
 	"sync"
 	"time"
 )
 
+// MatchingMode controls when the exchange matches crossing orders
+type MatchingMode int
+
+const (
+	// ContinuousMatching matches every order against the opposite book as soon as it is accepted
+	ContinuousMatching MatchingMode = iota
+	// BatchMatching rests every order and matches the books once a second in ProcessTrades
+	BatchMatching
+)
+
+var (
+	// ErrOrderNotFound is returned when an order is not resting in the book
+	ErrOrderNotFound = errors.New("order not found")
+	// ErrInvalidPrice is returned when an amendment sets a price below 1
+	ErrInvalidPrice = errors.New("price must be at least 1")
+	// ErrInvalidQuantity is returned when an amendment does not leave any quantity to fill
+	ErrInvalidQuantity = errors.New("quantity must be greater than the filled quantity")
+	// ErrExchangeHalted is returned once a trade could not be journaled. The journal
+	// no longer matches the books, so the exchange refuses every later change.
+	ErrExchangeHalted = errors.New("exchange halted")
+)
+
 type Exchange struct {
+	// Symbol is the instrument traded on this exchange
+	Symbol          string
 	IncomingTrades  chan Transaction
 	LastTradedPrice TransactionAmtDataType
 	BuyQ            *ConcurrentTxnBST
 	SellQ           *ConcurrentTxnBST
-	// Callbacks for price updates
+	// Callbacks for price updates, order reports and trades
 	priceUpdateCallbacks []func(int)
+	orderReportCallbacks []func(OrderReport)
+	tradeCallbacks       []func(Trade)
+	bookUpdateCallbacks  []func(BookUpdate)
+	candleCallbacks      []func(Candle)
 	callbacksLock        sync.Mutex
+	// matchLock serializes every change to the books
+	matchLock    sync.Mutex
+	matchingMode MatchingMode
+	nextSeq      uint64
+	// orders indexes resting orders by ID so they can be found without walking the books
+	orders map[string]Transaction
+	// tradeTape keeps the most recent executions
+	tradeTape    *TradeTape
+	nextTradeSeq uint64
+	// accounts tracks the cash and positions of the owners of orders, if set
+	accounts *AccountManager
+	// riskChecks run in order on every order before it is matched or rests
+	riskChecks []RiskCheck
+	// levels aggregates both books by price for the level 2 feed
+	levels *bookLevels
+	// candles aggregates the trades into candles of every interval
+	candles *CandleAggregator
+	// journal records every accepted order, cancel, amendment and trade, if set
+	journal *Journal
+	// halted is set, wrapping ErrExchangeHalted, when a trade could not be journaled
+	halted error
+	// replaying is set while the journal is replayed. Executions are then held in
+	// replayed until they are checked against the journaled trades.
+	replaying bool
+	replayed  []Trade
+	// clock stamps trades and book data and drives batch matching
+	clock Clock
+	// lastID is the timestamp of the last ID generated by the exchange. Exchanges on
+	// the real clock share one with NewTransaction so their IDs never collide.
+	lastID *int64
+	// onTrade is called under matchLock for every trade, in execution order
+	onTrade func(Trade)
 }
 
+// tradeTapeSize is the number of recent trades kept by the exchange
+const tradeTapeSize = 1000
+
 // NewExchange creates and returns a new exchange with the specified initial Last Traded Price
 // If the provided LTP is less than 1, it will be set to 1 (minimum valid price)
 func NewExchange(ltp TransactionAmtDataType) Exchange {
@@ -26,23 +89,99 @@ func NewExchange(ltp TransactionAmtDataType) Exchange {
 	}
 
 	return Exchange{
+		Symbol:               DefaultSymbol,
 		IncomingTrades:       make(chan Transaction),
 		LastTradedPrice:      ltp,
-		BuyQ:                 NewConcurrentTxnBST(),
+		BuyQ:                 newBidTxnBST(),
 		SellQ:                NewConcurrentTxnBST(),
 		priceUpdateCallbacks: make([]func(int), 0),
+		orderReportCallbacks: make([]func(OrderReport), 0),
+		orders:               make(map[string]Transaction),
+		tradeCallbacks:       make([]func(Trade), 0),
+		tradeTape:            NewTradeTape(tradeTapeSize),
+		levels:               newBookLevels(),
+		candles:              NewCandleAggregator(),
+		clock:                RealClock,
+		lastID:               &lastIDTimestamp,
+	}
+}
+
+// SetMatchingMode selects continuous or batch matching.
+// It must be called before AcceptTrades and ProcessTrades are started.
+func (exch *Exchange) SetMatchingMode(mode MatchingMode) {
+	exch.matchingMode = mode
+}
+
+// SetClock sets the clock that stamps trades, book data and log messages and drives
+// batch matching.
+// IDs generated on another clock than the real one only depend on that clock, so a
+// replay on a SimulatedClock generates the same IDs every time. It must be called
+// before AcceptTrades and ProcessTrades are started.
+func (exch *Exchange) SetClock(clock Clock) {
+	exch.clock = clock
+	if clock != RealClock {
+		exch.lastID = new(int64)
 	}
 }
 
+// Clock returns the clock of the exchange
+func (exch *Exchange) Clock() Clock {
+	return exch.clock
+}
+
+// newLogger creates a logger whose messages are stamped by the exchange's clock
+func (exch *Exchange) newLogger(component string) *Logger {
+	logger := NewLogger(component)
+	logger.SetClock(exch.clock)
+	return logger
+}
+
+// SetAccounts attaches the accounts updated by this exchange's orders and fills.
+// It must be called before AcceptTrades is started.
+func (exch *Exchange) SetAccounts(accounts *AccountManager) {
+	exch.accounts = accounts
+}
+
+// SetJournal attaches the journal that accepted orders, cancels, amendments and trades
+// are written to before they change the book. It must be called before AcceptTrades is started.
+func (exch *Exchange) SetJournal(journal *Journal) {
+	exch.journal = journal
+}
+
+// journalEvent writes an event of this exchange to the journal, if there is one.
+// The caller must hold matchLock so events are journaled in the order they are applied.
+func (exch *Exchange) journalEvent(event JournalEvent) error {
+	if exch.journal == nil {
+		return nil
+	}
+	event.Symbol = exch.Symbol
+	_, err := exch.journal.Append(event)
+	return err
+}
+
+// Accounts returns the accounts attached to the exchange, or nil if orders are anonymous
+func (exch *Exchange) Accounts() *AccountManager {
+	return exch.accounts
+}
+
+// AddRiskCheck appends a pre-trade check to the chain every order must pass before
+// it is matched or rests in the book. It must be called before AcceptTrades is started.
+func (exch *Exchange) AddRiskCheck(check RiskCheck) {
+	exch.riskChecks = append(exch.riskChecks, check)
+}
+
 // OrderBookEntry represents an entry in the order book
 type OrderBookEntry struct {
-	ID     string `json:"id"`
-	Price  int    `json:"price"`
-	Type   string `json:"type"`
+	ID    string `json:"id"`
+	Price int    `json:"price"`
+	Type  string `json:"type"`
+	// Quantity is the unfilled quantity still resting in the book
+	Quantity int `json:"quantity"`
 }
 
 // OrderBook represents the current state of the order book
 type OrderBook struct {
+	Symbol     string           `json:"symbol"`
 	BuyOrders  []OrderBookEntry `json:"buyOrders"`
 	SellOrders []OrderBookEntry `json:"sellOrders"`
 	Timestamp  time.Time        `json:"timestamp"`
@@ -66,6 +205,131 @@ func (exch *Exchange) notifyPriceUpdate(price int) {
 	}
 }
 
+// RegisterOrderReportCallback registers a callback function that will be called with the
+// outcome of every order the exchange processes
+func (exch *Exchange) RegisterOrderReportCallback(callback func(OrderReport)) {
+	exch.callbacksLock.Lock()
+	defer exch.callbacksLock.Unlock()
+
+	exch.orderReportCallbacks = append(exch.orderReportCallbacks, callback)
+}
+
+// notifyOrderReport notifies all registered callbacks about a processed order
+func (exch *Exchange) notifyOrderReport(report OrderReport) {
+	exch.callbacksLock.Lock()
+	defer exch.callbacksLock.Unlock()
+
+	for _, callback := range exch.orderReportCallbacks {
+		go callback(report)
+	}
+}
+
+// RegisterTradeCallback registers a callback function that will be called for every trade
+func (exch *Exchange) RegisterTradeCallback(callback func(Trade)) {
+	exch.callbacksLock.Lock()
+	defer exch.callbacksLock.Unlock()
+
+	exch.tradeCallbacks = append(exch.tradeCallbacks, callback)
+}
+
+// notifyTrade notifies all registered callbacks about a trade
+func (exch *Exchange) notifyTrade(trade Trade) {
+	exch.callbacksLock.Lock()
+	defer exch.callbacksLock.Unlock()
+
+	for _, callback := range exch.tradeCallbacks {
+		go callback(trade)
+	}
+}
+
+// RegisterBookUpdateCallback registers a callback function that will be called with the
+// price levels changed by every operation on the book. Unlike the other callbacks it is
+// called synchronously, in sequence order, while the book is locked, so it must return
+// quickly and must not call back into the exchange.
+func (exch *Exchange) RegisterBookUpdateCallback(callback func(BookUpdate)) {
+	exch.callbacksLock.Lock()
+	defer exch.callbacksLock.Unlock()
+
+	exch.bookUpdateCallbacks = append(exch.bookUpdateCallbacks, callback)
+}
+
+// publishBookUpdate notifies all registered callbacks about the price levels changed
+// since the last update, if any. The caller must hold matchLock.
+func (exch *Exchange) publishBookUpdate() {
+	update, ok := exch.levels.flush(exch.Symbol, exch.clock.Now())
+	if !ok {
+		return
+	}
+
+	exch.callbacksLock.Lock()
+	defer exch.callbacksLock.Unlock()
+
+	for _, callback := range exch.bookUpdateCallbacks {
+		callback(update)
+	}
+}
+
+// GetBookSnapshot returns every price level of the book together with the sequence
+// number of the last book update it includes
+func (exch *Exchange) GetBookSnapshot() BookSnapshot {
+	exch.matchLock.Lock()
+	defer exch.matchLock.Unlock()
+
+	return exch.levels.snapshot(exch.Symbol, exch.clock.Now())
+}
+
+// BookSequence returns the sequence number of the last book update
+func (exch *Exchange) BookSequence() uint64 {
+	exch.matchLock.Lock()
+	defer exch.matchLock.Unlock()
+
+	return exch.levels.sequence
+}
+
+// RegisterCandleCallback registers a callback function that will be called with the
+// candle of every interval updated by a trade. Like book update callbacks it is called
+// synchronously, in trade order, so it must return quickly and must not call back
+// into the exchange.
+func (exch *Exchange) RegisterCandleCallback(callback func(Candle)) {
+	exch.callbacksLock.Lock()
+	defer exch.callbacksLock.Unlock()
+
+	exch.candleCallbacks = append(exch.candleCallbacks, callback)
+}
+
+// notifyCandles notifies all registered callbacks about updated candles
+func (exch *Exchange) notifyCandles(candles []Candle) {
+	exch.callbacksLock.Lock()
+	defer exch.callbacksLock.Unlock()
+
+	for _, candle := range candles {
+		for _, callback := range exch.candleCallbacks {
+			callback(candle)
+		}
+	}
+}
+
+// GetCandles returns the candles of an interval starting in the range from, to.
+// A zero from or to leaves that end of the range open.
+func (exch *Exchange) GetCandles(interval CandleInterval, from, to time.Time) []Candle {
+	return exch.candles.Candles(interval, from, to)
+}
+
+// LTP returns the Last Traded Price. Unlike reading the LastTradedPrice field, it is
+// safe while orders are being matched.
+func (exch *Exchange) LTP() TransactionAmtDataType {
+	exch.matchLock.Lock()
+	defer exch.matchLock.Unlock()
+
+	return exch.LastTradedPrice
+}
+
+// GetTrades returns up to limit of the most recent trades, oldest first.
+// A limit of zero or less returns every trade on the tape.
+func (exch *Exchange) GetTrades(limit int) []Trade {
+	return exch.tradeTape.Recent(limit)
+}
+
 // GetMemoryStats returns memory usage statistics for the order books
 func (exch *Exchange) GetMemoryStats() map[string]int64 {
 	buyAllocated, buyRecycled := exch.BuyQ.GetStats()
@@ -82,147 +346,624 @@ func (exch *Exchange) GetMemoryStats() map[string]int64 {
 	}
 }
 
-// GetOrderBook returns the current state of the order book
+// orderBookSize is the number of orders of each side returned by GetOrderBook
+const orderBookSize = 10
+
+// GetOrderBook returns the best orders of each side of the book in priority order.
+// Use GetDepth for the quantity resting at each price.
 func (exch *Exchange) GetOrderBook() OrderBook {
-	// Get all buy orders - ConcurrentTxnBST handles locking internally
-	buyOrders := exch.BuyQ.InorderTraversal()
-	buyEntries := make([]OrderBookEntry, 0, len(buyOrders))
-	for _, order := range buyOrders {
-		buyEntries = append(buyEntries, OrderBookEntry{
-			ID:    order.ID,
-			Price: int(order.Amount),
-			Type:  order.Type,
-		})
+	return OrderBook{
+		Symbol:     exch.Symbol,
+		BuyOrders:  orderEntries(exch.BuyQ.Descend, orderBookSize),
+		SellOrders: orderEntries(exch.SellQ.Ascend, orderBookSize),
+		Timestamp:  exch.clock.Now(),
 	}
+}
 
-	// Sort buy orders by price (highest first)
-	sort.Slice(buyEntries, func(i, j int) bool {
-		return buyEntries[i].Price > buyEntries[j].Price
+// orderEntries walks a book from its best order and returns up to limit entries
+func orderEntries(walk func(func(Transaction) bool), limit int) []OrderBookEntry {
+	entries := make([]OrderBookEntry, 0, limit)
+	walk(func(order Transaction) bool {
+		entries = append(entries, OrderBookEntry{
+			ID:       order.ID,
+			Price:    int(order.Amount),
+			Type:     order.Type,
+			Quantity: int(order.Remaining()),
+		})
+		return len(entries) < limit
 	})
+	return entries
+}
 
-	// Get all sell orders - ConcurrentTxnBST handles locking internally
-	sellOrders := exch.SellQ.InorderTraversal()
-	sellEntries := make([]OrderBookEntry, 0, len(sellOrders))
-	for _, order := range sellOrders {
-		sellEntries = append(sellEntries, OrderBookEntry{
-			ID:    order.ID,
-			Price: int(order.Amount),
-			Type:  order.Type,
-		})
+// GetDepth returns the total quantity and number of orders at the best depth price
+// levels of each side of the book. A depth of zero or less returns every level.
+func (exch *Exchange) GetDepth(depth int) Depth {
+	exch.matchLock.Lock()
+	defer exch.matchLock.Unlock()
+
+	return Depth{
+		Symbol:    exch.Symbol,
+		Bids:      aggregateLevels(exch.BuyQ.Descend, depth),
+		Asks:      aggregateLevels(exch.SellQ.Ascend, depth),
+		Timestamp: exch.clock.Now(),
 	}
+}
 
-	// Sort sell orders by price (lowest first)
-	sort.Slice(sellEntries, func(i, j int) bool {
-		return sellEntries[i].Price < sellEntries[j].Price
-	})
+// Submit processes an order synchronously and returns its report. Orders refused
+// by validation or the risk checks are reported as rejected and a *Rejection is
+// returned as the error. An order without an ID is given one. Unlike orders sent
+// to IncomingTrades, submitted orders do not need AcceptTrades to be running.
+func (exch *Exchange) Submit(txn Transaction) (OrderReport, error) {
+	report, err := exch.accept(txn, exch.newLogger("Submit"))
+	exch.notifyOrderReport(report)
 
-	// Limit to top 10 orders on each side for UI display
-	if len(buyEntries) > 10 {
-		buyEntries = buyEntries[:10]
+	if err != nil {
+		return report, err
 	}
-	if len(sellEntries) > 10 {
-		sellEntries = sellEntries[:10]
-	}
-
-	return OrderBook{
-		BuyOrders:  buyEntries,
-		SellOrders: sellEntries,
-		Timestamp:  time.Now(),
+	if report.Status == OrderStatusRejected {
+		return report, &Rejection{Reason: report.RejectReason, Message: report.Reason}
 	}
+	return report, nil
 }
 
-// AcceptTrades processes incoming trade orders and adds them to the appropriate queue
+// AcceptTrades processes incoming trade orders and, in continuous mode, matches them
+// against the opposite book before resting any remainder in the appropriate queue.
+// The sender does not learn the outcome; use Submit or RegisterOrderReportCallback for that.
 func (exch *Exchange) AcceptTrades() {
-	logger := NewLogger("AcceptTrades")
+	logger := exch.newLogger("AcceptTrades")
 	logger.Info("Starting to accept trades")
 
 	for txn := range exch.IncomingTrades {
-		// Validate transaction price - ensure it's at least 1
-		if txn.Amount < 1 {
-			logger.Warn(fmt.Sprintf("Rejected order %s with invalid price: %d (minimum price is 1)",
-				txn.ID, txn.Amount))
-			continue
+		// A halt is logged when it happens and later orders are rejected
+		report, _ := exch.accept(txn, logger)
+		exch.notifyOrderReport(report)
+	}
+}
+
+// validate rejects orders the exchange cannot process. The caller must hold matchLock.
+func (exch *Exchange) validate(txn Transaction) error {
+	// Validate transaction price - ensure it's at least 1 for priced orders
+	if txn.Amount < 1 && !txn.IsMarket() {
+		return reject(RejectInvalidPrice, "invalid price: %d (minimum price is 1)", txn.Amount)
+	}
+
+	if txn.Remaining() < 1 {
+		return reject(RejectInvalidQuantity, "invalid quantity: %d", txn.Remaining())
+	}
+
+	if txn.Type != BuyTransactionType && txn.Type != SellTransactionType {
+		return reject(RejectInvalidSide, "unknown transaction type: %s", txn.Type)
+	}
+
+	if !isValidOrderType(txn.OrderType) {
+		return reject(RejectInvalidOrderType, "unknown order type: %s", txn.OrderType)
+	}
+
+	if txn.Symbol != "" && NormalizeSymbol(txn.Symbol) != exch.Symbol {
+		return reject(RejectUnknownSymbol, "symbol %s is not traded on the %s exchange", txn.Symbol, exch.Symbol)
+	}
+
+	if txn.AccountID != "" && (exch.accounts == nil || !exch.accounts.Exists(txn.AccountID)) {
+		return reject(RejectUnknownAccount, "unknown account: %s", txn.AccountID)
+	}
+
+	if _, exists := exch.orders[txn.ID]; exists {
+		return reject(RejectDuplicateOrderID, "order %s is already resting", txn.ID)
+	}
+	return nil
+}
+
+// checkRisk runs the order through the risk check chain, stopping at the first
+// rejection. The caller must hold matchLock.
+func (exch *Exchange) checkRisk(txn Transaction) error {
+	ctx := RiskContext{
+		Symbol:          exch.Symbol,
+		LastTradedPrice: exch.LastTradedPrice,
+		Accounts:        exch.accounts,
+		asks:            exch.SellQ.Ascend,
+	}
+	for _, check := range exch.riskChecks {
+		if err := check.Check(txn, ctx); err != nil {
+			return asRejection(err)
 		}
+	}
+	return nil
+}
+
+// lockAccount stops the risk checks of an account order from running concurrently
+// with those of the other instruments sharing the exchange's accounts, until the
+// returned function is called. Cash is shared between instruments, so checking it
+// under matchLock alone would let orders on two of them spend it twice.
+// The caller must hold matchLock.
+func (exch *Exchange) lockAccount(txn Transaction) func() {
+	if txn.AccountID == "" || exch.accounts == nil {
+		return func() {}
+	}
+	exch.accounts.orderLock.Lock()
+	return exch.accounts.orderLock.Unlock
+}
+
+// accept validates the order and runs the risk checks, then assigns it its sequence
+// number and matches or rests it according to the matching mode. Orders that cannot
+// rest are always matched on arrival. The error wraps ErrExchangeHalted if one of
+// the order's trades could not be journaled, in which case the report still shows
+// what was applied, or if the exchange had already halted and rejected the order.
+func (exch *Exchange) accept(txn Transaction, logger *Logger) (OrderReport, error) {
+	exch.matchLock.Lock()
+	defer exch.matchLock.Unlock()
+	defer exch.publishBookUpdate()
+
+	if txn.ID == "" {
+		txn.ID = nextID(exch.clock, exch.lastID, txn.Type)
+	}
+	defer exch.lockAccount(txn)()
+
+	err := exch.halted
+	if err != nil {
+		err = reject(RejectJournal, "%s", err.Error())
+	} else {
+		err = exch.validate(txn)
+	}
+	if err == nil {
+		txn.Symbol = exch.Symbol
+		err = exch.checkRisk(txn)
+	}
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Rejected order %s: %s", txn.ID, err.Error()))
+		report := newRejectedReport(txn, asRejection(err))
+		exch.recordOrder(report)
+		return report, exch.halted
+	}
+
+	exch.nextSeq++
+	txn.Seq = exch.nextSeq
+	txn.Symbol = exch.Symbol
+
+	if err := exch.journalEvent(newOrderEvent(txn)); err != nil {
+		logger.Error(fmt.Sprintf("Rejected order %s: %s", txn.ID, err.Error()))
+		report := newRejectedReport(txn, reject(RejectJournal, "%s", err.Error()))
+		exch.recordOrder(report)
+		return report, nil
+	}
+
+	return exch.place(txn, logger), exch.halted
+}
+
+// place matches or rests an accepted order according to the matching mode and
+// records its report. The caller must hold matchLock.
+func (exch *Exchange) place(txn Transaction, logger *Logger) OrderReport {
+	var report OrderReport
+	if exch.matchingMode == ContinuousMatching || !txn.Rests() {
+		report = exch.matchIncoming(txn, logger)
+	} else {
+		exch.rest(txn, logger)
+		report = newOrderReport(txn, 0)
+	}
+	exch.recordOrder(report)
+	return report
+}
 
-		// ConcurrentTxnBST handles locking internally
+// recordOrder adds a report to the order history of its account.
+// The caller must hold matchLock so reports are recorded in order.
+func (exch *Exchange) recordOrder(report OrderReport) {
+	if exch.accounts != nil {
+		exch.accounts.recordOrder(report)
+	}
+}
+
+// matchIncoming matches an incoming order against the best resting orders on the
+// opposite side until it is filled or nothing crosses. Any remainder of a limit order
+// rests in the book while other order types cancel it. Resting orders set the trade
+// price. The caller must hold matchLock.
+func (exch *Exchange) matchIncoming(txn Transaction, logger *Logger) OrderReport {
+	if txn.OrderType == FillOrKillOrderType && exch.crossingQuantity(txn) < txn.Remaining() {
+		logger.Info(fmt.Sprintf("Killed fill-or-kill order %s, quantity %d is not available",
+			txn.ID, txn.Remaining()))
+		return newOrderReport(txn, txn.Remaining())
+	}
+
+	for txn.Remaining() > 0 {
 		if txn.Type == BuyTransactionType {
-			exch.BuyQ.Insert(txn)
-			logger.Debug(fmt.Sprintf("Accepted buy order: %s, price: %d", txn.ID, txn.Amount))
-		} else if txn.Type == SellTransactionType {
-			exch.SellQ.Insert(txn)
-			logger.Debug(fmt.Sprintf("Accepted sell order: %s, price: %d", txn.ID, txn.Amount))
+			sell, ok := exch.SellQ.Min()
+			if !ok || !txn.crosses(sell) {
+				break
+			}
+			qty := fillQuantity(&txn, &sell)
+			exch.reduce(exch.SellQ, sell, qty)
+			exch.executeTrade(txn, sell, sell.Amount, qty, txn.Type, logger)
+		} else {
+			buy, ok := exch.BuyQ.Max()
+			if !ok || !txn.crosses(buy) {
+				break
+			}
+			qty := fillQuantity(&txn, &buy)
+			exch.reduce(exch.BuyQ, buy, qty)
+			exch.executeTrade(buy, txn, buy.Amount, qty, txn.Type, logger)
+		}
+	}
+
+	if txn.Remaining() == 0 {
+		return newOrderReport(txn, 0)
+	}
+
+	if !txn.Rests() {
+		logger.Info(fmt.Sprintf("Cancelled unfilled quantity %d of %s order %s",
+			txn.Remaining(), txn.OrderType, txn.ID))
+		return newOrderReport(txn, txn.Remaining())
+	}
+
+	exch.rest(txn, logger)
+	return newOrderReport(txn, 0)
+}
+
+// crossingQuantity returns how much of the order could be filled by the opposite book,
+// stopping as soon as the order's remaining quantity is covered
+func (exch *Exchange) crossingQuantity(txn Transaction) TransactionQtyDataType {
+	var available TransactionQtyDataType
+	visit := func(resting Transaction) bool {
+		if !txn.crosses(resting) {
+			return false
+		}
+		available += resting.Remaining()
+		return available < txn.Remaining()
+	}
+
+	if txn.Type == BuyTransactionType {
+		exch.SellQ.Ascend(visit)
+	} else {
+		exch.BuyQ.Descend(visit)
+	}
+	return available
+}
+
+// newRejectedReport describes an order refused before it reached the book
+func newRejectedReport(txn Transaction, rejection *Rejection) OrderReport {
+	report := newOrderReport(txn, txn.Remaining())
+	report.Status = OrderStatusRejected
+	report.RejectReason = rejection.Reason
+	report.Reason = rejection.Message
+	return report
+}
+
+// newOrderReport describes an order after matching, with the given quantity cancelled
+func newOrderReport(txn Transaction, cancelled TransactionQtyDataType) OrderReport {
+	status := OrderStatusNew
+	switch {
+	case cancelled > 0:
+		status = OrderStatusCancelled
+	case txn.Remaining() == 0:
+		status = OrderStatusFilled
+	case txn.Filled > 0:
+		status = OrderStatusPartiallyFilled
+	}
+
+	orderType := txn.OrderType
+	if orderType == "" {
+		orderType = LimitOrderType
+	}
+
+	return OrderReport{
+		OrderID:   txn.ID,
+		AccountID: txn.AccountID,
+		Symbol:    txn.Symbol,
+		Type:      txn.Type,
+		OrderType: orderType,
+		Status:    status,
+		Price:     txn.Amount,
+		Quantity:  txn.Quantity,
+		Filled:    txn.Filled,
+		Cancelled: cancelled,
+	}
+}
+
+// fillQuantity fills both orders by the largest quantity they have in common and returns it
+func fillQuantity(a, b *Transaction) TransactionQtyDataType {
+	qty := a.Remaining()
+	if b.Remaining() < qty {
+		qty = b.Remaining()
+	}
+	a.Filled += qty
+	b.Filled += qty
+	return qty
+}
+
+// reduce removes a resting order that has been completely filled, or updates
+// its filled quantity in place so that it keeps its time priority
+func (exch *Exchange) reduce(book *ConcurrentTxnBST, txn Transaction, qty TransactionQtyDataType) {
+	if txn.Remaining() > 0 {
+		book.Update(txn)
+		exch.orders[txn.ID] = txn
+		exch.levels.adjust(txn.Type, txn.Amount, -int64(qty), 0)
+	} else {
+		book.Remove(txn)
+		delete(exch.orders, txn.ID)
+		exch.levels.adjust(txn.Type, txn.Amount, -int64(qty), -1)
+	}
+}
+
+// unrest removes a resting order from its side of the book
+func (exch *Exchange) unrest(txn Transaction) {
+	exch.bookFor(txn).Remove(txn)
+	delete(exch.orders, txn.ID)
+	exch.levels.adjust(txn.Type, txn.Amount, -int64(txn.Remaining()), -1)
+}
+
+// bookFor returns the book that orders of the given side rest in
+func (exch *Exchange) bookFor(txn Transaction) *ConcurrentTxnBST {
+	if txn.Type == BuyTransactionType {
+		return exch.BuyQ
+	}
+	return exch.SellQ
+}
+
+// rest adds an order to its side of the book
+func (exch *Exchange) rest(txn Transaction, logger *Logger) {
+	exch.orders[txn.ID] = txn
+	exch.levels.adjust(txn.Type, txn.Amount, int64(txn.Remaining()), 1)
+
+	// ConcurrentTxnBST handles locking internally
+	if txn.Type == BuyTransactionType {
+		exch.BuyQ.Insert(txn)
+		logger.Debug(fmt.Sprintf("Accepted buy order: %s, price: %d, quantity: %d", txn.ID, txn.Amount, txn.Remaining()))
+	} else {
+		exch.SellQ.Insert(txn)
+		logger.Debug(fmt.Sprintf("Accepted sell order: %s, price: %d, quantity: %d", txn.ID, txn.Amount, txn.Remaining()))
+	}
+}
+
+// CancelOrder removes a resting order from the book and reports the cancelled quantity
+func (exch *Exchange) CancelOrder(id string) (OrderReport, error) {
+	exch.matchLock.Lock()
+	if exch.halted != nil {
+		exch.matchLock.Unlock()
+		return OrderReport{}, exch.halted
+	}
+	txn, ok := exch.orders[id]
+	if !ok {
+		exch.matchLock.Unlock()
+		return OrderReport{}, ErrOrderNotFound
+	}
+	if err := exch.journalEvent(JournalEvent{Type: JournalCancel, OrderID: id}); err != nil {
+		exch.matchLock.Unlock()
+		return OrderReport{}, err
+	}
+
+	exch.unrest(txn)
+	report := newOrderReport(txn, txn.Remaining())
+	exch.recordOrder(report)
+	exch.publishBookUpdate()
+	exch.matchLock.Unlock()
+
+	exch.newLogger("CancelOrder").Info(fmt.Sprintf("Cancelled order %s with remaining quantity %d", id, txn.Remaining()))
+
+	exch.notifyOrderReport(report)
+	return report, nil
+}
+
+// AmendOrder changes the price and total quantity of a resting order. Reducing the
+// quantity at the same price keeps the order's time priority; a price change or a
+// quantity increase moves it to the back of the queue, matching it again first if
+// the new price crosses the book in continuous mode. The amended order must pass
+// the risk checks, otherwise it is left unchanged and the *Rejection is returned.
+func (exch *Exchange) AmendOrder(id string, newPrice TransactionAmtDataType, newQty TransactionQtyDataType) (OrderReport, error) {
+	if newPrice < 1 {
+		return OrderReport{}, ErrInvalidPrice
+	}
+
+	logger := exch.newLogger("AmendOrder")
+
+	exch.matchLock.Lock()
+	if exch.halted != nil {
+		exch.matchLock.Unlock()
+		return OrderReport{}, exch.halted
+	}
+	txn, ok := exch.orders[id]
+	if !ok {
+		exch.matchLock.Unlock()
+		return OrderReport{}, ErrOrderNotFound
+	}
+	if newQty <= txn.Filled {
+		exch.matchLock.Unlock()
+		return OrderReport{}, ErrInvalidQuantity
+	}
+
+	unlockAccount := exch.lockAccount(txn)
+	amended := txn
+	amended.Amount = newPrice
+	amended.Quantity = newQty
+	if err := exch.checkRisk(amended); err != nil {
+		unlockAccount()
+		exch.matchLock.Unlock()
+		logger.Warn(fmt.Sprintf("Rejected amendment of order %s: %s", id, err.Error()))
+		return OrderReport{}, err
+	}
+
+	keepsPriority := newPrice == txn.Amount && newQty <= txn.Quantity
+	event := JournalEvent{Type: JournalAmend, OrderID: id, Price: newPrice, Quantity: newQty}
+	if !keepsPriority {
+		event.OrderSeq = exch.nextSeq + 1
+	}
+	if err := exch.journalEvent(event); err != nil {
+		unlockAccount()
+		exch.matchLock.Unlock()
+		return OrderReport{}, err
+	}
+
+	report := exch.amend(txn, newPrice, newQty, logger)
+	unlockAccount()
+	exch.publishBookUpdate()
+	exch.matchLock.Unlock()
+
+	exch.notifyOrderReport(report)
+	return report, nil
+}
+
+// amend applies a checked amendment to a resting order and records its report.
+// The caller must hold matchLock.
+func (exch *Exchange) amend(txn Transaction, newPrice TransactionAmtDataType, newQty TransactionQtyDataType, logger *Logger) OrderReport {
+	var report OrderReport
+	if newPrice == txn.Amount && newQty <= txn.Quantity {
+		exch.levels.adjust(txn.Type, txn.Amount, int64(newQty)-int64(txn.Quantity), 0)
+		txn.Quantity = newQty
+		exch.bookFor(txn).Update(txn)
+		exch.orders[txn.ID] = txn
+		report = newOrderReport(txn, 0)
+		logger.Info(fmt.Sprintf("Reduced order %s to quantity %d keeping its priority", txn.ID, newQty))
+	} else {
+		exch.unrest(txn)
+
+		txn.Amount = newPrice
+		txn.Quantity = newQty
+		exch.nextSeq++
+		txn.Seq = exch.nextSeq
+		logger.Info(fmt.Sprintf("Amended order %s to price %d and quantity %d", txn.ID, newPrice, newQty))
+
+		if exch.matchingMode == ContinuousMatching {
+			report = exch.matchIncoming(txn, logger)
 		} else {
-			logger.Warn(fmt.Sprintf("Received unknown transaction type: %s", txn.Type))
+			exch.rest(txn, logger)
+			report = newOrderReport(txn, 0)
 		}
 	}
+	exch.recordOrder(report)
+	return report
 }
 
-// ProcessTrades periodically processes trades by matching buy and sell orders
+// GetOrder returns a resting order by ID
+func (exch *Exchange) GetOrder(id string) (Transaction, bool) {
+	exch.matchLock.Lock()
+	defer exch.matchLock.Unlock()
+
+	txn, ok := exch.orders[id]
+	return txn, ok
+}
+
+// executeTrade records a match between a buy and a sell order at the given price and quantity.
+// The aggressor is the side of the order that took liquidity.
+func (exch *Exchange) executeTrade(buy, sell Transaction, tradePrice TransactionAmtDataType, qty TransactionQtyDataType, aggressor string, logger *Logger) {
+	// Ensure the price is never less than 1 (minimum valid price)
+	if tradePrice < 1 {
+		logger.Warn(fmt.Sprintf("Attempted to set LTP to %d, enforcing minimum price of 1", tradePrice))
+		tradePrice = 1
+	}
+	exch.LastTradedPrice = tradePrice
+
+	logger.Info(fmt.Sprintf("[%s] Matched buy order %s (price: %d) with sell order %s (price: %d) for quantity %d",
+		exch.Symbol, buy.ID, buy.Amount, sell.ID, sell.Amount, qty))
+	logger.Info(fmt.Sprintf("[%s] LTP: %d", exch.Symbol, exch.LastTradedPrice))
+
+	exch.nextTradeSeq++
+	trade := Trade{
+		ID:          fmt.Sprintf("TRADE-%d", exch.nextTradeSeq),
+		Symbol:      exch.Symbol,
+		BuyOrderID:  buy.ID,
+		SellOrderID: sell.ID,
+		Price:       tradePrice,
+		Quantity:    qty,
+		Aggressor:   aggressor,
+		Timestamp:   exch.clock.Now(),
+	}
+	if exch.accounts != nil {
+		exch.accounts.applyFill(exch.Symbol, buy, sell, tradePrice, qty)
+	}
+	if exch.replaying {
+		// The journaled trade is recorded instead once it has been compared with this one
+		exch.replayed = append(exch.replayed, trade)
+		return
+	}
+
+	if err := exch.journalEvent(JournalEvent{Type: JournalTrade, Time: trade.Timestamp, Trade: &trade}); err != nil && exch.halted == nil {
+		// The trade has been applied, so the rest of the order is matched as usual
+		// and everything after it is refused
+		exch.halted = fmt.Errorf("%w: failed to journal trade %s: %s", ErrExchangeHalted, trade.ID, err.Error())
+		logger.Error(fmt.Sprintf("[%s] %s", exch.Symbol, exch.halted.Error()))
+	}
+	exch.recordTrade(trade)
+	exch.notifyTrade(trade)
+
+	// Notify price update callbacks
+	exch.notifyPriceUpdate(int(exch.LastTradedPrice))
+}
+
+// recordTrade adds an execution to the trade tape and the candles.
+// The caller must hold matchLock so trades are recorded in order.
+func (exch *Exchange) recordTrade(trade Trade) {
+	exch.tradeTape.Add(trade)
+	exch.notifyCandles(exch.candles.Add(trade))
+	if exch.onTrade != nil {
+		exch.onTrade(trade)
+	}
+}
+
+// ProcessTrades periodically matches the resting buy and sell orders when the
+// exchange runs in batch mode. In continuous mode orders are matched by
+// AcceptTrades as they arrive, so ProcessTrades returns immediately.
 func (exch *Exchange) ProcessTrades() {
-	ticker := time.NewTicker(time.Second)
-	logger := NewLogger("ProcessTrades")
+	logger := exch.newLogger("ProcessTrades")
+	if exch.matchingMode != BatchMatching {
+		logger.Info("Continuous matching enabled, batch processing is not required")
+		return
+	}
 
+	ticker := exch.clock.NewTicker(time.Second)
 	for {
-		<-ticker.C
+		<-ticker.C()
 		logger.Info("Processing trades")
+		exch.matchBatch(logger)
+	}
+}
 
-		// Get all buy orders sorted by price (highest first)
-		// ConcurrentTxnBST handles locking internally
-		buyOrders := exch.BuyQ.InorderTraversal()
-		// Reverse the order to get highest prices first (better for buyers)
-		for i, j := 0, len(buyOrders)-1; i < j; i, j = i+1, j-1 {
-			buyOrders[i], buyOrders[j] = buyOrders[j], buyOrders[i]
-		}
-
-		// Get all sell orders sorted by price (lowest first)
-		// ConcurrentTxnBST handles locking internally
-		sellOrders := exch.SellQ.InorderTraversal()
-
-		// Match orders with improved algorithm
-		matchedPairs := make([]struct{
-			buy  Transaction
-			sell Transaction
-		}, 0)
-
-		// Find matching pairs
-		for _, bTxn := range buyOrders {
-			for i, sTxn := range sellOrders {
-				// Match if buy price >= sell price (realistic market matching)
-				if bTxn.Amount >= sTxn.Amount {
-					matchedPairs = append(matchedPairs, struct{
-						buy  Transaction
-						sell Transaction
-					}{bTxn, sTxn})
-
-					// Remove matched sell order from consideration
-					sellOrders = append(sellOrders[:i], sellOrders[i+1:]...)
-					break
-				}
-			}
-		}
+// matchBatch matches the books if they cross, as one run of ProcessTrades
+func (exch *Exchange) matchBatch(logger *Logger) {
+	exch.matchLock.Lock()
+	defer exch.matchLock.Unlock()
 
-		// Process matched pairs
-		for _, pair := range matchedPairs {
-			// Use the sell price as the trade price (conservative approach)
-			// Ensure the price is never less than 1 (minimum valid price)
-			tradePrice := pair.sell.Amount
-			if tradePrice < 1 {
-				logger.Warn(fmt.Sprintf("Attempted to set LTP to %d, enforcing minimum price of 1", tradePrice))
-				tradePrice = 1
-			}
-			exch.LastTradedPrice = tradePrice
+	if exch.halted != nil || !exch.crossed() {
+		return
+	}
+	// The batch is journaled so a replay matches the books at the same point
+	if err := exch.journalEvent(JournalEvent{Type: JournalMatch}); err != nil {
+		logger.Error(fmt.Sprintf("[%s] Failed to journal batch: %s", exch.Symbol, err.Error()))
+		return
+	}
+	exch.matchBooks(logger)
+	exch.publishBookUpdate()
+}
 
-			logger.Info(fmt.Sprintf("Matched buy order %s (price: %d) with sell order %s (price: %d)",
-				pair.buy.ID, pair.buy.Amount, pair.sell.ID, pair.sell.Amount))
-			logger.Info(fmt.Sprintf("LTP: %d", exch.LastTradedPrice))
+// crossed reports whether the best bid is at or above the best ask.
+// The caller must hold matchLock.
+func (exch *Exchange) crossed() bool {
+	buy, ok := exch.BuyQ.Max()
+	if !ok {
+		return false
+	}
+	sell, ok := exch.SellQ.Min()
+	return ok && buy.Amount >= sell.Amount
+}
 
-			// Notify price update callbacks
-			exch.notifyPriceUpdate(int(exch.LastTradedPrice))
+// matchBooks matches the best buy and sell orders for as long as they cross.
+// The order that rested first sets the trade price. The caller must hold matchLock.
+func (exch *Exchange) matchBooks(logger *Logger) {
+	for {
+		buy, ok := exch.BuyQ.Max()
+		if !ok {
+			return
+		}
+		sell, ok := exch.SellQ.Min()
+		if !ok || buy.Amount < sell.Amount {
+			return
+		}
 
-			// Remove the matched orders from their respective queues
-			// ConcurrentTxnBST handles locking internally
-			exch.BuyQ.Remove(pair.buy)
-			exch.SellQ.Remove(pair.sell)
+		// The later order is the aggressor. Fall back to the sell price
+		// when neither order is known to be older.
+		tradePrice, aggressor := sell.Amount, BuyTransactionType
+		if buy.Seq < sell.Seq {
+			tradePrice, aggressor = buy.Amount, SellTransactionType
 		}
+
+		qty := fillQuantity(&buy, &sell)
+		exch.reduce(exch.BuyQ, buy, qty)
+		exch.reduce(exch.SellQ, sell, qty)
+		exch.executeTrade(buy, sell, tradePrice, qty, aggressor, logger)
 	}
 }
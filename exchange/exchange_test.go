@@ -1,6 +1,7 @@
 package exchange
 
 import (
+	"errors"
 	"sync"
 	"testing"
 	"time"
@@ -128,6 +129,12 @@ func TestGetOrderBook(t *testing.T) {
 
 func TestAcceptTrades(t *testing.T) {
 	exchange := NewExchange(100)
+
+	// Every order is reported once it has been processed, accepted or not
+	reports := make(chan OrderReport, 4)
+	exchange.RegisterOrderReportCallback(func(report OrderReport) {
+		reports <- report
+	})
 	
 	// Start the AcceptTrades goroutine
 	go exchange.AcceptTrades()
@@ -136,14 +143,22 @@ func TestAcceptTrades(t *testing.T) {
 	buyTxn := NewTransaction(BuyTransactionType, 90)
 	sellTxn := NewTransaction(SellTransactionType, 110)
 	invalidTxn := NewTransaction(BuyTransactionType, 0) // Invalid price
+	invalidQtyTxn := NewTransactionWithQuantity(SellTransactionType, 120, 0) // Invalid quantity
 	
 	// Send transactions to the exchange
 	exchange.IncomingTrades <- buyTxn
 	exchange.IncomingTrades <- sellTxn
 	exchange.IncomingTrades <- invalidTxn
-	
-	// Give some time for processing
-	time.Sleep(100 * time.Millisecond)
+	exchange.IncomingTrades <- invalidQtyTxn
+	
+	// Wait for all four to be processed
+	for i := 0; i < 4; i++ {
+		select {
+		case <-reports:
+		case <-time.After(time.Second):
+			t.Fatalf("Expected 4 order reports, got %d", i)
+		}
+	}
 	
 	// Check that valid transactions were added to the queues
 	buyOrders := exchange.BuyQ.InorderTraversal()
@@ -167,33 +182,52 @@ func TestAcceptTrades(t *testing.T) {
 }
 
 func TestProcessTrades(t *testing.T) {
-	// Create a test exchange with initial LTP of 100
+	// Create a test exchange with initial LTP of 100 that matches in batches
 	exchange := NewExchange(100)
+	exchange.SetMatchingMode(BatchMatching)
+	clock := NewSimulatedClock(time.Date(2025, 4, 27, 15, 0, 0, 0, time.UTC))
+	exchange.SetClock(clock)
 	
 	// Create a channel to track price updates
 	priceUpdates := make(chan int, 10)
 	exchange.RegisterPriceUpdateCallback(func(price int) {
 		priceUpdates <- price
 	})
+
+	// The book is published once a batch has been matched
+	bookUpdates := make(chan BookUpdate, 10)
+	exchange.RegisterBookUpdateCallback(func(update BookUpdate) {
+		bookUpdates <- update
+	})
 	
 	// Start the ProcessTrades goroutine
 	go exchange.ProcessTrades()
+	clock.WaitForTickers(1)
 	
 	// Add buy and sell orders that should match
 	buyTxn := NewTransaction(BuyTransactionType, 110) // Willing to buy at 110
 	sellTxn := NewTransaction(SellTransactionType, 90) // Willing to sell at 90
 	
-	exchange.BuyQ.Insert(buyTxn)
-	exchange.SellQ.Insert(sellTxn)
+	// In batch mode they rest until the next tick; the sell arrives first
+	exchange.Submit(sellTxn)
+	exchange.Submit(buyTxn)
+	<-bookUpdates
+	<-bookUpdates
 	
-	// Wait for processing to occur (the ticker in ProcessTrades is 1 second)
+	// The ticker in ProcessTrades ticks once a simulated second has passed
+	clock.Advance(time.Second)
+	select {
+	case <-bookUpdates:
+	case <-time.After(time.Second):
+		t.Fatalf("No batch was matched after the clock ticked")
+	}
 	select {
 	case price := <-priceUpdates:
 		// The trade should execute at the sell price (90)
 		if price != 90 {
 			t.Errorf("Expected trade to execute at price 90, got %d", price)
 		}
-	case <-time.After(2 * time.Second):
+	case <-time.After(time.Second):
 		t.Errorf("No price update received within timeout")
 	}
 	
@@ -223,18 +257,18 @@ func TestConcurrentOrderProcessing(t *testing.T) {
 	go exchange.AcceptTrades()
 	go exchange.ProcessTrades()
 	
-	// Track matched orders through price updates
-	var priceUpdateCount int
-	var priceMutex sync.Mutex
-	
+	// Track matched orders through price updates and processed orders through their reports
+	const numOrders = 20
+	priceUpdates := make(chan int, 2*numOrders)
 	exchange.RegisterPriceUpdateCallback(func(price int) {
-		priceMutex.Lock()
-		priceUpdateCount++
-		priceMutex.Unlock()
+		priceUpdates <- price
+	})
+	reports := make(chan OrderReport, 2*numOrders)
+	exchange.RegisterOrderReportCallback(func(report OrderReport) {
+		reports <- report
 	})
 	
 	// Generate a bunch of matching orders concurrently
-	const numOrders = 20
 	var wg sync.WaitGroup
 	wg.Add(numOrders)
 	
@@ -258,15 +292,19 @@ func TestConcurrentOrderProcessing(t *testing.T) {
 	// Wait for all orders to be submitted
 	wg.Wait()
 	
-	// Wait for processing to occur (give it some time)
-	time.Sleep(2 * time.Second)
+	// Wait for every order to be processed
+	for i := 0; i < 2*numOrders; i++ {
+		select {
+		case <-reports:
+		case <-time.After(time.Second):
+			t.Fatalf("Expected %d order reports, got %d", 2*numOrders, i)
+		}
+	}
 	
 	// Check that some price updates occurred (indicating matches)
-	priceMutex.Lock()
-	updates := priceUpdateCount
-	priceMutex.Unlock()
-	
-	if updates == 0 {
+	select {
+	case <-priceUpdates:
+	case <-time.After(time.Second):
 		t.Errorf("Expected some price updates from matching orders, got none")
 	}
 	
@@ -281,3 +319,441 @@ func TestConcurrentOrderProcessing(t *testing.T) {
 			len(buyOrders), len(sellOrders))
 	}
 }
+
+func TestContinuousMatching(t *testing.T) {
+	exchange := NewExchange(100)
+
+	priceUpdates := make(chan int, 10)
+	exchange.RegisterPriceUpdateCallback(func(price int) {
+		priceUpdates <- price
+	})
+
+	go exchange.AcceptTrades()
+
+	// A resting sell order at 95 followed by a crossing buy at 105
+	exchange.IncomingTrades <- NewTransaction(SellTransactionType, 95)
+	exchange.IncomingTrades <- NewTransaction(BuyTransactionType, 105)
+
+	// The match should happen without waiting for a batch tick
+	select {
+	case price := <-priceUpdates:
+		// The resting sell order sets the trade price
+		if price != 95 {
+			t.Errorf("Expected trade to execute at resting price 95, got %d", price)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatalf("No price update received within timeout")
+	}
+
+	if orders := exchange.BuyQ.InorderTraversal(); len(orders) != 0 {
+		t.Errorf("Expected buy queue to be empty after matching, found %d orders", len(orders))
+	}
+	if orders := exchange.SellQ.InorderTraversal(); len(orders) != 0 {
+		t.Errorf("Expected sell queue to be empty after matching, found %d orders", len(orders))
+	}
+}
+
+func TestPriceTimePriority(t *testing.T) {
+	exchange := NewExchange(100)
+	logger := NewLogger("TestPriceTimePriority")
+
+	accept := func(txn Transaction) Transaction {
+		exchange.nextSeq++
+		txn.Seq = exchange.nextSeq
+		exchange.matchIncoming(txn, logger)
+		return txn
+	}
+
+	// Two buys at the best price and a worse one; the first at 101 must fill first
+	first := accept(NewTransaction(BuyTransactionType, 101))
+	second := accept(NewTransaction(BuyTransactionType, 101))
+	accept(NewTransaction(BuyTransactionType, 99))
+
+	accept(NewTransaction(SellTransactionType, 100))
+
+	if exchange.LastTradedPrice != 101 {
+		t.Errorf("Expected trade at resting buy price 101, got %d", exchange.LastTradedPrice)
+	}
+
+	remaining := exchange.BuyQ.InorderTraversal()
+	if len(remaining) != 2 {
+		t.Fatalf("Expected 2 resting buy orders, got %d", len(remaining))
+	}
+	for _, order := range remaining {
+		if order.ID == first.ID {
+			t.Errorf("Expected earliest order at best price %s to be filled first", first.ID)
+		}
+	}
+
+	// The next sell should take the second order at 101, not the one at 99
+	accept(NewTransaction(SellTransactionType, 99))
+	best, ok := exchange.BuyQ.Max()
+	if !ok || best.Amount != 99 {
+		t.Errorf("Expected only the 99 buy order to remain, got %+v", best)
+	}
+	if best.ID == second.ID {
+		t.Errorf("Expected order %s to have been filled", second.ID)
+	}
+}
+
+func TestPartialFills(t *testing.T) {
+	exchange := NewExchange(100)
+	logger := NewLogger("TestPartialFills")
+
+	accept := func(txn Transaction) Transaction {
+		exchange.nextSeq++
+		txn.Seq = exchange.nextSeq
+		exchange.matchIncoming(txn, logger)
+		return txn
+	}
+
+	// Two resting sells: 5 @ 100 and 5 @ 101
+	first := accept(NewTransactionWithQuantity(SellTransactionType, 100, 5))
+	accept(NewTransactionWithQuantity(SellTransactionType, 101, 5))
+	// A later sell at the same price must stay behind the partially filled one
+	accept(NewTransactionWithQuantity(SellTransactionType, 100, 2))
+
+	// Buy 3 @ 100 partially fills the first sell
+	accept(NewTransactionWithQuantity(BuyTransactionType, 100, 3))
+
+	best, ok := exchange.SellQ.Min()
+	if !ok {
+		t.Fatalf("Expected resting sell orders")
+	}
+	if best.ID != first.ID {
+		t.Errorf("Expected partially filled order %s to keep its time priority, got %s", first.ID, best.ID)
+	}
+	if best.Filled != 3 || best.Remaining() != 2 {
+		t.Errorf("Expected 3 filled and 2 remaining, got %d filled and %d remaining", best.Filled, best.Remaining())
+	}
+
+	// Buy 8 @ 101 sweeps the 100 level and takes 4 of the 101 order, leaving nothing to rest
+	accept(NewTransactionWithQuantity(BuyTransactionType, 101, 8))
+
+	sells := exchange.SellQ.InorderTraversal()
+	if len(sells) != 1 || sells[0].Amount != 101 || sells[0].Remaining() != 1 {
+		t.Errorf("Expected 1 unit left at 101, got %+v", sells)
+	}
+	if buys := exchange.BuyQ.InorderTraversal(); len(buys) != 0 {
+		t.Errorf("Expected the buy order to be completely filled, found %d resting", len(buys))
+	}
+	if exchange.LastTradedPrice != 101 {
+		t.Errorf("Expected LTP 101, got %d", exchange.LastTradedPrice)
+	}
+
+	// Buy 4 @ 101 fills the last unit and rests the remaining 3
+	accept(NewTransactionWithQuantity(BuyTransactionType, 101, 4))
+	buys := exchange.BuyQ.InorderTraversal()
+	if len(buys) != 1 || buys[0].Filled != 1 || buys[0].Remaining() != 3 {
+		t.Errorf("Expected a resting buy with 1 filled and 3 remaining, got %+v", buys)
+	}
+
+	orderBook := exchange.GetOrderBook()
+	if len(orderBook.BuyOrders) != 1 || orderBook.BuyOrders[0].Quantity != 3 {
+		t.Errorf("Expected order book to show remaining quantity 3, got %+v", orderBook.BuyOrders)
+	}
+}
+
+func TestOrderTypes(t *testing.T) {
+	logger := NewLogger("TestOrderTypes")
+
+	// newBook returns an exchange with sells of 5 @ 100 and 5 @ 105 resting
+	newBook := func() *Exchange {
+		exchange := NewExchange(100)
+		exchange.accept(NewTransactionWithQuantity(SellTransactionType, 100, 5), logger)
+		exchange.accept(NewTransactionWithQuantity(SellTransactionType, 105, 5), logger)
+		return &exchange
+	}
+
+	newOrder := func(orderType string, price TransactionAmtDataType, qty TransactionQtyDataType) Transaction {
+		txn := NewTransactionWithQuantity(BuyTransactionType, price, qty)
+		txn.OrderType = orderType
+		return txn
+	}
+
+	testCases := []struct {
+		name              string
+		order             Transaction
+		expectedStatus    OrderStatus
+		expectedFilled    TransactionQtyDataType
+		expectedCancelled TransactionQtyDataType
+		expectedSells     int
+	}{
+		{"Market order sweeps the book", newOrder(MarketOrderType, 0, 7), OrderStatusFilled, 7, 0, 1},
+		{"Market order larger than the book", newOrder(MarketOrderType, 0, 12), OrderStatusCancelled, 10, 2, 0},
+		{"IOC fills what crosses", newOrder(ImmediateOrCancelOrderType, 100, 8), OrderStatusCancelled, 5, 3, 1},
+		{"IOC fully filled", newOrder(ImmediateOrCancelOrderType, 105, 8), OrderStatusFilled, 8, 0, 1},
+		{"FOK killed without fills", newOrder(FillOrKillOrderType, 100, 8), OrderStatusCancelled, 0, 8, 2},
+		{"FOK filled across levels", newOrder(FillOrKillOrderType, 105, 10), OrderStatusFilled, 10, 0, 0},
+		{"Limit order rests remainder", newOrder(LimitOrderType, 100, 8), OrderStatusPartiallyFilled, 5, 0, 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			exchange := newBook()
+			report, _ := exchange.accept(tc.order, logger)
+
+			if report.Status != tc.expectedStatus {
+				t.Errorf("Expected status %s, got %s", tc.expectedStatus, report.Status)
+			}
+			if report.Filled != tc.expectedFilled {
+				t.Errorf("Expected filled quantity %d, got %d", tc.expectedFilled, report.Filled)
+			}
+			if report.Cancelled != tc.expectedCancelled {
+				t.Errorf("Expected cancelled quantity %d, got %d", tc.expectedCancelled, report.Cancelled)
+			}
+			if sells := exchange.SellQ.InorderTraversal(); len(sells) != tc.expectedSells {
+				t.Errorf("Expected %d resting sell orders, got %d", tc.expectedSells, len(sells))
+			}
+
+			// Only limit orders may rest in the book
+			buys := exchange.BuyQ.InorderTraversal()
+			if tc.order.Rests() != (len(buys) > 0) {
+				t.Errorf("Unexpected resting buy orders for %s order: %d", tc.order.OrderType, len(buys))
+			}
+		})
+	}
+}
+
+func TestOrderReportCallback(t *testing.T) {
+	exchange := NewExchange(100)
+
+	reports := make(chan OrderReport, 10)
+	exchange.RegisterOrderReportCallback(func(report OrderReport) {
+		reports <- report
+	})
+
+	go exchange.AcceptTrades()
+
+	// An IOC order against an empty book is cancelled instead of resting
+	order := NewTransactionWithQuantity(SellTransactionType, 100, 3)
+	order.OrderType = ImmediateOrCancelOrderType
+	exchange.IncomingTrades <- order
+
+	select {
+	case report := <-reports:
+		if report.OrderID != order.ID {
+			t.Errorf("Expected report for order %s, got %s", order.ID, report.OrderID)
+		}
+		if report.Status != OrderStatusCancelled || report.Cancelled != 3 {
+			t.Errorf("Expected 3 units cancelled, got status %s cancelled %d", report.Status, report.Cancelled)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("No order report received within timeout")
+	}
+
+	if sells := exchange.SellQ.InorderTraversal(); len(sells) != 0 {
+		t.Errorf("Expected the IOC order not to rest, found %d sell orders", len(sells))
+	}
+}
+
+func TestCancelOrder(t *testing.T) {
+	exchange := NewExchange(100)
+	logger := NewLogger("TestCancelOrder")
+
+	order := NewTransactionWithQuantity(BuyTransactionType, 95, 10)
+	exchange.accept(order, logger)
+	exchange.accept(NewTransactionWithQuantity(SellTransactionType, 95, 4), logger)
+
+	report, err := exchange.CancelOrder(order.ID)
+	if err != nil {
+		t.Fatalf("Expected cancel to succeed, got %v", err)
+	}
+	if report.Status != OrderStatusCancelled || report.Filled != 4 || report.Cancelled != 6 {
+		t.Errorf("Expected 4 filled and 6 cancelled, got status %s filled %d cancelled %d",
+			report.Status, report.Filled, report.Cancelled)
+	}
+	if buys := exchange.BuyQ.InorderTraversal(); len(buys) != 0 {
+		t.Errorf("Expected the cancelled order to leave the book, found %d orders", len(buys))
+	}
+	if _, ok := exchange.GetOrder(order.ID); ok {
+		t.Errorf("Expected the cancelled order to be removed from the index")
+	}
+
+	if _, err := exchange.CancelOrder(order.ID); err != ErrOrderNotFound {
+		t.Errorf("Expected ErrOrderNotFound cancelling twice, got %v", err)
+	}
+}
+
+func TestAmendOrder(t *testing.T) {
+	logger := NewLogger("TestAmendOrder")
+
+	// newBook rests two buys at 100, the first one being amended in each case
+	newBook := func() (*Exchange, Transaction, Transaction) {
+		exchange := NewExchange(100)
+		first := NewTransactionWithQuantity(BuyTransactionType, 100, 10)
+		second := NewTransactionWithQuantity(BuyTransactionType, 100, 10)
+		exchange.accept(first, logger)
+		exchange.accept(second, logger)
+		return &exchange, first, second
+	}
+
+	t.Run("Quantity Decrease Keeps Priority", func(t *testing.T) {
+		exchange, first, _ := newBook()
+		report, err := exchange.AmendOrder(first.ID, 100, 6)
+		if err != nil {
+			t.Fatalf("Expected amend to succeed, got %v", err)
+		}
+		if report.Quantity != 6 {
+			t.Errorf("Expected quantity 6, got %d", report.Quantity)
+		}
+		if best, _ := exchange.BuyQ.Max(); best.ID != first.ID || best.Remaining() != 6 {
+			t.Errorf("Expected %s to stay first with 6 remaining, got %s with %d", first.ID, best.ID, best.Remaining())
+		}
+	})
+
+	t.Run("Quantity Increase Loses Priority", func(t *testing.T) {
+		exchange, first, second := newBook()
+		if _, err := exchange.AmendOrder(first.ID, 100, 12); err != nil {
+			t.Fatalf("Expected amend to succeed, got %v", err)
+		}
+		if best, _ := exchange.BuyQ.Max(); best.ID != second.ID {
+			t.Errorf("Expected %s to take priority, got %s", second.ID, best.ID)
+		}
+	})
+
+	t.Run("Price Change Loses Priority", func(t *testing.T) {
+		exchange, first, second := newBook()
+		if _, err := exchange.AmendOrder(first.ID, 99, 10); err != nil {
+			t.Fatalf("Expected amend to succeed, got %v", err)
+		}
+		if best, _ := exchange.BuyQ.Max(); best.ID != second.ID {
+			t.Errorf("Expected %s to take priority, got %s", second.ID, best.ID)
+		}
+		if amended, _ := exchange.GetOrder(first.ID); amended.Amount != 99 {
+			t.Errorf("Expected amended price 99, got %d", amended.Amount)
+		}
+	})
+
+	t.Run("Crossing Price Matches", func(t *testing.T) {
+		exchange, first, _ := newBook()
+		exchange.accept(NewTransactionWithQuantity(SellTransactionType, 102, 4), logger)
+
+		report, err := exchange.AmendOrder(first.ID, 102, 10)
+		if err != nil {
+			t.Fatalf("Expected amend to succeed, got %v", err)
+		}
+		if report.Filled != 4 || report.Status != OrderStatusPartiallyFilled {
+			t.Errorf("Expected 4 filled by the amendment, got status %s filled %d", report.Status, report.Filled)
+		}
+		if exchange.LastTradedPrice != 102 {
+			t.Errorf("Expected trade at 102, got %d", exchange.LastTradedPrice)
+		}
+	})
+
+	t.Run("Invalid Amendments", func(t *testing.T) {
+		exchange, first, _ := newBook()
+		if _, err := exchange.AmendOrder("missing", 100, 1); err != ErrOrderNotFound {
+			t.Errorf("Expected ErrOrderNotFound, got %v", err)
+		}
+		if _, err := exchange.AmendOrder(first.ID, 0, 1); err != ErrInvalidPrice {
+			t.Errorf("Expected ErrInvalidPrice, got %v", err)
+		}
+		if _, err := exchange.AmendOrder(first.ID, 100, 0); err != ErrInvalidQuantity {
+			t.Errorf("Expected ErrInvalidQuantity, got %v", err)
+		}
+	})
+}
+
+func TestTradeExecutionReports(t *testing.T) {
+	exchange := NewExchange(100)
+	logger := NewLogger("TestTradeExecutionReports")
+
+	trades := make(chan Trade, 10)
+	exchange.RegisterTradeCallback(func(trade Trade) {
+		trades <- trade
+	})
+
+	sell := NewTransactionWithQuantity(SellTransactionType, 100, 5)
+	exchange.accept(sell, logger)
+	buy := NewTransactionWithQuantity(BuyTransactionType, 101, 3)
+	exchange.accept(buy, logger)
+
+	select {
+	case trade := <-trades:
+		if trade.BuyOrderID != buy.ID || trade.SellOrderID != sell.ID {
+			t.Errorf("Expected trade between %s and %s, got %s and %s",
+				buy.ID, sell.ID, trade.BuyOrderID, trade.SellOrderID)
+		}
+		if trade.Price != 100 || trade.Quantity != 3 {
+			t.Errorf("Expected 3 @ 100, got %d @ %d", trade.Quantity, trade.Price)
+		}
+		if trade.Aggressor != BuyTransactionType {
+			t.Errorf("Expected the incoming buy to be the aggressor, got %s", trade.Aggressor)
+		}
+		if trade.ID == "" || trade.Timestamp.IsZero() {
+			t.Errorf("Expected trade to have an ID and timestamp, got %+v", trade)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("No trade received within timeout")
+	}
+
+	// A sell sweeping the book is the aggressor
+	exchange.accept(NewTransactionWithQuantity(BuyTransactionType, 99, 2), logger)
+	exchange.accept(NewTransactionWithQuantity(SellTransactionType, 99, 2), logger)
+
+	tape := exchange.GetTrades(0)
+	if len(tape) != 2 {
+		t.Fatalf("Expected 2 trades on the tape, got %d", len(tape))
+	}
+	if tape[1].Aggressor != SellTransactionType || tape[1].Price != 99 {
+		t.Errorf("Expected the second trade to be a sell aggressor at 99, got %+v", tape[1])
+	}
+	if tape[0].ID == tape[1].ID {
+		t.Errorf("Expected unique trade IDs, got %s twice", tape[0].ID)
+	}
+}
+
+func TestSubmit(t *testing.T) {
+	exchange := NewExchange(100)
+	exchange.AddRiskCheck(MaxOrderSizeCheck(10))
+
+	reports := make(chan OrderReport, 10)
+	exchange.RegisterOrderReportCallback(func(report OrderReport) {
+		reports <- report
+	})
+
+	// An accepted order is acknowledged without AcceptTrades running
+	sell := NewTransactionWithQuantity(SellTransactionType, 100, 5)
+	report, err := exchange.Submit(sell)
+	if err != nil {
+		t.Fatalf("Expected the order to be accepted, got %v", err)
+	}
+	if report.OrderID != sell.ID || report.Status != OrderStatusNew {
+		t.Errorf("Expected order %s to be NEW, got %+v", sell.ID, report)
+	}
+
+	// Resubmitting a resting order is rejected
+	_, err = exchange.Submit(sell)
+	var rejection *Rejection
+	if !errors.As(err, &rejection) || rejection.Reason != RejectDuplicateOrderID {
+		t.Errorf("Expected a duplicate order rejection, got %v", err)
+	}
+
+	// A risk rejection is returned as a typed error along with the report
+	report, err = exchange.Submit(NewTransactionWithQuantity(BuyTransactionType, 100, 11))
+	if !errors.As(err, &rejection) || rejection.Reason != RejectMaxOrderSize {
+		t.Errorf("Expected a max order size rejection, got %v", err)
+	}
+	if report.Status != OrderStatusRejected || report.RejectReason != RejectMaxOrderSize {
+		t.Errorf("Expected a rejected report, got %+v", report)
+	}
+
+	// Orders without an ID are given one and fill synchronously
+	report, err = exchange.Submit(Transaction{Type: BuyTransactionType, Amount: 100, Quantity: 5})
+	if err != nil || report.OrderID == "" || report.Status != OrderStatusFilled {
+		t.Errorf("Expected a filled order with a generated ID, got %+v, %v", report, err)
+	}
+	if exchange.LastTradedPrice != 100 {
+		t.Errorf("Expected LTP 100, got %d", exchange.LastTradedPrice)
+	}
+
+	// Every outcome is also delivered to the order report callbacks
+	for i := 0; i < 4; i++ {
+		select {
+		case <-reports:
+		case <-time.After(time.Second):
+			t.Fatalf("Expected 4 order reports, got %d", i)
+		}
+	}
+}
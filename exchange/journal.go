@@ -0,0 +1,489 @@
+package exchange
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// JournalEventType identifies what a journal event records
+type JournalEventType string
+
+const (
+	// JournalOrder records an order that passed validation and the risk checks
+	JournalOrder JournalEventType = "order"
+	// JournalCancel records the cancellation of a resting order
+	JournalCancel JournalEventType = "cancel"
+	// JournalAmend records a change to the price and quantity of a resting order
+	JournalAmend JournalEventType = "amend"
+	// JournalTrade records an execution
+	JournalTrade JournalEventType = "trade"
+	// JournalAccount records the opening of an account
+	JournalAccount JournalEventType = "account"
+	// JournalMatch records a batch run of ProcessTrades that matched crossing books
+	JournalMatch JournalEventType = "match"
+	// JournalCheckpoint records a checksum of an exchange's state that a replay must reproduce
+	JournalCheckpoint JournalEventType = "checkpoint"
+)
+
+// JournalEvent is one record of the journal. Only the fields used by its type are set.
+type JournalEvent struct {
+	// Sequence numbers the events of a journal consecutively from 1
+	Sequence uint64           `json:"seq"`
+	Type     JournalEventType `json:"type"`
+	Time     time.Time        `json:"time"`
+	Symbol   string           `json:"symbol,omitempty"`
+	// OrderID identifies the order of an order, cancel or amend event
+	OrderID string `json:"orderId,omitempty"`
+	// AccountID owns an order or is the account opened by an account event
+	AccountID string `json:"accountId,omitempty"`
+	Side      string `json:"side,omitempty"`
+	OrderType string `json:"orderType,omitempty"`
+	// Price and Quantity are those of an order, or the new ones of an amended order
+	Price    TransactionAmtDataType `json:"price,omitempty"`
+	Quantity TransactionQtyDataType `json:"quantity,omitempty"`
+	// OrderSeq is the priority the exchange gave an order. It is zero for an
+	// amendment that kept the order's priority.
+	OrderSeq uint64 `json:"orderSeq,omitempty"`
+	Trade    *Trade `json:"trade,omitempty"`
+	// Cash is the initial balance of an opened account
+	Cash int64 `json:"cash,omitempty"`
+	// Checksum is the state checksum of a checkpoint
+	Checksum uint32 `json:"checksum,omitempty"`
+}
+
+// newOrderEvent records an accepted order
+func newOrderEvent(txn Transaction) JournalEvent {
+	return JournalEvent{
+		Type:      JournalOrder,
+		Symbol:    txn.Symbol,
+		OrderID:   txn.ID,
+		AccountID: txn.AccountID,
+		Side:      txn.Type,
+		OrderType: txn.OrderType,
+		Price:     txn.Amount,
+		Quantity:  txn.Quantity,
+		OrderSeq:  txn.Seq,
+	}
+}
+
+// Transaction returns the order recorded by an order event
+func (event JournalEvent) Transaction() Transaction {
+	return Transaction{
+		ID:        event.OrderID,
+		Symbol:    event.Symbol,
+		AccountID: event.AccountID,
+		Type:      event.Side,
+		OrderType: event.OrderType,
+		Amount:    event.Price,
+		Quantity:  event.Quantity,
+		Seq:       event.OrderSeq,
+	}
+}
+
+// SyncPolicy controls when journal writes are flushed to stable storage
+type SyncPolicy string
+
+const (
+	// SyncAlways calls fsync after every event, so an acknowledged event survives a power failure
+	SyncAlways SyncPolicy = "always"
+	// SyncInterval calls fsync periodically, losing at most one interval of events on a power failure
+	SyncInterval SyncPolicy = "interval"
+	// SyncNever leaves flushing to the operating system. Events still survive a crash of the process.
+	SyncNever SyncPolicy = "never"
+)
+
+// defaultSyncInterval is the fsync interval of the SyncInterval policy when none is configured
+const defaultSyncInterval = 100 * time.Millisecond
+
+var (
+	// ErrUnknownSyncPolicy is returned for a sync policy that does not exist
+	ErrUnknownSyncPolicy = errors.New("unknown sync policy")
+	// ErrJournalCorrupted is returned when a journal record is incomplete, fails its checksum or is out of sequence
+	ErrJournalCorrupted = errors.New("journal corrupted")
+	// ErrJournalClosed is returned when an event is appended to a closed journal
+	ErrJournalClosed = errors.New("journal closed")
+)
+
+// ParseSyncPolicy returns the sync policy with the given name
+func ParseSyncPolicy(name string) (SyncPolicy, error) {
+	switch policy := SyncPolicy(name); policy {
+	case SyncAlways, SyncInterval, SyncNever:
+		return policy, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnknownSyncPolicy, name)
+}
+
+// JournalOptions configures how a journal is written
+type JournalOptions struct {
+	Sync SyncPolicy
+	// SyncInterval is the time between fsyncs of the SyncInterval policy
+	SyncInterval time.Duration
+	// Clock stamps events appended without a time. The real clock is used if it is nil.
+	Clock Clock
+}
+
+// Journal is an append-only file of events. Each line holds the CRC-32 checksum
+// of an event followed by the event as JSON, so a torn or damaged record is
+// detected when the journal is read back.
+type Journal struct {
+	file     *os.File
+	options  JournalOptions
+	sequence uint64
+	// size is the length of the file, where the next event is written
+	size int64
+	// dirty is set when events were written since the last fsync
+	dirty bool
+	// err is the first write error; a journal that failed to write refuses further events
+	err    error
+	mutex  sync.Mutex
+	done   chan struct{}
+	logger *Logger
+}
+
+// OpenJournal opens the journal at path for appending, creating it if needed. New
+// events continue the sequence of the events already in the file. A journal with
+// a damaged record is not opened.
+func OpenJournal(path string, options JournalOptions) (*Journal, error) {
+	options = options.withDefaults()
+	events, err := ReadJournal(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	var sequence uint64
+	if len(events) > 0 {
+		sequence = events[len(events)-1].Sequence
+	}
+	return openJournal(path, options, sequence)
+}
+
+// withDefaults fills in the options that are not set
+func (options JournalOptions) withDefaults() JournalOptions {
+	if options.Sync == "" {
+		options.Sync = SyncInterval
+	}
+	if options.Sync == SyncInterval && options.SyncInterval <= 0 {
+		options.SyncInterval = defaultSyncInterval
+	}
+	if options.Clock == nil {
+		options.Clock = RealClock
+	}
+	return options
+}
+
+// openJournal opens the journal at path for appending after its last event, whose
+// sequence number the caller has read
+func openJournal(path string, options JournalOptions, sequence uint64) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	journal := &Journal{
+		file:     file,
+		options:  options,
+		sequence: sequence,
+		size:     info.Size(),
+		done:     make(chan struct{}),
+		logger:   NewLogger("Journal"),
+	}
+	journal.logger.SetClock(options.Clock)
+	if options.Sync == SyncInterval {
+		go journal.syncPeriodically()
+	}
+	return journal, nil
+}
+
+// Sequence returns the sequence number of the last event in the journal
+func (journal *Journal) Sequence() uint64 {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+
+	return journal.sequence
+}
+
+// position returns the sequence number of the last event in the journal and the
+// offset just after it
+func (journal *Journal) position() (uint64, int64) {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+
+	return journal.sequence, journal.size
+}
+
+// Append gives an event the next sequence number and writes it to the journal,
+// returning the sequence number. Events without a time are stamped with the journal's clock.
+func (journal *Journal) Append(event JournalEvent) (uint64, error) {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+
+	if journal.err != nil {
+		return 0, journal.err
+	}
+
+	event.Sequence = journal.sequence + 1
+	if event.Time.IsZero() {
+		event.Time = journal.options.Clock.Now()
+	}
+	record, err := encodeJournalEvent(event)
+	if err != nil {
+		return 0, err
+	}
+
+	// Writing every record straight to the file keeps acknowledged events if the process crashes
+	if _, err := journal.file.Write(record); err != nil {
+		return 0, journal.fail(err)
+	}
+	if journal.options.Sync == SyncAlways {
+		if err := journal.file.Sync(); err != nil {
+			return 0, journal.fail(err)
+		}
+	} else {
+		journal.dirty = true
+	}
+
+	journal.sequence = event.Sequence
+	journal.size += int64(len(record))
+	return event.Sequence, nil
+}
+
+// fail records the first write error. The caller must hold the mutex.
+func (journal *Journal) fail(err error) error {
+	journal.err = fmt.Errorf("journal write failed: %w", err)
+	journal.logger.Error(journal.err.Error())
+	return journal.err
+}
+
+// Sync flushes every written event to stable storage
+func (journal *Journal) Sync() error {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+
+	if journal.err != nil {
+		return journal.err
+	}
+	journal.dirty = false
+	return journal.file.Sync()
+}
+
+// syncPeriodically calls fsync every sync interval while events are being written
+func (journal *Journal) syncPeriodically() {
+	ticker := time.NewTicker(journal.options.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			journal.mutex.Lock()
+			if journal.dirty && journal.err == nil {
+				if err := journal.file.Sync(); err != nil {
+					journal.fail(err)
+				}
+				journal.dirty = false
+			}
+			journal.mutex.Unlock()
+		case <-journal.done:
+			return
+		}
+	}
+}
+
+// Close flushes the journal to stable storage and closes it
+func (journal *Journal) Close() error {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+
+	if errors.Is(journal.err, ErrJournalClosed) {
+		return nil
+	}
+	close(journal.done)
+
+	err := journal.file.Sync()
+	if closeErr := journal.file.Close(); err == nil {
+		err = closeErr
+	}
+	journal.err = ErrJournalClosed
+	return err
+}
+
+// encodeJournalEvent encodes an event as one journal line
+func encodeJournalEvent(event JournalEvent) ([]byte, error) {
+	return encodeRecord(event)
+}
+
+// decodeJournalEvent decodes one journal line without its newline and verifies its checksum
+func decodeJournalEvent(line []byte) (JournalEvent, error) {
+	var event JournalEvent
+	err := decodeRecord(line, &event)
+	return event, err
+}
+
+// encodeRecord encodes a value as a line of JSON preceded by its CRC-32 checksum in hex
+func encodeRecord(value interface{}) ([]byte, error) {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("%08x %s\n", crc32.ChecksumIEEE(payload), payload)), nil
+}
+
+// decodeRecord verifies the checksum of a record without its newline and decodes it into value
+func decodeRecord(line []byte, value interface{}) error {
+	checksum, payload, ok := bytes.Cut(line, []byte(" "))
+	if !ok {
+		return errors.New("missing checksum")
+	}
+
+	var expected uint32
+	if _, err := fmt.Sscanf(string(checksum), "%08x", &expected); err != nil {
+		return fmt.Errorf("invalid checksum %q", checksum)
+	}
+	if actual := crc32.ChecksumIEEE(payload); actual != expected {
+		return fmt.Errorf("checksum %08x does not match %08x", actual, expected)
+	}
+	return json.Unmarshal(payload, value)
+}
+
+// ReadJournal returns every event in the journal at path. If a record is damaged
+// the events before it are returned together with an error wrapping ErrJournalCorrupted.
+func ReadJournal(path string) ([]JournalEvent, error) {
+	events, _, err := readJournalFrom(path, 0)
+	return events, err
+}
+
+// readJournalFrom reads the events of the journal at path from the record starting
+// at offset, returning them and the offset just after the last valid record
+func readJournalFrom(path string, offset int64) ([]JournalEvent, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	events, length, err := readJournalEvents(file)
+	return events, offset + length, err
+}
+
+// continuesAt reports whether the journal at path ends at offset or holds the event
+// after sequence there, so that a snapshot taken at that point belongs to it
+func continuesAt(path string, sequence uint64, offset int64) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.Size() < offset {
+		return false
+	}
+	if info.Size() == offset {
+		return true
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return false
+	}
+	line, err := bufio.NewReader(file).ReadBytes('\n')
+	if err != nil {
+		return false
+	}
+	event, err := decodeJournalEvent(line[:len(line)-1])
+	return err == nil && event.Sequence == sequence+1
+}
+
+// TruncateJournal cuts the journal at path just after its last valid record,
+// dropping a damaged record and everything written after it. It returns the
+// number of bytes removed, which is zero for an intact journal.
+func TruncateJournal(path string) (int64, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	_, offset, err := readJournalEvents(file)
+	if err == nil {
+		return 0, nil
+	}
+	if !errors.Is(err, ErrJournalCorrupted) {
+		return 0, err
+	}
+	return truncateJournal(file, info.Size(), offset)
+}
+
+// truncateJournalAt cuts the journal at path at offset, returning the number of bytes removed
+func truncateJournalAt(path string, offset int64) (int64, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return truncateJournal(file, info.Size(), offset)
+}
+
+// truncateJournal cuts a journal file of the given size at offset, returning the
+// number of bytes removed
+func truncateJournal(file *os.File, size, offset int64) (int64, error) {
+	if err := file.Truncate(offset); err != nil {
+		return 0, err
+	}
+	return size - offset, file.Sync()
+}
+
+// readJournalEvents reads events until the end of the journal or the first damaged
+// record, returning the events and the offset just after the last valid record
+func readJournalEvents(r io.Reader) ([]JournalEvent, int64, error) {
+	reader := bufio.NewReader(r)
+	events := make([]JournalEvent, 0)
+	var offset int64
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return events, offset, nil
+		}
+		if err == io.EOF {
+			return events, offset, fmt.Errorf("%w: incomplete record at offset %d", ErrJournalCorrupted, offset)
+		}
+		if err != nil {
+			return events, offset, err
+		}
+
+		event, err := decodeJournalEvent(line[:len(line)-1])
+		if err != nil {
+			return events, offset, fmt.Errorf("%w: record at offset %d: %s", ErrJournalCorrupted, offset, err.Error())
+		}
+		if n := len(events); n > 0 && event.Sequence != events[n-1].Sequence+1 {
+			return events, offset, fmt.Errorf("%w: record at offset %d has sequence %d, expected %d",
+				ErrJournalCorrupted, offset, event.Sequence, events[n-1].Sequence+1)
+		}
+
+		events = append(events, event)
+		offset += int64(len(line))
+	}
+}
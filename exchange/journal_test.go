@@ -0,0 +1,217 @@
+package exchange
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJournalAppendAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.log")
+
+	for _, policy := range []SyncPolicy{SyncAlways, SyncInterval, SyncNever} {
+		journal, err := OpenJournal(path, JournalOptions{Sync: policy})
+		if err != nil {
+			t.Fatalf("Failed to open journal: %v", err)
+		}
+		for i := 0; i < 2; i++ {
+			if _, err := journal.Append(JournalEvent{Type: JournalCancel, OrderID: string(policy)}); err != nil {
+				t.Fatalf("Failed to append with policy %s: %v", policy, err)
+			}
+		}
+		if err := journal.Close(); err != nil {
+			t.Fatalf("Failed to close journal: %v", err)
+		}
+		if _, err := journal.Append(JournalEvent{Type: JournalCancel}); !errors.Is(err, ErrJournalClosed) {
+			t.Errorf("Expected ErrJournalClosed, got %v", err)
+		}
+	}
+
+	// Reopening the journal continues its sequence
+	events, err := ReadJournal(path)
+	if err != nil {
+		t.Fatalf("Failed to read journal: %v", err)
+	}
+	if len(events) != 6 {
+		t.Fatalf("Expected 6 events, got %d", len(events))
+	}
+	for i, event := range events {
+		if event.Sequence != uint64(i+1) {
+			t.Errorf("Expected sequence %d, got %d", i+1, event.Sequence)
+		}
+		if event.Time.IsZero() {
+			t.Errorf("Expected event %d to be timestamped", event.Sequence)
+		}
+	}
+	if events[5].OrderID != string(SyncNever) {
+		t.Errorf("Expected the last event to be written with policy never, got %+v", events[5])
+	}
+
+	if _, err := ParseSyncPolicy("sometimes"); !errors.Is(err, ErrUnknownSyncPolicy) {
+		t.Errorf("Expected ErrUnknownSyncPolicy, got %v", err)
+	}
+}
+
+func TestJournalCorruption(t *testing.T) {
+	valid := func() []string {
+		lines := make([]string, 0, 3)
+		for i := 1; i <= 3; i++ {
+			record, _ := encodeJournalEvent(JournalEvent{Sequence: uint64(i), Type: JournalCancel, OrderID: "BUY-1"})
+			lines = append(lines, string(record))
+		}
+		return lines
+	}
+
+	testCases := []struct {
+		name     string
+		corrupt  func(lines []string) string
+		expected int
+	}{
+		{"Torn Last Record", func(lines []string) string {
+			return lines[0] + lines[1] + lines[2][:len(lines[2])/2]
+		}, 2},
+		{"Changed Payload", func(lines []string) string {
+			return lines[0] + strings.Replace(lines[1], "BUY-1", "BUY-2", 1) + lines[2]
+		}, 1},
+		{"Missing Checksum", func(lines []string) string {
+			return lines[0] + lines[1] + "{}\n"
+		}, 2},
+		{"Skipped Sequence", func(lines []string) string {
+			return lines[0] + lines[2]
+		}, 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "journal.log")
+			if err := os.WriteFile(path, []byte(tc.corrupt(valid())), 0644); err != nil {
+				t.Fatalf("Failed to write journal: %v", err)
+			}
+
+			events, err := ReadJournal(path)
+			if !errors.Is(err, ErrJournalCorrupted) {
+				t.Errorf("Expected ErrJournalCorrupted, got %v", err)
+			}
+			if len(events) != tc.expected {
+				t.Errorf("Expected %d valid events, got %d", tc.expected, len(events))
+			}
+
+			if _, err := OpenJournal(path, JournalOptions{Sync: SyncNever}); !errors.Is(err, ErrJournalCorrupted) {
+				t.Errorf("Expected a corrupted journal not to open, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRegistryJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.log")
+	journal, err := OpenJournal(path, JournalOptions{Sync: SyncAlways})
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+
+	registry := NewInstrumentRegistry()
+	registry.SetJournal(journal)
+	registry.Add("AAPL", 100)
+	registry.Accounts().Open("alice", 10000)
+
+	registry.Submit(Transaction{ID: "SELL-1", Symbol: "AAPL", Type: SellTransactionType, Amount: 101, Quantity: 5})
+	registry.Submit(Transaction{ID: "BUY-1", Symbol: "AAPL", AccountID: "alice", Type: BuyTransactionType, Amount: 101, Quantity: 2})
+	registry.Submit(Transaction{ID: "BUY-2", Symbol: "AAPL", Type: BuyTransactionType, Amount: 0, Quantity: 1})
+	aapl, _ := registry.Get("AAPL")
+	aapl.AmendOrder("SELL-1", 102, 3)
+	aapl.CancelOrder("SELL-1")
+	journal.Close()
+
+	events, err := ReadJournal(path)
+	if err != nil {
+		t.Fatalf("Failed to read journal: %v", err)
+	}
+
+	expected := []struct {
+		eventType JournalEventType
+		orderID   string
+	}{
+		{JournalAccount, ""},
+		{JournalOrder, "SELL-1"},
+		{JournalOrder, "BUY-1"},
+		{JournalTrade, ""},
+		// The rejected BUY-2 is not journaled
+		{JournalAmend, "SELL-1"},
+		{JournalCancel, "SELL-1"},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, got %d: %+v", len(expected), len(events), events)
+	}
+	for i, event := range events {
+		if event.Type != expected[i].eventType || event.OrderID != expected[i].orderID {
+			t.Errorf("Event %d: expected %s %q, got %s %q", i+1, expected[i].eventType, expected[i].orderID, event.Type, event.OrderID)
+		}
+	}
+
+	if order := events[2].Transaction(); order.AccountID != "alice" || order.Amount != 101 || order.Quantity != 2 || order.Seq != 2 {
+		t.Errorf("Expected alice's order of 2 @ 101 with priority 2, got %+v", order)
+	}
+	if trade := events[3].Trade; trade == nil || trade.BuyOrderID != "BUY-1" || trade.Quantity != 2 || events[3].Symbol != "AAPL" {
+		t.Errorf("Expected the AAPL trade of BUY-1 for 2, got %+v", events[3])
+	}
+	if events[4].OrderSeq != 3 || events[4].Price != 102 || events[4].Quantity != 3 {
+		t.Errorf("Expected the amendment to 3 @ 102 with priority 3, got %+v", events[4])
+	}
+
+	// Orders that cannot be journaled are rejected
+	report, err := registry.Submit(Transaction{Symbol: "AAPL", Type: BuyTransactionType, Amount: 99, Quantity: 1})
+	if report.RejectReason != RejectJournal || err == nil {
+		t.Errorf("Expected a %s rejection, got %+v (%v)", RejectJournal, report, err)
+	}
+}
+
+func TestTradeJournalFailureHaltsExchange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.log")
+	journal, err := OpenJournal(path, JournalOptions{Sync: SyncNever})
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+	defer journal.Close()
+
+	// Times after the year 9999 cannot be encoded, so the trades stamped by the
+	// exchange's clock fail to journal while the orders stamped by the journal do not
+	exchange := NewExchange(100)
+	exchange.SetClock(NewSimulatedClock(time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC)))
+	exchange.SetJournal(journal)
+
+	sell, err := exchange.Submit(NewTransactionWithQuantity(SellTransactionType, 100, 5))
+	if err != nil {
+		t.Fatalf("Failed to submit: %v", err)
+	}
+	exchange.Submit(NewTransactionWithQuantity(SellTransactionType, 101, 5))
+
+	report, err := exchange.Submit(NewTransactionWithQuantity(BuyTransactionType, 100, 2))
+	if !errors.Is(err, ErrExchangeHalted) {
+		t.Fatalf("Expected ErrExchangeHalted, got %v", err)
+	}
+	if report.Filled != 2 || exchange.LastTradedPrice != 100 {
+		t.Errorf("Expected the applied fill of 2 at 100 to be reported, got %+v", report)
+	}
+
+	// Nothing else is accepted once the journal no longer matches the books
+	report, err = exchange.Submit(NewTransactionWithQuantity(BuyTransactionType, 101, 1))
+	if report.Status != OrderStatusRejected || report.RejectReason != RejectJournal {
+		t.Errorf("Expected a journal rejection, got %+v and %v", report, err)
+	}
+	if !errors.Is(err, ErrExchangeHalted) {
+		t.Errorf("Expected ErrExchangeHalted for a later order, got %v", err)
+	}
+	if _, err := exchange.CancelOrder(sell.OrderID); !errors.Is(err, ErrExchangeHalted) {
+		t.Errorf("Expected ErrExchangeHalted cancelling, got %v", err)
+	}
+	if _, err := exchange.AmendOrder(sell.OrderID, 99, 5); !errors.Is(err, ErrExchangeHalted) {
+		t.Errorf("Expected ErrExchangeHalted amending, got %v", err)
+	}
+	if depth := exchange.GetDepth(0); len(depth.Asks) != 2 || depth.Asks[0].Quantity != 3 {
+		t.Errorf("Expected the book as it was at the halt, got %+v", depth.Asks)
+	}
+}
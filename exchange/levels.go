@@ -0,0 +1,200 @@
+package exchange
+
+import (
+	"sort"
+	"time"
+)
+
+// PriceLevel is the total quantity and number of orders resting at one price
+type PriceLevel struct {
+	Price    TransactionAmtDataType `json:"price"`
+	Quantity int64                  `json:"quantity"`
+	Orders   int                    `json:"orders"`
+}
+
+// LevelAction describes how a price level changed
+type LevelAction string
+
+const (
+	// LevelAdded is a price level that did not exist before
+	LevelAdded LevelAction = "added"
+	// LevelChanged is a price level whose quantity or number of orders changed
+	LevelChanged LevelAction = "changed"
+	// LevelRemoved is a price level without any orders left. Its quantity and orders are zero.
+	LevelRemoved LevelAction = "removed"
+)
+
+// LevelChange is the new state of one price level of one side of the book
+type LevelChange struct {
+	Side   string      `json:"side"`
+	Action LevelAction `json:"action"`
+	PriceLevel
+}
+
+// BookUpdate holds the price levels changed by one operation on the book. Updates
+// of a symbol are numbered consecutively, so a client that applies them to a
+// snapshot can detect a missed update by a gap in the sequence.
+type BookUpdate struct {
+	Symbol    string        `json:"symbol"`
+	Sequence  uint64        `json:"sequence"`
+	Changes   []LevelChange `json:"changes"`
+	Timestamp time.Time     `json:"timestamp"`
+}
+
+// BookSnapshot is every price level of both sides of the book, best price first,
+// as of the update with its sequence number
+type BookSnapshot struct {
+	Symbol    string       `json:"symbol"`
+	Sequence  uint64       `json:"sequence"`
+	Bids      []PriceLevel `json:"bids"`
+	Asks      []PriceLevel `json:"asks"`
+	Timestamp time.Time    `json:"timestamp"`
+}
+
+// Depth is the best price levels of both sides of the book, best price first
+type Depth struct {
+	Symbol    string       `json:"symbol"`
+	Bids      []PriceLevel `json:"bids"`
+	Asks      []PriceLevel `json:"asks"`
+	Timestamp time.Time    `json:"timestamp"`
+}
+
+// aggregateLevels walks a book from its best order and sums the orders at each
+// price until depth levels are complete. A depth of zero or less walks the whole book.
+func aggregateLevels(walk func(func(Transaction) bool), depth int) []PriceLevel {
+	levels := make([]PriceLevel, 0)
+	walk(func(order Transaction) bool {
+		if n := len(levels); n > 0 && levels[n-1].Price == order.Amount {
+			levels[n-1].Quantity += int64(order.Remaining())
+			levels[n-1].Orders++
+			return true
+		}
+		if depth > 0 && len(levels) == depth {
+			return false
+		}
+		levels = append(levels, PriceLevel{Price: order.Amount, Quantity: int64(order.Remaining()), Orders: 1})
+		return true
+	})
+	return levels
+}
+
+// levelKey identifies a price level of one side of the book
+type levelKey struct {
+	side  string
+	price TransactionAmtDataType
+}
+
+// bookLevels aggregates the resting orders of both books by price and collects the
+// levels changed since the last update was published. It is guarded by matchLock.
+type bookLevels struct {
+	bids map[TransactionAmtDataType]PriceLevel
+	asks map[TransactionAmtDataType]PriceLevel
+	// touched holds the state each changed level had when the last update was published
+	touched  map[levelKey]PriceLevel
+	sequence uint64
+}
+
+// newBookLevels creates empty price levels
+func newBookLevels() *bookLevels {
+	return &bookLevels{
+		bids:    make(map[TransactionAmtDataType]PriceLevel),
+		asks:    make(map[TransactionAmtDataType]PriceLevel),
+		touched: make(map[levelKey]PriceLevel),
+	}
+}
+
+// side returns the levels of the buy or sell side
+func (levels *bookLevels) side(side string) map[TransactionAmtDataType]PriceLevel {
+	if side == BuyTransactionType {
+		return levels.bids
+	}
+	return levels.asks
+}
+
+// adjust adds quantity and orders, either of which may be negative, to a price level
+func (levels *bookLevels) adjust(side string, price TransactionAmtDataType, quantity int64, orders int) {
+	book := levels.side(side)
+	level := book[price]
+
+	key := levelKey{side: side, price: price}
+	if _, ok := levels.touched[key]; !ok {
+		levels.touched[key] = level
+	}
+
+	level.Price = price
+	level.Quantity += quantity
+	level.Orders += orders
+	if level.Orders <= 0 {
+		delete(book, price)
+	} else {
+		book[price] = level
+	}
+}
+
+// flush returns the levels that changed since the last update under the next
+// sequence number. It returns false, without using a sequence number, if every
+// changed level is back to the state it was published in.
+func (levels *bookLevels) flush(symbol string, now time.Time) (BookUpdate, bool) {
+	changes := make([]LevelChange, 0, len(levels.touched))
+	for key, previous := range levels.touched {
+		current := levels.side(key.side)[key.price]
+		if current == previous {
+			continue
+		}
+
+		change := LevelChange{Side: key.side, Action: LevelChanged, PriceLevel: current}
+		switch {
+		case previous.Orders == 0:
+			change.Action = LevelAdded
+		case current.Orders == 0:
+			change.Action = LevelRemoved
+			change.Price = key.price
+		}
+		changes = append(changes, change)
+	}
+	levels.touched = make(map[levelKey]PriceLevel)
+
+	if len(changes) == 0 {
+		return BookUpdate{}, false
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Side != changes[j].Side {
+			return changes[i].Side < changes[j].Side
+		}
+		return changes[i].Price < changes[j].Price
+	})
+
+	levels.sequence++
+	return BookUpdate{
+		Symbol:    symbol,
+		Sequence:  levels.sequence,
+		Changes:   changes,
+		Timestamp: now,
+	}, true
+}
+
+// snapshot returns every price level sorted best price first
+func (levels *bookLevels) snapshot(symbol string, now time.Time) BookSnapshot {
+	bids := levelSlice(levels.bids)
+	sort.Slice(bids, func(i, j int) bool { return bids[i].Price > bids[j].Price })
+	asks := levelSlice(levels.asks)
+	sort.Slice(asks, func(i, j int) bool { return asks[i].Price < asks[j].Price })
+
+	return BookSnapshot{
+		Symbol:    symbol,
+		Sequence:  levels.sequence,
+		Bids:      bids,
+		Asks:      asks,
+		Timestamp: now,
+	}
+}
+
+// levelSlice copies the levels of one side into a slice
+func levelSlice(book map[TransactionAmtDataType]PriceLevel) []PriceLevel {
+	levels := make([]PriceLevel, 0, len(book))
+	for _, level := range book {
+		levels = append(levels, level)
+	}
+	return levels
+}
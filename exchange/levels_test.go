@@ -0,0 +1,161 @@
+package exchange
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBookUpdates(t *testing.T) {
+	exch := NewExchange(100)
+	var updates []BookUpdate
+	exch.RegisterBookUpdateCallback(func(update BookUpdate) {
+		updates = append(updates, update)
+	})
+
+	buy := func(id string, price TransactionAmtDataType, qty TransactionQtyDataType) Transaction {
+		txn := NewTransactionWithQuantity(BuyTransactionType, price, qty)
+		txn.ID = id
+		return txn
+	}
+	sell := func(id string, price TransactionAmtDataType, qty TransactionQtyDataType) Transaction {
+		txn := NewTransactionWithQuantity(SellTransactionType, price, qty)
+		txn.ID = id
+		return txn
+	}
+
+	tests := []struct {
+		name     string
+		action   func()
+		expected []LevelChange
+	}{
+		{
+			name:   "new bid level",
+			action: func() { exch.Submit(buy("B1", 99, 10)) },
+			expected: []LevelChange{
+				{Side: BuyTransactionType, Action: LevelAdded, PriceLevel: PriceLevel{Price: 99, Quantity: 10, Orders: 1}},
+			},
+		},
+		{
+			name:   "second order at the same price",
+			action: func() { exch.Submit(buy("B2", 99, 5)) },
+			expected: []LevelChange{
+				{Side: BuyTransactionType, Action: LevelChanged, PriceLevel: PriceLevel{Price: 99, Quantity: 15, Orders: 2}},
+			},
+		},
+		{
+			name:   "new ask level",
+			action: func() { exch.Submit(sell("S1", 101, 4)) },
+			expected: []LevelChange{
+				{Side: SellTransactionType, Action: LevelAdded, PriceLevel: PriceLevel{Price: 101, Quantity: 4, Orders: 1}},
+			},
+		},
+		{
+			name:   "sell fills one bid and partially fills another",
+			action: func() { exch.Submit(sell("S2", 99, 12)) },
+			expected: []LevelChange{
+				{Side: BuyTransactionType, Action: LevelChanged, PriceLevel: PriceLevel{Price: 99, Quantity: 3, Orders: 1}},
+			},
+		},
+		{
+			name:   "amend moves the bid to a new price",
+			action: func() { exch.AmendOrder("B2", 98, 5) },
+			expected: []LevelChange{
+				{Side: BuyTransactionType, Action: LevelAdded, PriceLevel: PriceLevel{Price: 98, Quantity: 3, Orders: 1}},
+				{Side: BuyTransactionType, Action: LevelRemoved, PriceLevel: PriceLevel{Price: 99}},
+			},
+		},
+		{
+			name:     "rejected order",
+			action:   func() { exch.Submit(buy("B3", 0, 1)) },
+			expected: nil,
+		},
+		{
+			name:   "cancel the last ask",
+			action: func() { exch.CancelOrder("S1") },
+			expected: []LevelChange{
+				{Side: SellTransactionType, Action: LevelRemoved, PriceLevel: PriceLevel{Price: 101}},
+			},
+		},
+	}
+
+	var sequence uint64
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			before := len(updates)
+			test.action()
+
+			if test.expected == nil {
+				if len(updates) != before {
+					t.Errorf("Expected no update, got %+v", updates[before:])
+				}
+				return
+			}
+			if len(updates) != before+1 {
+				t.Fatalf("Expected 1 update, got %d", len(updates)-before)
+			}
+			update := updates[before]
+			sequence++
+			if update.Sequence != sequence {
+				t.Errorf("Expected sequence %d, got %d", sequence, update.Sequence)
+			}
+			if !reflect.DeepEqual(update.Changes, test.expected) {
+				t.Errorf("Expected changes %+v, got %+v", test.expected, update.Changes)
+			}
+		})
+	}
+
+	snapshot := exch.GetBookSnapshot()
+	expected := []PriceLevel{{Price: 98, Quantity: 3, Orders: 1}}
+	if snapshot.Sequence != sequence || !reflect.DeepEqual(snapshot.Bids, expected) || len(snapshot.Asks) != 0 {
+		t.Errorf("Expected sequence %d with bids %+v and no asks, got %+v", sequence, expected, snapshot)
+	}
+}
+
+func TestGetDepth(t *testing.T) {
+	exch := NewExchange(100)
+	for _, order := range []struct {
+		side  string
+		price TransactionAmtDataType
+		qty   TransactionQtyDataType
+	}{
+		{BuyTransactionType, 98, 5},
+		{BuyTransactionType, 99, 10},
+		{BuyTransactionType, 98, 7},
+		{BuyTransactionType, 97, 1},
+		{SellTransactionType, 102, 4},
+		{SellTransactionType, 101, 3},
+		{SellTransactionType, 101, 2},
+	} {
+		exch.Submit(NewTransactionWithQuantity(order.side, order.price, order.qty))
+	}
+
+	bids := []PriceLevel{{Price: 99, Quantity: 10, Orders: 1}, {Price: 98, Quantity: 12, Orders: 2}, {Price: 97, Quantity: 1, Orders: 1}}
+	asks := []PriceLevel{{Price: 101, Quantity: 5, Orders: 2}, {Price: 102, Quantity: 4, Orders: 1}}
+
+	tests := []struct {
+		depth        int
+		expectedBids []PriceLevel
+		expectedAsks []PriceLevel
+	}{
+		{0, bids, asks},
+		{1, bids[:1], asks[:1]},
+		{2, bids[:2], asks},
+		{10, bids, asks},
+	}
+
+	for _, test := range tests {
+		depth := exch.GetDepth(test.depth)
+		if !reflect.DeepEqual(depth.Bids, test.expectedBids) {
+			t.Errorf("Depth %d: expected bids %+v, got %+v", test.depth, test.expectedBids, depth.Bids)
+		}
+		if !reflect.DeepEqual(depth.Asks, test.expectedAsks) {
+			t.Errorf("Depth %d: expected asks %+v, got %+v", test.depth, test.expectedAsks, depth.Asks)
+		}
+	}
+
+	// The order book lists orders at the same price in time priority
+	orderBook := exch.GetOrderBook()
+	if len(orderBook.BuyOrders) != 4 || orderBook.BuyOrders[1].Quantity != 5 || orderBook.BuyOrders[2].Quantity != 7 {
+		t.Errorf("Expected the bids at 98 in arrival order, got %+v", orderBook.BuyOrders)
+	}
+}
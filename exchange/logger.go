@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"time"
 )
 
 // LogLevel represents the severity level of a log message
@@ -28,6 +27,8 @@ type Logger struct {
 	component string
 	logger    *log.Logger
 	level     LogLevel
+	// clock stamps every message
+	clock Clock
 }
 
 // NewLogger creates a new logger for a specific component
@@ -36,6 +37,7 @@ func NewLogger(component string) *Logger {
 		component: component,
 		logger:    log.New(os.Stdout, "", 0),
 		level:     INFO, // Default log level
+		clock:     RealClock,
 	}
 }
 
@@ -44,6 +46,11 @@ func (l *Logger) SetLevel(level LogLevel) {
 	l.level = level
 }
 
+// SetClock sets the clock that stamps messages
+func (l *Logger) SetClock(clock Clock) {
+	l.clock = clock
+}
+
 // formatMessage formats a log message with timestamp, level, and component
 func (l *Logger) formatMessage(level LogLevel, message string) string {
 	levelStr := "UNKNOWN"
@@ -60,7 +67,7 @@ func (l *Logger) formatMessage(level LogLevel, message string) string {
 		levelStr = "FATAL"
 	}
 
-	timestamp := time.Now().Format("2006-01-02 15:04:05.000")
+	timestamp := l.clock.Now().Format("2006-01-02 15:04:05.000")
 	return fmt.Sprintf("[%s] [%s] [%s] %s", timestamp, levelStr, l.component, message)
 }
 
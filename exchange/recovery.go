@@ -0,0 +1,308 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+)
+
+// ErrReplayDiverged is returned when replaying the journal does not reproduce the
+// trades or the state checksums it recorded
+var ErrReplayDiverged = errors.New("replay diverged from the journal")
+
+// RecoveryOptions configures how the registry is recovered from its journal
+type RecoveryOptions struct {
+	Journal JournalOptions
+	// TruncateCorruptTail drops a damaged record and everything after it instead of
+	// refusing to recover from a corrupted journal
+	TruncateCorruptTail bool
+	// SnapshotDir holds the snapshots to start from, if set, so only the journal
+	// events after the latest snapshot are replayed
+	SnapshotDir string
+}
+
+// Recovery summarizes the events replayed from a journal
+type Recovery struct {
+	Events      int
+	Accounts    int
+	Orders      int
+	Trades      int
+	Checkpoints int
+	// Unjournaled holds the trades the replay reproduced that were not in the journal,
+	// because the process stopped between journaling an order and its executions
+	Unjournaled []Trade
+	// TruncatedBytes is the length of the damaged tail dropped from the journal
+	TruncatedBytes int64
+	// Snapshot is the journal sequence number of the snapshot the state was loaded
+	// from, or zero if every event was replayed
+	Snapshot uint64
+}
+
+// Recover rebuilds the accounts, books, Last Traded Prices, trade tapes and candles of
+// the registry by replaying the journal at path, starting from the latest snapshot in
+// options.SnapshotDir if there is one, then opens the journal so new events continue
+// it and attaches it to the registry. A journal with a damaged record is refused
+// unless options.TruncateCorruptTail is set. It must be called after every instrument
+// has been added and before accounts are opened or Start is called.
+func (reg *InstrumentRegistry) Recover(path string, options RecoveryOptions) (*Journal, Recovery, error) {
+	var snapshot *Snapshot
+	var sequence uint64
+	var offset int64
+	if options.SnapshotDir != "" {
+		// A snapshot of events that are no longer in the journal is not used
+		var err error
+		snapshot, err = loadSnapshot(options.SnapshotDir, func(snapshot *Snapshot) bool {
+			return continuesAt(path, snapshot.Sequence, snapshot.Offset)
+		})
+		if err != nil {
+			return nil, Recovery{}, err
+		}
+	}
+	if snapshot != nil {
+		sequence, offset = snapshot.Sequence, snapshot.Offset
+	}
+
+	// Only the journal after the snapshot is read
+	var truncated int64
+	events, end, err := readJournalFrom(path, offset)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case errors.Is(err, ErrJournalCorrupted) && options.TruncateCorruptTail:
+		if truncated, err = truncateJournalAt(path, end); err != nil {
+			return nil, Recovery{}, err
+		}
+	case err != nil:
+		return nil, Recovery{}, err
+	}
+	if len(events) > 0 {
+		sequence = events[len(events)-1].Sequence
+	}
+
+	if snapshot != nil {
+		if err := reg.restoreSnapshot(snapshot); err != nil {
+			return nil, Recovery{}, err
+		}
+	}
+
+	recovery, err := reg.Replay(events)
+	recovery.TruncatedBytes = truncated
+	if snapshot != nil {
+		recovery.Snapshot = snapshot.Sequence
+	}
+	if err != nil {
+		return nil, recovery, err
+	}
+
+	journal, err := openJournal(path, options.Journal.withDefaults(), sequence)
+	if err != nil {
+		return nil, recovery, err
+	}
+	// Journal the executions that were lost so later events do not precede them
+	for _, trade := range recovery.Unjournaled {
+		trade := trade
+		event := JournalEvent{Type: JournalTrade, Time: trade.Timestamp, Symbol: trade.Symbol, Trade: &trade}
+		if _, err := journal.Append(event); err != nil {
+			journal.Close()
+			return nil, recovery, err
+		}
+	}
+	reg.SetJournal(journal)
+	return journal, recovery, nil
+}
+
+// Replay applies journaled events to the registry in order. Orders are placed with
+// the priority they were given without being validated or risk checked again, since
+// only accepted orders are journaled. Every execution the replay produces is checked
+// against the next journaled trade of its symbol, whose timestamp is kept, and every
+// checkpoint against the state it recorded. Replay must be called before a journal
+// is attached, otherwise the events would be journaled again.
+func (reg *InstrumentRegistry) Replay(events []JournalEvent) (Recovery, error) {
+	logger := reg.newLogger("Replay")
+	logger.SetLevel(WARN)
+
+	exchanges := reg.Exchanges()
+	for _, exch := range exchanges {
+		exch.matchLock.Lock()
+		exch.replaying = true
+		exch.matchLock.Unlock()
+	}
+
+	recovery := Recovery{Events: len(events)}
+	var err error
+	for _, event := range events {
+		if err = reg.replayEvent(event, &recovery, logger); err != nil {
+			err = fmt.Errorf("journal event %d: %w", event.Sequence, err)
+			break
+		}
+	}
+
+	for _, exch := range exchanges {
+		recovery.Unjournaled = append(recovery.Unjournaled, exch.endReplay()...)
+	}
+	return recovery, err
+}
+
+// replayEvent applies one journaled event to the account or exchange it belongs to
+func (reg *InstrumentRegistry) replayEvent(event JournalEvent, recovery *Recovery, logger *Logger) error {
+	if event.Type == JournalAccount {
+		recovery.Accounts++
+		return reg.accounts.Open(event.AccountID, event.Cash)
+	}
+
+	exch, ok := reg.Get(event.Symbol)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownSymbol, event.Symbol)
+	}
+
+	exch.matchLock.Lock()
+	defer exch.matchLock.Unlock()
+	defer exch.publishBookUpdate()
+
+	switch event.Type {
+	case JournalOrder:
+		recovery.Orders++
+		return exch.replayOrder(event, logger)
+	case JournalCancel:
+		return exch.replayCancel(event)
+	case JournalAmend:
+		return exch.replayAmend(event, logger)
+	case JournalMatch:
+		exch.matchBooks(logger)
+		return nil
+	case JournalTrade:
+		recovery.Trades++
+		return exch.replayTrade(event)
+	case JournalCheckpoint:
+		recovery.Checkpoints++
+		if checksum := exch.stateChecksum(); checksum != event.Checksum {
+			return fmt.Errorf("%w: %s state checksum is %08x, journal recorded %08x",
+				ErrReplayDiverged, exch.Symbol, checksum, event.Checksum)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: unknown event type %q", ErrJournalCorrupted, event.Type)
+}
+
+// replayOrder places a journaled order with its recorded priority.
+// The caller must hold matchLock.
+func (exch *Exchange) replayOrder(event JournalEvent, logger *Logger) error {
+	txn := event.Transaction()
+	if txn.Seq <= exch.nextSeq {
+		return fmt.Errorf("%w: order %s has priority %d after priority %d",
+			ErrReplayDiverged, txn.ID, txn.Seq, exch.nextSeq)
+	}
+	exch.nextSeq = txn.Seq
+	exch.place(txn, logger)
+	return nil
+}
+
+// replayCancel cancels a journaled order. The caller must hold matchLock.
+func (exch *Exchange) replayCancel(event JournalEvent) error {
+	txn, ok := exch.orders[event.OrderID]
+	if !ok {
+		return fmt.Errorf("%w: cancelled order %s is not resting", ErrReplayDiverged, event.OrderID)
+	}
+	exch.unrest(txn)
+	exch.recordOrder(newOrderReport(txn, txn.Remaining()))
+	return nil
+}
+
+// replayAmend amends a journaled order, giving it its recorded priority if the
+// amendment moved it to the back of the queue. The caller must hold matchLock.
+func (exch *Exchange) replayAmend(event JournalEvent, logger *Logger) error {
+	txn, ok := exch.orders[event.OrderID]
+	if !ok {
+		return fmt.Errorf("%w: amended order %s is not resting", ErrReplayDiverged, event.OrderID)
+	}
+
+	keepsPriority := event.Price == txn.Amount && event.Quantity <= txn.Quantity
+	if keepsPriority != (event.OrderSeq == 0) || (!keepsPriority && event.OrderSeq <= exch.nextSeq) {
+		return fmt.Errorf("%w: amendment of order %s has priority %d after priority %d",
+			ErrReplayDiverged, event.OrderID, event.OrderSeq, exch.nextSeq)
+	}
+	if !keepsPriority {
+		exch.nextSeq = event.OrderSeq - 1
+	}
+	exch.amend(txn, event.Price, event.Quantity, logger)
+	return nil
+}
+
+// replayTrade checks a journaled trade against the oldest execution the replay
+// produced and records it. The caller must hold matchLock.
+func (exch *Exchange) replayTrade(event JournalEvent) error {
+	if event.Trade == nil {
+		return fmt.Errorf("%w: trade event without a trade", ErrJournalCorrupted)
+	}
+	recorded := *event.Trade
+	if len(exch.replayed) == 0 {
+		return fmt.Errorf("%w: trade %s was not reproduced", ErrReplayDiverged, recorded.ID)
+	}
+
+	trade := exch.replayed[0]
+	exch.replayed = exch.replayed[1:]
+	trade.Timestamp = recorded.Timestamp
+	if trade != recorded {
+		return fmt.Errorf("%w: reproduced trade %+v, journal recorded %+v", ErrReplayDiverged, trade, recorded)
+	}
+	exch.recordTrade(recorded)
+	return nil
+}
+
+// endReplay stops replaying and records the executions that had no journaled
+// trade, returning them
+func (exch *Exchange) endReplay() []Trade {
+	exch.matchLock.Lock()
+	defer exch.matchLock.Unlock()
+
+	unjournaled := exch.replayed
+	for _, trade := range unjournaled {
+		exch.recordTrade(trade)
+	}
+	exch.replaying = false
+	exch.replayed = nil
+	return unjournaled
+}
+
+// Checkpoint journals a checksum of every instrument's state, which a replay of the
+// journal must reproduce
+func (reg *InstrumentRegistry) Checkpoint() error {
+	for _, exch := range reg.Exchanges() {
+		if err := exch.Checkpoint(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Checkpoint journals a checksum of the exchange's books, Last Traded Price and
+// sequence numbers, which a replay of the journal must reproduce
+func (exch *Exchange) Checkpoint() error {
+	exch.matchLock.Lock()
+	defer exch.matchLock.Unlock()
+
+	return exch.journalEvent(JournalEvent{Type: JournalCheckpoint, Checksum: exch.stateChecksum()})
+}
+
+// StateChecksum returns a CRC-32 checksum of the exchange's books, Last Traded Price
+// and sequence numbers. Exchanges that processed the same events have the same checksum.
+func (exch *Exchange) StateChecksum() uint32 {
+	exch.matchLock.Lock()
+	defer exch.matchLock.Unlock()
+
+	return exch.stateChecksum()
+}
+
+// stateChecksum hashes every resting order in priority order. The caller must hold matchLock.
+func (exch *Exchange) stateChecksum() uint32 {
+	hash := crc32.NewIEEE()
+	fmt.Fprintf(hash, "%s %d %d %d\n", exch.Symbol, exch.LastTradedPrice, exch.nextSeq, exch.nextTradeSeq)
+	visit := func(txn Transaction) bool {
+		fmt.Fprintf(hash, "%s %s %s %s %d %d %d %d\n",
+			txn.ID, txn.AccountID, txn.Type, txn.OrderType, txn.Amount, txn.Quantity, txn.Filled, txn.Seq)
+		return true
+	}
+	exch.BuyQ.Descend(visit)
+	exch.SellQ.Ascend(visit)
+	return hash.Sum32()
+}
@@ -0,0 +1,259 @@
+package exchange
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// journalSession trades on a journaled registry and closes the journal, as if the process had stopped
+func journalSession(t *testing.T, path string) *InstrumentRegistry {
+	registry := NewInstrumentRegistry()
+	registry.Add("AAPL", 100)
+	registry.Add("MSFT", 200)
+	journal, _, err := registry.Recover(path, RecoveryOptions{Journal: JournalOptions{Sync: SyncNever}})
+	if err != nil {
+		t.Fatalf("Failed to recover: %v", err)
+	}
+	registry.Accounts().Open("alice", 10000)
+
+	orders := []Transaction{
+		{ID: "S1", Symbol: "AAPL", Type: SellTransactionType, Amount: 101, Quantity: 5},
+		{ID: "S2", Symbol: "AAPL", Type: SellTransactionType, Amount: 102, Quantity: 5},
+		{ID: "B1", Symbol: "AAPL", AccountID: "alice", Type: BuyTransactionType, Amount: 102, Quantity: 7},
+		{ID: "B2", Symbol: "MSFT", Type: BuyTransactionType, Amount: 199, Quantity: 3},
+		{ID: "S3", Symbol: "MSFT", Type: SellTransactionType, Amount: 205, Quantity: 4},
+		{ID: "B3", Symbol: "AAPL", Type: BuyTransactionType, Amount: 100, Quantity: 2},
+	}
+	for _, order := range orders {
+		registry.Submit(order)
+	}
+	aapl, _ := registry.Get("AAPL")
+	msft, _ := registry.Get("MSFT")
+	aapl.AmendOrder("B3", 100, 1)
+	msft.AmendOrder("S3", 199, 4)
+	aapl.CancelOrder("S2")
+	if err := registry.Checkpoint(); err != nil {
+		t.Fatalf("Failed to checkpoint: %v", err)
+	}
+	journal.Close()
+	return registry
+}
+
+func TestRecover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.log")
+	original := journalSession(t, path)
+
+	recovered := NewInstrumentRegistry()
+	recovered.Add("AAPL", 100)
+	recovered.Add("MSFT", 200)
+	journal, recovery, err := recovered.Recover(path, RecoveryOptions{Journal: JournalOptions{Sync: SyncNever}})
+	if err != nil {
+		t.Fatalf("Failed to recover: %v", err)
+	}
+	defer journal.Close()
+
+	if recovery.Accounts != 1 || recovery.Orders != 6 || recovery.Trades != 3 || recovery.Checkpoints != 2 || len(recovery.Unjournaled) != 0 {
+		t.Errorf("Expected 1 account, 6 orders, 3 trades and 2 checkpoints, got %+v", recovery)
+	}
+
+	for _, symbol := range []string{"AAPL", "MSFT"} {
+		before, _ := original.Get(symbol)
+		after, _ := recovered.Get(symbol)
+		if before.StateChecksum() != after.StateChecksum() {
+			t.Errorf("%s: expected state checksum %08x, got %08x", symbol, before.StateChecksum(), after.StateChecksum())
+		}
+		if after.LastTradedPrice != before.LastTradedPrice {
+			t.Errorf("%s: expected LTP %d, got %d", symbol, before.LastTradedPrice, after.LastTradedPrice)
+		}
+		beforeDepth, afterDepth := before.GetDepth(0), after.GetDepth(0)
+		if !reflect.DeepEqual(afterDepth.Bids, beforeDepth.Bids) || !reflect.DeepEqual(afterDepth.Asks, beforeDepth.Asks) {
+			t.Errorf("%s: expected depth %+v, got %+v", symbol, beforeDepth, afterDepth)
+		}
+		// Trades keep their journaled timestamps
+		beforeTrades, afterTrades := before.GetTrades(0), after.GetTrades(0)
+		if len(afterTrades) != len(beforeTrades) {
+			t.Fatalf("%s: expected %d trades, got %d", symbol, len(beforeTrades), len(afterTrades))
+		}
+		for i := range afterTrades {
+			if afterTrades[i].ID != beforeTrades[i].ID || !afterTrades[i].Timestamp.Equal(beforeTrades[i].Timestamp) {
+				t.Errorf("%s: expected trade %+v, got %+v", symbol, beforeTrades[i], afterTrades[i])
+			}
+		}
+		if candles := after.GetCandles(Interval1h, time.Time{}, time.Time{}); len(candles) != 1 || candles[0].Trades != len(beforeTrades) {
+			t.Errorf("%s: expected one hourly candle of %d trades, got %+v", symbol, len(beforeTrades), candles)
+		}
+	}
+
+	beforeSummary, _ := original.AccountSummary("alice")
+	afterSummary, err := recovered.AccountSummary("alice")
+	if err != nil || !reflect.DeepEqual(afterSummary, beforeSummary) {
+		t.Errorf("Expected account %+v, got %+v (%v)", beforeSummary, afterSummary, err)
+	}
+	if orders, _ := recovered.Accounts().Orders("alice"); len(orders) != 1 || orders[0].Status != OrderStatusFilled {
+		t.Errorf("Expected alice's filled order to be recovered, got %+v", orders)
+	}
+
+	// New events continue the journal and priorities continue the recovered ones
+	report, _ := recovered.Submit(Transaction{ID: "B4", Symbol: "AAPL", Type: BuyTransactionType, Amount: 95, Quantity: 1})
+	if report.Status != OrderStatusNew {
+		t.Fatalf("Expected B4 to rest, got %+v", report)
+	}
+	aapl, _ := recovered.Get("AAPL")
+	if order, _ := aapl.GetOrder("B4"); order.Seq != 5 {
+		t.Errorf("Expected B4 to have priority 5, got %d", order.Seq)
+	}
+	if journal.Sequence() != uint64(recovery.Events+1) {
+		t.Errorf("Expected the journal to continue at %d, got %d", recovery.Events+1, journal.Sequence())
+	}
+}
+
+func TestRecoverCorruptedTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.log")
+	journalSession(t, path)
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+	file.WriteString("0badc0de {\"seq\":")
+	file.Close()
+
+	registry := NewInstrumentRegistry()
+	registry.Add("AAPL", 100)
+	registry.Add("MSFT", 200)
+	if _, _, err := registry.Recover(path, RecoveryOptions{}); !errors.Is(err, ErrJournalCorrupted) {
+		t.Fatalf("Expected ErrJournalCorrupted, got %v", err)
+	}
+
+	journal, recovery, err := registry.Recover(path, RecoveryOptions{TruncateCorruptTail: true})
+	if err != nil {
+		t.Fatalf("Failed to recover with truncation: %v", err)
+	}
+	journal.Close()
+	if recovery.TruncatedBytes != int64(len("0badc0de {\"seq\":")) {
+		t.Errorf("Expected the torn record to be truncated, got %d bytes", recovery.TruncatedBytes)
+	}
+	if _, err := ReadJournal(path); err != nil {
+		t.Errorf("Expected an intact journal after truncation, got %v", err)
+	}
+}
+
+func TestReplayDivergence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.log")
+	journalSession(t, path)
+	events, err := ReadJournal(path)
+	if err != nil {
+		t.Fatalf("Failed to read journal: %v", err)
+	}
+
+	index := func(eventType JournalEventType) int {
+		for i, event := range events {
+			if event.Type == eventType {
+				return i
+			}
+		}
+		t.Fatalf("No %s event in the journal", eventType)
+		return 0
+	}
+
+	tests := []struct {
+		name     string
+		tamper   func(events []JournalEvent) []JournalEvent
+		expected error
+	}{
+		{"Changed Trade Price", func(events []JournalEvent) []JournalEvent {
+			trade := *events[index(JournalTrade)].Trade
+			trade.Price++
+			events[index(JournalTrade)].Trade = &trade
+			return events
+		}, ErrReplayDiverged},
+		{"Changed Checkpoint", func(events []JournalEvent) []JournalEvent {
+			events[index(JournalCheckpoint)].Checksum++
+			return events
+		}, ErrReplayDiverged},
+		{"Missing Order", func(events []JournalEvent) []JournalEvent {
+			i := index(JournalOrder)
+			return append(events[:i], events[i+1:]...)
+		}, ErrReplayDiverged},
+		{"Unknown Symbol", func(events []JournalEvent) []JournalEvent {
+			events[index(JournalOrder)].Symbol = "TSLA"
+			return events
+		}, ErrUnknownSymbol},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tampered := test.tamper(append([]JournalEvent(nil), events...))
+			registry := NewInstrumentRegistry()
+			registry.Add("AAPL", 100)
+			registry.Add("MSFT", 200)
+			if _, err := registry.Replay(tampered); !errors.Is(err, test.expected) {
+				t.Errorf("Expected %v, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestReplayUnjournaledTrades(t *testing.T) {
+	// The process stopped after journaling the crossing order but before its trade
+	events := []JournalEvent{
+		{Sequence: 1, Type: JournalOrder, Symbol: "SIM", OrderID: "S1", Side: SellTransactionType, Price: 101, Quantity: 5, OrderSeq: 1},
+		{Sequence: 2, Type: JournalOrder, Symbol: "SIM", OrderID: "B1", Side: BuyTransactionType, Price: 101, Quantity: 2, OrderSeq: 2},
+	}
+	path := filepath.Join(t.TempDir(), "journal.log")
+	journal, _ := OpenJournal(path, JournalOptions{Sync: SyncNever})
+	for _, event := range events {
+		journal.Append(event)
+	}
+	journal.Close()
+
+	registry := NewInstrumentRegistry()
+	registry.Add("SIM", 100)
+	journal, recovery, err := registry.Recover(path, RecoveryOptions{})
+	if err != nil {
+		t.Fatalf("Failed to recover: %v", err)
+	}
+	journal.Close()
+
+	if len(recovery.Unjournaled) != 1 || recovery.Unjournaled[0].Quantity != 2 {
+		t.Fatalf("Expected the trade of 2 to be reproduced, got %+v", recovery.Unjournaled)
+	}
+	exch := registry.Default()
+	if exch.LastTradedPrice != 101 || len(exch.GetTrades(0)) != 1 {
+		t.Errorf("Expected the reproduced trade at 101 on the tape, got LTP %d and %+v", exch.LastTradedPrice, exch.GetTrades(0))
+	}
+
+	// The reproduced trade is journaled so the next recovery finds it in order
+	recorded, _ := ReadJournal(path)
+	if len(recorded) != 3 || recorded[2].Type != JournalTrade || recorded[2].Trade.ID != recovery.Unjournaled[0].ID {
+		t.Errorf("Expected the reproduced trade to be journaled, got %+v", recorded)
+	}
+}
+
+func TestReplayBatchMatching(t *testing.T) {
+	events := []JournalEvent{
+		{Sequence: 1, Type: JournalOrder, Symbol: "SIM", OrderID: "B1", Side: BuyTransactionType, Price: 102, Quantity: 3, OrderSeq: 1},
+		{Sequence: 2, Type: JournalOrder, Symbol: "SIM", OrderID: "S1", Side: SellTransactionType, Price: 101, Quantity: 5, OrderSeq: 2},
+		{Sequence: 3, Type: JournalMatch, Symbol: "SIM"},
+	}
+
+	registry := NewInstrumentRegistry()
+	exch, _ := registry.Add("SIM", 100)
+	exch.SetMatchingMode(BatchMatching)
+	recovery, err := registry.Replay(events)
+	if err != nil {
+		t.Fatalf("Failed to replay: %v", err)
+	}
+
+	// Only the match event executes the resting orders
+	if len(recovery.Unjournaled) != 1 || recovery.Unjournaled[0].Price != 102 || recovery.Unjournaled[0].Aggressor != SellTransactionType {
+		t.Errorf("Expected a sell-aggressed trade at 102, got %+v", recovery.Unjournaled)
+	}
+	if order, ok := exch.GetOrder("S1"); !ok || order.Remaining() != 2 {
+		t.Errorf("Expected 2 of S1 to rest, got %+v", order)
+	}
+}
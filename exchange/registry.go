@@ -0,0 +1,273 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultSymbol is the instrument traded by an exchange created without a symbol
+const DefaultSymbol = "SIM"
+
+// maxSymbolLength is the longest symbol accepted by the registry
+const maxSymbolLength = 12
+
+var (
+	// ErrUnknownSymbol is returned when no instrument is registered for a symbol
+	ErrUnknownSymbol = errors.New("unknown symbol")
+	// ErrInvalidSymbol is returned when a symbol contains characters other than A-Z, 0-9 and '.'
+	ErrInvalidSymbol = errors.New("invalid symbol")
+	// ErrDuplicateSymbol is returned when a symbol is registered twice
+	ErrDuplicateSymbol = errors.New("symbol already registered")
+	// ErrAccountsConflict is returned when an exchange registered with accounts of its
+	// own would split the accounts of the registry's other instruments
+	ErrAccountsConflict = errors.New("exchange has accounts of its own")
+)
+
+// InstrumentRegistry holds one exchange per traded symbol, each with its own
+// order books, Last Traded Price, matching goroutine and callbacks
+type InstrumentRegistry struct {
+	exchanges     map[string]*Exchange
+	defaultSymbol string
+	// accounts is shared by every instrument so positions in all symbols are tracked together
+	accounts *AccountManager
+	// journal is shared by every instrument so events of all symbols are recorded in one sequence
+	journal *Journal
+	// clock is the clock of every instrument
+	clock Clock
+	mutex sync.RWMutex
+}
+
+// NewInstrumentRegistry creates an empty instrument registry
+func NewInstrumentRegistry() *InstrumentRegistry {
+	return &InstrumentRegistry{
+		exchanges: make(map[string]*Exchange),
+		accounts:  NewAccountManager(),
+		clock:     RealClock,
+	}
+}
+
+// NormalizeSymbol returns the canonical upper case form of a symbol
+func NormalizeSymbol(symbol string) string {
+	return strings.ToUpper(strings.TrimSpace(symbol))
+}
+
+// validateSymbol checks that a normalized symbol is safe to use in routes and logs
+func validateSymbol(symbol string) error {
+	if symbol == "" || len(symbol) > maxSymbolLength {
+		return fmt.Errorf("%w: %q", ErrInvalidSymbol, symbol)
+	}
+	for _, c := range symbol {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '.' {
+			return fmt.Errorf("%w: %q", ErrInvalidSymbol, symbol)
+		}
+	}
+	return nil
+}
+
+// Add creates and registers an exchange for a new symbol with the given initial Last Traded Price
+func (reg *InstrumentRegistry) Add(symbol string, ltp TransactionAmtDataType) (*Exchange, error) {
+	exch := NewExchange(ltp)
+	exch.Symbol = NormalizeSymbol(symbol)
+	if err := reg.Register(&exch); err != nil {
+		return nil, err
+	}
+	return &exch, nil
+}
+
+// Register adds an existing exchange under its symbol and attaches the registry's
+// accounts and journal to it. The first registered instrument becomes the default one.
+// An exchange that already has accounts keeps them, and the registry adopts them if it
+// is the first instrument; otherwise it is refused with ErrAccountsConflict.
+func (reg *InstrumentRegistry) Register(exch *Exchange) error {
+	symbol := NormalizeSymbol(exch.Symbol)
+	if err := validateSymbol(symbol); err != nil {
+		return err
+	}
+	exch.Symbol = symbol
+
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+
+	if _, exists := reg.exchanges[symbol]; exists {
+		return fmt.Errorf("%w: %s", ErrDuplicateSymbol, symbol)
+	}
+	if accounts := exch.Accounts(); accounts == nil {
+		exch.SetAccounts(reg.accounts)
+	} else if accounts != reg.accounts {
+		if len(reg.exchanges) > 0 {
+			return fmt.Errorf("%w: %s", ErrAccountsConflict, symbol)
+		}
+		reg.accounts = accounts
+	}
+	reg.exchanges[symbol] = exch
+	if reg.journal != nil {
+		exch.SetJournal(reg.journal)
+	}
+	if reg.clock != RealClock {
+		exch.SetClock(reg.clock)
+	}
+	if reg.defaultSymbol == "" {
+		reg.defaultSymbol = symbol
+	}
+	return nil
+}
+
+// Get returns the exchange for a symbol
+func (reg *InstrumentRegistry) Get(symbol string) (*Exchange, bool) {
+	reg.mutex.RLock()
+	defer reg.mutex.RUnlock()
+
+	exch, ok := reg.exchanges[NormalizeSymbol(symbol)]
+	return exch, ok
+}
+
+// Default returns the first registered exchange, or nil if the registry is empty
+func (reg *InstrumentRegistry) Default() *Exchange {
+	reg.mutex.RLock()
+	defer reg.mutex.RUnlock()
+
+	return reg.exchanges[reg.defaultSymbol]
+}
+
+// Symbols returns every registered symbol in alphabetical order
+func (reg *InstrumentRegistry) Symbols() []string {
+	reg.mutex.RLock()
+	defer reg.mutex.RUnlock()
+
+	symbols := make([]string, 0, len(reg.exchanges))
+	for symbol := range reg.exchanges {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// Exchanges returns every registered exchange ordered by symbol
+func (reg *InstrumentRegistry) Exchanges() []*Exchange {
+	symbols := reg.Symbols()
+
+	reg.mutex.RLock()
+	defer reg.mutex.RUnlock()
+
+	exchanges := make([]*Exchange, 0, len(symbols))
+	for _, symbol := range symbols {
+		exchanges = append(exchanges, reg.exchanges[symbol])
+	}
+	return exchanges
+}
+
+// Accounts returns the accounts trading on the registry's instruments
+func (reg *InstrumentRegistry) Accounts() *AccountManager {
+	return reg.accounts
+}
+
+// AccountSummary returns an account's cash and positions marked to the Last
+// Traded Price of each instrument
+func (reg *InstrumentRegistry) AccountSummary(id string) (AccountSummary, error) {
+	marks := make(map[string]TransactionAmtDataType)
+	for _, exch := range reg.Exchanges() {
+		marks[exch.Symbol] = exch.LastTradedPrice
+	}
+	return reg.accounts.Summary(id, marks)
+}
+
+// SetJournal records the accounts and the events of every instrument, including those
+// registered later, in one journal. It must be called before accounts are opened and before Start.
+func (reg *InstrumentRegistry) SetJournal(journal *Journal) {
+	reg.mutex.Lock()
+	reg.journal = journal
+	reg.mutex.Unlock()
+
+	reg.accounts.SetJournal(journal)
+	for _, exch := range reg.Exchanges() {
+		exch.SetJournal(journal)
+	}
+}
+
+// Journal returns the journal the registry records events in, or nil if it has none
+func (reg *InstrumentRegistry) Journal() *Journal {
+	reg.mutex.RLock()
+	defer reg.mutex.RUnlock()
+
+	return reg.journal
+}
+
+// SetClock sets the clock of every instrument, including those registered later.
+// It must be called before Start.
+func (reg *InstrumentRegistry) SetClock(clock Clock) {
+	reg.mutex.Lock()
+	reg.clock = clock
+	reg.mutex.Unlock()
+
+	for _, exch := range reg.Exchanges() {
+		exch.SetClock(clock)
+	}
+}
+
+// Clock returns the clock of the registry's instruments
+func (reg *InstrumentRegistry) Clock() Clock {
+	reg.mutex.RLock()
+	defer reg.mutex.RUnlock()
+
+	return reg.clock
+}
+
+// newLogger creates a logger whose messages are stamped by the registry's clock
+func (reg *InstrumentRegistry) newLogger(component string) *Logger {
+	logger := NewLogger(component)
+	logger.SetClock(reg.Clock())
+	return logger
+}
+
+// AddRiskCheck appends a pre-trade check to the chain of every registered instrument.
+// It must be called before Start.
+func (reg *InstrumentRegistry) AddRiskCheck(check RiskCheck) {
+	for _, exch := range reg.Exchanges() {
+		exch.AddRiskCheck(check)
+	}
+}
+
+// Start launches the order acceptance and trade processing goroutines of every instrument
+func (reg *InstrumentRegistry) Start() {
+	for _, exch := range reg.Exchanges() {
+		go exch.ProcessTrades()
+		go exch.AcceptTrades()
+	}
+}
+
+// Submit processes an order synchronously on its symbol's exchange and returns its
+// report. Orders without a symbol go to the default instrument.
+func (reg *InstrumentRegistry) Submit(txn Transaction) (OrderReport, error) {
+	exch := reg.Default()
+	if txn.Symbol != "" {
+		exch, _ = reg.Get(txn.Symbol)
+	}
+	if exch == nil {
+		rejection := reject(RejectUnknownSymbol, "unknown symbol: %s", txn.Symbol)
+		return newRejectedReport(txn, rejection), rejection
+	}
+
+	txn.Symbol = exch.Symbol
+	return exch.Submit(txn)
+}
+
+// Route sends an order to the incoming queue of its symbol's exchange.
+// Orders without a symbol go to the default instrument.
+func (reg *InstrumentRegistry) Route(txn Transaction) error {
+	var exch *Exchange
+	if txn.Symbol == "" {
+		exch = reg.Default()
+	} else {
+		exch, _ = reg.Get(txn.Symbol)
+	}
+	if exch == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownSymbol, txn.Symbol)
+	}
+
+	txn.Symbol = exch.Symbol
+	exch.IncomingTrades <- txn
+	return nil
+}
@@ -0,0 +1,139 @@
+package exchange
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInstrumentRegistry(t *testing.T) {
+	reg := NewInstrumentRegistry()
+
+	if reg.Default() != nil {
+		t.Errorf("Expected an empty registry to have no default exchange")
+	}
+
+	aapl, err := reg.Add("aapl", 150)
+	if err != nil {
+		t.Fatalf("Expected AAPL to be added, got %v", err)
+	}
+	if aapl.Symbol != "AAPL" {
+		t.Errorf("Expected symbol to be normalized to AAPL, got %s", aapl.Symbol)
+	}
+	if _, err := reg.Add("MSFT", 300); err != nil {
+		t.Fatalf("Expected MSFT to be added, got %v", err)
+	}
+
+	testCases := []struct {
+		name        string
+		symbol      string
+		expectedErr error
+	}{
+		{"Duplicate Symbol", "AAPL", ErrDuplicateSymbol},
+		{"Empty Symbol", "", ErrInvalidSymbol},
+		{"Symbol With Slash", "A/B", ErrInvalidSymbol},
+		{"Symbol Too Long", "ABCDEFGHIJKLM", ErrInvalidSymbol},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := reg.Add(tc.symbol, 100); !errors.Is(err, tc.expectedErr) {
+				t.Errorf("Expected %v, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+
+	if reg.Default() != aapl {
+		t.Errorf("Expected the first registered instrument to be the default")
+	}
+	if symbols := reg.Symbols(); len(symbols) != 2 || symbols[0] != "AAPL" || symbols[1] != "MSFT" {
+		t.Errorf("Expected symbols [AAPL MSFT], got %v", symbols)
+	}
+	if msft, ok := reg.Get("msft"); !ok || msft.LastTradedPrice != 300 {
+		t.Errorf("Expected to look up MSFT case-insensitively")
+	}
+}
+
+func TestRegisterExchangeWithAccounts(t *testing.T) {
+	accounts := NewAccountManager()
+	first := NewExchange(100)
+	first.Symbol = "AAPL"
+	first.SetAccounts(accounts)
+
+	// The first instrument's accounts become the registry's
+	reg := NewInstrumentRegistry()
+	if err := reg.Register(&first); err != nil {
+		t.Fatalf("Expected AAPL to be registered, got %v", err)
+	}
+	if first.Accounts() != accounts || reg.Accounts() != accounts {
+		t.Errorf("Expected the registry to adopt the exchange's accounts")
+	}
+	msft, _ := reg.Add("MSFT", 300)
+	if msft.Accounts() != accounts {
+		t.Errorf("Expected later instruments to share the adopted accounts")
+	}
+
+	// Other accounts on a later instrument would split the registry's
+	other := NewExchange(100)
+	other.Symbol = "GOOG"
+	other.SetAccounts(NewAccountManager())
+	if err := reg.Register(&other); !errors.Is(err, ErrAccountsConflict) {
+		t.Errorf("Expected ErrAccountsConflict, got %v", err)
+	}
+}
+
+func TestInstrumentRegistryRoute(t *testing.T) {
+	reg := NewInstrumentRegistry()
+	aapl, _ := reg.Add("AAPL", 150)
+	msft, _ := reg.Add("MSFT", 300)
+	reg.Start()
+
+	order := NewTransaction(BuyTransactionType, 290)
+	order.Symbol = "MSFT"
+	if err := reg.Route(order); err != nil {
+		t.Fatalf("Expected order to be routed, got %v", err)
+	}
+
+	// Orders without a symbol go to the default instrument
+	if err := reg.Route(NewTransaction(SellTransactionType, 160)); err != nil {
+		t.Fatalf("Expected order to be routed, got %v", err)
+	}
+
+	unknown := NewTransaction(BuyTransactionType, 100)
+	unknown.Symbol = "GOOG"
+	if err := reg.Route(unknown); !errors.Is(err, ErrUnknownSymbol) {
+		t.Errorf("Expected ErrUnknownSymbol, got %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		_, msftOK := msft.GetOrder(order.ID)
+		_, aaplOK := aapl.SellQ.Min()
+		if msftOK && aaplOK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Orders were not routed to their instruments within timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if buys := aapl.BuyQ.InorderTraversal(); len(buys) != 0 {
+		t.Errorf("Expected the MSFT order not to reach AAPL, found %d buy orders", len(buys))
+	}
+}
+
+func TestRegistrySubmit(t *testing.T) {
+	registry := NewInstrumentRegistry()
+	registry.Add("AAPL", 150)
+
+	report, err := registry.Submit(Transaction{Symbol: "aapl", Type: BuyTransactionType, Amount: 150, Quantity: 1})
+	if err != nil || report.Symbol != "AAPL" || report.Status != OrderStatusNew {
+		t.Errorf("Expected a NEW AAPL order, got %+v, %v", report, err)
+	}
+
+	report, err = registry.Submit(Transaction{Symbol: "MSFT", Type: BuyTransactionType, Amount: 150, Quantity: 1})
+	var rejection *Rejection
+	if !errors.As(err, &rejection) || report.RejectReason != RejectUnknownSymbol {
+		t.Errorf("Expected an unknown symbol rejection, got %+v, %v", report, err)
+	}
+}
@@ -0,0 +1,229 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+)
+
+// RejectReason is a machine readable code explaining why an order was rejected
+type RejectReason string
+
+const (
+	RejectInvalidPrice         RejectReason = "INVALID_PRICE"
+	RejectInvalidQuantity      RejectReason = "INVALID_QUANTITY"
+	RejectInvalidSide          RejectReason = "INVALID_SIDE"
+	RejectInvalidOrderType     RejectReason = "INVALID_ORDER_TYPE"
+	RejectUnknownSymbol        RejectReason = "UNKNOWN_SYMBOL"
+	RejectUnknownAccount       RejectReason = "UNKNOWN_ACCOUNT"
+	RejectDuplicateOrderID     RejectReason = "DUPLICATE_ORDER_ID"
+	RejectInsufficientCash     RejectReason = "INSUFFICIENT_CASH"
+	RejectInsufficientPosition RejectReason = "INSUFFICIENT_POSITION"
+	RejectMaxOrderSize         RejectReason = "MAX_ORDER_SIZE"
+	RejectMaxNotional          RejectReason = "MAX_NOTIONAL"
+	RejectOpenOrderLimit       RejectReason = "OPEN_ORDER_LIMIT"
+	RejectPriceCollar          RejectReason = "PRICE_COLLAR"
+	// RejectJournal is used when an accepted order cannot be written to the journal
+	RejectJournal RejectReason = "JOURNAL_ERROR"
+	// RejectRiskCheck is used when a risk check fails with an error that is not a Rejection
+	RejectRiskCheck RejectReason = "RISK_CHECK"
+)
+
+// Rejection is the error returned when an order is refused before it reaches the book
+type Rejection struct {
+	Reason  RejectReason
+	Message string
+}
+
+func (r *Rejection) Error() string {
+	return fmt.Sprintf("%s: %s", r.Reason, r.Message)
+}
+
+// reject creates a Rejection with a formatted message
+func reject(reason RejectReason, format string, args ...interface{}) *Rejection {
+	return &Rejection{Reason: reason, Message: fmt.Sprintf(format, args...)}
+}
+
+// asRejection returns err as a Rejection, wrapping errors from custom risk checks
+func asRejection(err error) *Rejection {
+	var rejection *Rejection
+	if errors.As(err, &rejection) {
+		return rejection
+	}
+	return &Rejection{Reason: RejectRiskCheck, Message: err.Error()}
+}
+
+// RiskContext is the market and account state a risk check sees for an order
+type RiskContext struct {
+	Symbol          string
+	LastTradedPrice TransactionAmtDataType
+	// Accounts is nil when the exchange does not track accounts
+	Accounts *AccountManager
+	// asks walks the resting sell orders from the best one, if the book is known
+	asks func(fn func(Transaction) bool)
+}
+
+// referencePrice is the price used to value an order: its limit price, or the
+// Last Traded Price for market orders
+func (ctx RiskContext) referencePrice(txn Transaction) TransactionAmtDataType {
+	if txn.IsMarket() {
+		return ctx.LastTradedPrice
+	}
+	return txn.Amount
+}
+
+// cost is what the unfilled part of a buy order can spend: its limit price for each
+// unit, or for a market order the prices of the asks it would sweep. A market order
+// is valued at the Last Traded Price when the book is not known.
+func (ctx RiskContext) cost(txn Transaction) int64 {
+	if !txn.IsMarket() || ctx.asks == nil {
+		return int64(ctx.referencePrice(txn)) * int64(txn.Remaining())
+	}
+
+	// The part of a market order the asks cannot fill is cancelled, not bought
+	remaining := int64(txn.Remaining())
+	var cost int64
+	ctx.asks(func(ask Transaction) bool {
+		quantity := min(remaining, int64(ask.Remaining()))
+		cost += quantity * int64(ask.Amount)
+		remaining -= quantity
+		return remaining > 0
+	})
+	return cost
+}
+
+// otherOpenOrders returns the account's open orders on every instrument,
+// excluding the order being checked so that amendments are not counted twice
+func (ctx RiskContext) otherOpenOrders(txn Transaction) []OrderReport {
+	open := ctx.Accounts.OpenOrders(txn.AccountID)
+	others := make([]OrderReport, 0, len(open))
+	for _, report := range open {
+		if report.OrderID != txn.ID {
+			others = append(others, report)
+		}
+	}
+	return others
+}
+
+// RiskCheck inspects an order before it is matched or rests in the book and
+// returns an error, preferably a *Rejection, to refuse it
+type RiskCheck interface {
+	Check(txn Transaction, ctx RiskContext) error
+}
+
+// RiskCheckFunc adapts a function to the RiskCheck interface
+type RiskCheckFunc func(txn Transaction, ctx RiskContext) error
+
+// Check calls f(txn, ctx)
+func (f RiskCheckFunc) Check(txn Transaction, ctx RiskContext) error {
+	return f(txn, ctx)
+}
+
+// CashCheck rejects buy orders whose cost, together with the account's other open
+// buy orders, exceeds the account's cash. Market buys cost what sweeping the asks
+// for their quantity would. Anonymous orders are not checked.
+func CashCheck() RiskCheck {
+	return RiskCheckFunc(func(txn Transaction, ctx RiskContext) error {
+		if txn.Type != BuyTransactionType || txn.AccountID == "" || ctx.Accounts == nil {
+			return nil
+		}
+
+		cash, err := ctx.Accounts.Cash(txn.AccountID)
+		if err != nil {
+			return reject(RejectUnknownAccount, "%s", err.Error())
+		}
+		var committed int64
+		for _, open := range ctx.otherOpenOrders(txn) {
+			if open.Type == BuyTransactionType {
+				committed += int64(open.Price) * int64(open.Quantity-open.Filled)
+			}
+		}
+
+		cost := ctx.cost(txn)
+		if cost > cash-committed {
+			return reject(RejectInsufficientCash, "order costs %d but only %d cash is available", cost, cash-committed)
+		}
+		return nil
+	})
+}
+
+// PositionCheck rejects sell orders that, together with the account's other open
+// sell orders in the symbol, would leave the account short more than maxShort
+// units. A maxShort of zero disallows short selling. Anonymous orders are not checked.
+func PositionCheck(maxShort int64) RiskCheck {
+	return RiskCheckFunc(func(txn Transaction, ctx RiskContext) error {
+		if txn.Type != SellTransactionType || txn.AccountID == "" || ctx.Accounts == nil {
+			return nil
+		}
+
+		position, err := ctx.Accounts.Position(txn.AccountID, ctx.Symbol)
+		if err != nil {
+			return reject(RejectUnknownAccount, "%s", err.Error())
+		}
+		available := position.Quantity + maxShort
+		for _, open := range ctx.otherOpenOrders(txn) {
+			if open.Type == SellTransactionType && open.Symbol == ctx.Symbol {
+				available -= int64(open.Quantity - open.Filled)
+			}
+		}
+
+		if int64(txn.Remaining()) > available {
+			return reject(RejectInsufficientPosition, "order sells %d but only %d is available", txn.Remaining(), available)
+		}
+		return nil
+	})
+}
+
+// MaxOrderSizeCheck rejects orders for more than max units
+func MaxOrderSizeCheck(max TransactionQtyDataType) RiskCheck {
+	return RiskCheckFunc(func(txn Transaction, ctx RiskContext) error {
+		if txn.Quantity > max {
+			return reject(RejectMaxOrderSize, "quantity %d exceeds the maximum of %d", txn.Quantity, max)
+		}
+		return nil
+	})
+}
+
+// MaxNotionalCheck rejects orders whose value, quantity times price, exceeds max.
+// Market orders are valued at the Last Traded Price.
+func MaxNotionalCheck(max int64) RiskCheck {
+	return RiskCheckFunc(func(txn Transaction, ctx RiskContext) error {
+		notional := int64(ctx.referencePrice(txn)) * int64(txn.Quantity)
+		if notional > max {
+			return reject(RejectMaxNotional, "notional %d exceeds the maximum of %d", notional, max)
+		}
+		return nil
+	})
+}
+
+// OpenOrderLimitCheck rejects orders from accounts that already have max orders
+// resting on any instrument. Anonymous orders are not checked.
+func OpenOrderLimitCheck(max int) RiskCheck {
+	return RiskCheckFunc(func(txn Transaction, ctx RiskContext) error {
+		if txn.AccountID == "" || ctx.Accounts == nil || !txn.Rests() {
+			return nil
+		}
+
+		if open := len(ctx.otherOpenOrders(txn)); open >= max {
+			return reject(RejectOpenOrderLimit, "account %s already has %d open orders", txn.AccountID, open)
+		}
+		return nil
+	})
+}
+
+// PriceCollarCheck rejects limit orders priced more than percent away from the
+// Last Traded Price. Market orders are not checked.
+func PriceCollarCheck(percent int) RiskCheck {
+	return RiskCheckFunc(func(txn Transaction, ctx RiskContext) error {
+		if txn.IsMarket() {
+			return nil
+		}
+
+		band := int64(ctx.LastTradedPrice) * int64(percent) / 100
+		low := int64(ctx.LastTradedPrice) - band
+		high := int64(ctx.LastTradedPrice) + band
+		if int64(txn.Amount) < low || int64(txn.Amount) > high {
+			return reject(RejectPriceCollar, "price %d is outside the collar %d-%d", txn.Amount, low, high)
+		}
+		return nil
+	})
+}
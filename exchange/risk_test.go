@@ -0,0 +1,219 @@
+package exchange
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRiskChecks(t *testing.T) {
+	accounts := NewAccountManager()
+	accounts.Open("alice", 1000)
+	accounts.applyFill("SIM", Transaction{AccountID: "alice"}, Transaction{}, 50, 10)
+	accounts.Open("bob", 1000)
+	accounts.recordOrder(OrderReport{OrderID: "BUY-1", AccountID: "bob", Symbol: "SIM",
+		Type: BuyTransactionType, Status: OrderStatusNew, Price: 100, Quantity: 6})
+	accounts.recordOrder(OrderReport{OrderID: "SELL-1", AccountID: "bob", Symbol: "SIM",
+		Type: SellTransactionType, Status: OrderStatusPartiallyFilled, Price: 110, Quantity: 5, Filled: 2})
+
+	// alice has 500 cash and 10 shares, bob has 400 cash free and 3 shares committed to a sell order
+	ctx := RiskContext{Symbol: "SIM", LastTradedPrice: 100, Accounts: accounts}
+
+	order := func(account, side string, price TransactionAmtDataType, qty TransactionQtyDataType) Transaction {
+		txn := NewTransactionWithQuantity(side, price, qty)
+		txn.AccountID = account
+		return txn
+	}
+	market := order("alice", BuyTransactionType, 0, 5)
+	market.OrderType = MarketOrderType
+
+	testCases := []struct {
+		name           string
+		check          RiskCheck
+		order          Transaction
+		expectedReason RejectReason
+	}{
+		{"Cash Available", CashCheck(), order("alice", BuyTransactionType, 100, 5), ""},
+		{"Cash Insufficient", CashCheck(), order("alice", BuyTransactionType, 100, 6), RejectInsufficientCash},
+		{"Cash Committed To Open Orders", CashCheck(), order("bob", BuyTransactionType, 100, 5), RejectInsufficientCash},
+		{"Cash Amended Order Not Counted Twice", CashCheck(), Transaction{ID: "BUY-1", AccountID: "bob",
+			Type: BuyTransactionType, Amount: 100, Quantity: 10}, ""},
+		{"Cash Market Order At LTP", CashCheck(), market, ""},
+		{"Cash Anonymous", CashCheck(), order("", BuyTransactionType, 100, 1000), ""},
+		{"Position Available", PositionCheck(0), order("alice", SellTransactionType, 90, 10), ""},
+		{"Position Insufficient", PositionCheck(0), order("alice", SellTransactionType, 90, 11), RejectInsufficientPosition},
+		{"Position Short Limit", PositionCheck(5), order("alice", SellTransactionType, 90, 15), ""},
+		{"Position Committed To Open Orders", PositionCheck(0), order("bob", SellTransactionType, 90, 1), RejectInsufficientPosition},
+		{"Max Order Size", MaxOrderSizeCheck(10), order("", BuyTransactionType, 100, 11), RejectMaxOrderSize},
+		{"Max Notional", MaxNotionalCheck(1000), order("", SellTransactionType, 101, 10), RejectMaxNotional},
+		{"Max Notional Within Limit", MaxNotionalCheck(1000), order("", SellTransactionType, 100, 10), ""},
+		{"Open Order Limit", OpenOrderLimitCheck(2), order("bob", BuyTransactionType, 90, 1), RejectOpenOrderLimit},
+		{"Open Order Limit Not Reached", OpenOrderLimitCheck(3), order("bob", BuyTransactionType, 90, 1), ""},
+		{"Price Collar Below", PriceCollarCheck(10), order("", BuyTransactionType, 89, 1), RejectPriceCollar},
+		{"Price Collar Above", PriceCollarCheck(10), order("", SellTransactionType, 111, 1), RejectPriceCollar},
+		{"Price Collar Inside", PriceCollarCheck(10), order("", SellTransactionType, 110, 1), ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.check.Check(tc.order, ctx)
+			if tc.expectedReason == "" {
+				if err != nil {
+					t.Errorf("Expected the order to pass, got %v", err)
+				}
+				return
+			}
+
+			var rejection *Rejection
+			if !errors.As(err, &rejection) {
+				t.Fatalf("Expected a rejection, got %v", err)
+			}
+			if rejection.Reason != tc.expectedReason {
+				t.Errorf("Expected reason %s, got %s", tc.expectedReason, rejection.Reason)
+			}
+		})
+	}
+}
+
+func TestRejectionReports(t *testing.T) {
+	exchange := NewExchange(100)
+	exchange.AddRiskCheck(MaxOrderSizeCheck(10))
+	exchange.AddRiskCheck(RiskCheckFunc(func(txn Transaction, ctx RiskContext) error {
+		if txn.Amount == 42 {
+			return errors.New("no answers allowed")
+		}
+		return nil
+	}))
+
+	reports := make(chan OrderReport, 10)
+	exchange.RegisterOrderReportCallback(func(report OrderReport) {
+		reports <- report
+	})
+	go exchange.AcceptTrades()
+
+	testCases := []struct {
+		name           string
+		order          Transaction
+		expectedReason RejectReason
+	}{
+		{"Invalid Price", NewTransaction(BuyTransactionType, 0), RejectInvalidPrice},
+		{"Invalid Quantity", NewTransactionWithQuantity(BuyTransactionType, 100, 0), RejectInvalidQuantity},
+		{"Invalid Side", NewTransaction("HOLD", 100), RejectInvalidSide},
+		{"Unknown Account", Transaction{ID: "BUY-X", AccountID: "nobody", Type: BuyTransactionType,
+			Amount: 100, Quantity: 1}, RejectUnknownAccount},
+		{"Risk Check", NewTransactionWithQuantity(SellTransactionType, 100, 11), RejectMaxOrderSize},
+		{"Custom Risk Check", NewTransaction(SellTransactionType, 42), RejectRiskCheck},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			exchange.IncomingTrades <- tc.order
+
+			select {
+			case report := <-reports:
+				if report.Status != OrderStatusRejected || report.RejectReason != tc.expectedReason {
+					t.Errorf("Expected rejection %s, got status %s reason %s", tc.expectedReason, report.Status, report.RejectReason)
+				}
+				if report.Reason == "" {
+					t.Errorf("Expected a rejection message")
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("No order report received within timeout")
+			}
+		})
+	}
+
+	if len(exchange.BuyQ.InorderTraversal()) != 0 || len(exchange.SellQ.InorderTraversal()) != 0 {
+		t.Errorf("Expected rejected orders not to rest")
+	}
+}
+
+func TestAmendOrderRiskCheck(t *testing.T) {
+	exchange := NewExchange(100)
+	exchange.AddRiskCheck(PriceCollarCheck(10))
+	order := NewTransactionWithQuantity(BuyTransactionType, 95, 5)
+	exchange.accept(order, NewLogger("TestAmendOrderRiskCheck"))
+
+	_, err := exchange.AmendOrder(order.ID, 80, 5)
+	var rejection *Rejection
+	if !errors.As(err, &rejection) || rejection.Reason != RejectPriceCollar {
+		t.Fatalf("Expected a price collar rejection, got %v", err)
+	}
+
+	if resting, _ := exchange.GetOrder(order.ID); resting.Amount != 95 {
+		t.Errorf("Expected the order to keep price 95, got %d", resting.Amount)
+	}
+}
+
+func TestCashCheckMarketSweep(t *testing.T) {
+	exchange := NewExchange(100)
+	accounts := NewAccountManager()
+	accounts.Open("alice", 700)
+	exchange.SetAccounts(accounts)
+	exchange.AddRiskCheck(CashCheck())
+	for _, price := range []TransactionAmtDataType{100, 110, 150} {
+		exchange.Submit(NewTransactionWithQuantity(SellTransactionType, price, 3))
+	}
+
+	market := func(qty TransactionQtyDataType) Transaction {
+		return Transaction{Type: BuyTransactionType, OrderType: MarketOrderType, AccountID: "alice", Quantity: qty}
+	}
+
+	// 7 at the Last Traded Price is affordable, but sweeping three levels costs 780
+	report, err := exchange.Submit(market(7))
+	var rejection *Rejection
+	if !errors.As(err, &rejection) || rejection.Reason != RejectInsufficientCash {
+		t.Fatalf("Expected an insufficient cash rejection, got %v", err)
+	}
+	if report.Filled != 0 {
+		t.Errorf("Expected nothing filled, got %d", report.Filled)
+	}
+
+	// 6 sweeps two levels for 630
+	report, err = exchange.Submit(market(6))
+	if err != nil || report.Filled != 6 {
+		t.Fatalf("Expected the order to fill 6, got %+v and %v", report, err)
+	}
+	if cash, _ := accounts.Cash("alice"); cash != 70 {
+		t.Errorf("Expected 70 cash left, got %d", cash)
+	}
+}
+
+func TestCashCheckAcrossInstruments(t *testing.T) {
+	registry := NewInstrumentRegistry()
+	registry.Add("AAPL", 100)
+	registry.Add("MSFT", 100)
+	registry.AddRiskCheck(CashCheck())
+	// A slow check widens the gap between checking the cash and committing it
+	registry.AddRiskCheck(RiskCheckFunc(func(txn Transaction, ctx RiskContext) error {
+		time.Sleep(time.Millisecond)
+		return nil
+	}))
+	registry.Accounts().Open("alice", 1000)
+
+	// Cash for 10 of the 100 orders is shared by both instruments
+	var accepted int64
+	var wg sync.WaitGroup
+	for _, symbol := range []string{"AAPL", "MSFT"} {
+		wg.Add(1)
+		go func(symbol string) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				order := Transaction{Symbol: symbol, AccountID: "alice", Type: BuyTransactionType, Amount: 100, Quantity: 1}
+				if _, err := registry.Submit(order); err == nil {
+					atomic.AddInt64(&accepted, 1)
+				}
+			}
+		}(symbol)
+	}
+	wg.Wait()
+
+	if accepted != 10 {
+		t.Errorf("Expected 10 orders to be accepted, got %d", accepted)
+	}
+	if open := registry.Accounts().OpenOrders("alice"); len(open) != 10 {
+		t.Errorf("Expected 10 open orders, got %d", len(open))
+	}
+}
@@ -0,0 +1,388 @@
+package exchange
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// snapshotsKept is the number of most recent snapshots kept on disk
+const snapshotsKept = 3
+
+// ErrNoJournal is returned when a snapshot is taken of a registry without a journal
+var ErrNoJournal = errors.New("registry has no journal")
+
+// Snapshot is the state of every instrument and account once the journal events up
+// to and including Sequence have been applied
+type Snapshot struct {
+	Sequence uint64 `json:"seq"`
+	// Offset is the position in the journal just after the event at Sequence, where
+	// a recovery starts reading
+	Offset      int64                `json:"offset"`
+	Time        time.Time            `json:"time"`
+	Instruments []InstrumentSnapshot `json:"instruments"`
+	Accounts    []AccountSnapshot    `json:"accounts"`
+}
+
+// InstrumentSnapshot is the state of one exchange
+type InstrumentSnapshot struct {
+	Symbol          string                 `json:"symbol"`
+	LastTradedPrice TransactionAmtDataType `json:"lastTradedPrice"`
+	// OrderSeq and TradeSeq are the last order priority and trade number assigned
+	OrderSeq uint64 `json:"orderSeq"`
+	TradeSeq uint64 `json:"tradeSeq"`
+	// Bids and Asks hold the resting orders of each book, best first
+	Bids    []Transaction `json:"bids"`
+	Asks    []Transaction `json:"asks"`
+	Trades  []Trade       `json:"trades"`
+	Candles []Candle      `json:"candles"`
+}
+
+// AccountSnapshot is the state of one account
+type AccountSnapshot struct {
+	ID        string     `json:"id"`
+	Cash      int64      `json:"cash"`
+	Positions []Position `json:"positions"`
+	// Orders holds the latest report of each remembered order, oldest first
+	Orders []OrderReport `json:"orders"`
+	// Open holds the latest report of each order still resting
+	Open []OrderReport `json:"open"`
+}
+
+// Snapshot captures a consistent state of every instrument and account together
+// with the sequence number of the last journal event it includes. Matching is only
+// stopped while the books are copied in memory.
+func (reg *InstrumentRegistry) Snapshot() (*Snapshot, error) {
+	journal := reg.Journal()
+	if journal == nil {
+		return nil, ErrNoJournal
+	}
+	return reg.capture(journal), nil
+}
+
+// capture copies the state of every instrument and account, recording the sequence
+// number of the journal if there is one
+func (reg *InstrumentRegistry) capture(journal *Journal) *Snapshot {
+	now := reg.Clock().Now()
+
+	// Every journaled event is written under the lock of its exchange or of the
+	// accounts, so holding all of them stops the journal at one point
+	exchanges := reg.Exchanges()
+	for _, exch := range exchanges {
+		exch.matchLock.Lock()
+	}
+	reg.accounts.mutex.RLock()
+
+	snapshot := &Snapshot{
+		Time:        now,
+		Instruments: make([]InstrumentSnapshot, 0, len(exchanges)),
+		Accounts:    reg.accounts.snapshot(),
+	}
+	if journal != nil {
+		snapshot.Sequence, snapshot.Offset = journal.position()
+	}
+	for _, exch := range exchanges {
+		snapshot.Instruments = append(snapshot.Instruments, exch.snapshot())
+	}
+
+	reg.accounts.mutex.RUnlock()
+	for _, exch := range exchanges {
+		exch.matchLock.Unlock()
+	}
+	return snapshot
+}
+
+// snapshot copies the state of the exchange. The caller must hold matchLock.
+func (exch *Exchange) snapshot() InstrumentSnapshot {
+	snapshot := InstrumentSnapshot{
+		Symbol:          exch.Symbol,
+		LastTradedPrice: exch.LastTradedPrice,
+		OrderSeq:        exch.nextSeq,
+		TradeSeq:        exch.nextTradeSeq,
+		Bids:            make([]Transaction, 0),
+		Asks:            make([]Transaction, 0),
+		Trades:          exch.tradeTape.Recent(0),
+		Candles:         make([]Candle, 0),
+	}
+	exch.BuyQ.Descend(func(txn Transaction) bool {
+		snapshot.Bids = append(snapshot.Bids, txn)
+		return true
+	})
+	exch.SellQ.Ascend(func(txn Transaction) bool {
+		snapshot.Asks = append(snapshot.Asks, txn)
+		return true
+	})
+	for _, interval := range CandleIntervals {
+		snapshot.Candles = append(snapshot.Candles, exch.candles.Candles(interval, time.Time{}, time.Time{})...)
+	}
+	return snapshot
+}
+
+// restore loads the state of a snapshot into an exchange without any orders
+func (exch *Exchange) restore(snapshot InstrumentSnapshot) {
+	exch.matchLock.Lock()
+	defer exch.matchLock.Unlock()
+	defer exch.publishBookUpdate()
+
+	logger := exch.newLogger("Snapshot")
+	exch.LastTradedPrice = snapshot.LastTradedPrice
+	exch.nextSeq = snapshot.OrderSeq
+	exch.nextTradeSeq = snapshot.TradeSeq
+	for _, txn := range snapshot.Bids {
+		exch.rest(txn, logger)
+	}
+	for _, txn := range snapshot.Asks {
+		exch.rest(txn, logger)
+	}
+	for _, trade := range snapshot.Trades {
+		exch.tradeTape.Add(trade)
+	}
+	exch.candles.restore(snapshot.Candles)
+}
+
+// restore replaces the candles of every interval with those given, oldest first
+func (ca *CandleAggregator) restore(candles []Candle) {
+	ca.mutex.Lock()
+	defer ca.mutex.Unlock()
+
+	ca.candles = make(map[CandleInterval][]Candle)
+	for _, candle := range candles {
+		ca.candles[candle.Interval] = append(ca.candles[candle.Interval], candle)
+	}
+}
+
+// snapshot copies every account ordered by ID. The caller must hold the mutex.
+func (am *AccountManager) snapshot() []AccountSnapshot {
+	ids := make([]string, 0, len(am.accounts))
+	for id := range am.accounts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	snapshots := make([]AccountSnapshot, 0, len(ids))
+	for _, id := range ids {
+		account := am.accounts[id]
+		snapshot := AccountSnapshot{
+			ID:        account.ID,
+			Cash:      account.Cash,
+			Positions: make([]Position, 0, len(account.positions)),
+			Orders:    make([]OrderReport, 0, len(account.orderIDs)),
+			Open:      make([]OrderReport, 0, len(account.open)),
+		}
+		for _, position := range account.positions {
+			snapshot.Positions = append(snapshot.Positions, *position)
+		}
+		sort.Slice(snapshot.Positions, func(i, j int) bool {
+			return snapshot.Positions[i].Symbol < snapshot.Positions[j].Symbol
+		})
+		for _, orderID := range account.orderIDs {
+			snapshot.Orders = append(snapshot.Orders, account.orders[orderID])
+		}
+		for _, report := range account.open {
+			snapshot.Open = append(snapshot.Open, report)
+		}
+		sort.Slice(snapshot.Open, func(i, j int) bool {
+			return snapshot.Open[i].OrderID < snapshot.Open[j].OrderID
+		})
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots
+}
+
+// restore replaces every account with those of a snapshot
+func (am *AccountManager) restore(snapshots []AccountSnapshot) {
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
+
+	am.accounts = make(map[string]*Account)
+	for _, snapshot := range snapshots {
+		account := &Account{
+			ID:        snapshot.ID,
+			Cash:      snapshot.Cash,
+			positions: make(map[string]*Position),
+			orders:    make(map[string]OrderReport),
+			open:      make(map[string]OrderReport),
+		}
+		for _, position := range snapshot.Positions {
+			position := position
+			account.positions[position.Symbol] = &position
+		}
+		for _, report := range snapshot.Orders {
+			account.orders[report.OrderID] = report
+			account.orderIDs = append(account.orderIDs, report.OrderID)
+		}
+		for _, report := range snapshot.Open {
+			account.open[report.OrderID] = report
+		}
+		am.accounts[snapshot.ID] = account
+	}
+}
+
+// restoreSnapshot loads a snapshot into a registry holding the snapshot's instruments
+// without any orders or accounts
+func (reg *InstrumentRegistry) restoreSnapshot(snapshot *Snapshot) error {
+	exchanges := make([]*Exchange, 0, len(snapshot.Instruments))
+	for _, instrument := range snapshot.Instruments {
+		exch, ok := reg.Get(instrument.Symbol)
+		if !ok {
+			return fmt.Errorf("%w: %s in snapshot %d", ErrUnknownSymbol, instrument.Symbol, snapshot.Sequence)
+		}
+		exchanges = append(exchanges, exch)
+	}
+
+	reg.accounts.restore(snapshot.Accounts)
+	for i, exch := range exchanges {
+		exch.restore(snapshot.Instruments[i])
+	}
+	return nil
+}
+
+// WriteSnapshot takes a snapshot of the registry and writes it to dir, keeping only
+// the most recent snapshots. The file is written under a temporary name and renamed,
+// so a crash never leaves a partial snapshot behind.
+func (reg *InstrumentRegistry) WriteSnapshot(dir string) (*Snapshot, error) {
+	snapshot, err := reg.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	record, err := encodeRecord(snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(dir, ".snapshot-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(record)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), filepath.Join(dir, snapshotName(snapshot.Sequence)))
+	}
+	if err != nil {
+		return nil, err
+	}
+	syncDir(dir)
+
+	return snapshot, pruneSnapshots(dir, snapshotsKept)
+}
+
+// SnapshotPeriodically writes a snapshot of the registry to dir every interval of
+// the registry's clock
+func (reg *InstrumentRegistry) SnapshotPeriodically(dir string, interval time.Duration) {
+	logger := reg.newLogger("Snapshot")
+	ticker := reg.Clock().NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		<-ticker.C()
+		snapshot, err := reg.WriteSnapshot(dir)
+		if err != nil {
+			logger.Error("Failed to write snapshot: " + err.Error())
+			continue
+		}
+		logger.Info(fmt.Sprintf("Wrote snapshot at journal sequence %d", snapshot.Sequence))
+	}
+}
+
+// LoadSnapshot returns the most recent valid snapshot in dir that includes no journal
+// event after maxSequence, or nil if there is none. Damaged snapshots are skipped.
+func LoadSnapshot(dir string, maxSequence uint64) (*Snapshot, error) {
+	return loadSnapshot(dir, func(snapshot *Snapshot) bool {
+		return snapshot.Sequence <= maxSequence
+	})
+}
+
+// loadSnapshot returns the most recent valid snapshot in dir that usable accepts, or
+// nil if there is none
+func loadSnapshot(dir string, usable func(*Snapshot) bool) (*Snapshot, error) {
+	paths, err := snapshotPaths(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := NewLogger("Snapshot")
+	for i := len(paths) - 1; i >= 0; i-- {
+		snapshot, err := readSnapshot(paths[i])
+		if err != nil {
+			logger.Warn(fmt.Sprintf("Skipping snapshot %s: %s", paths[i], err.Error()))
+			continue
+		}
+		if usable(snapshot) {
+			return snapshot, nil
+		}
+	}
+	return nil, nil
+}
+
+// readSnapshot reads and verifies a snapshot file
+func readSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	record, found := bytes.CutSuffix(data, []byte("\n"))
+	if !found {
+		return nil, fmt.Errorf("%w: incomplete snapshot", ErrJournalCorrupted)
+	}
+
+	snapshot := &Snapshot{}
+	if err := decodeRecord(record, snapshot); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrJournalCorrupted, err.Error())
+	}
+	return snapshot, nil
+}
+
+// snapshotName names the snapshot taken at a journal sequence number so that
+// snapshots sort by name in the order they were taken
+func snapshotName(sequence uint64) string {
+	return fmt.Sprintf("snapshot-%020d.json", sequence)
+}
+
+// snapshotPaths returns the snapshot files in dir, oldest first
+func snapshotPaths(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "snapshot-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// pruneSnapshots removes all but the most recent snapshots in dir
+func pruneSnapshots(dir string, keep int) error {
+	paths, err := snapshotPaths(dir)
+	if err != nil {
+		return err
+	}
+	for len(paths) > keep {
+		if err := os.Remove(paths[0]); err != nil {
+			return err
+		}
+		paths = paths[1:]
+	}
+	return nil
+}
+
+// syncDir flushes a directory entry change such as a rename to stable storage.
+// Platforms that cannot sync directories are ignored.
+func syncDir(dir string) {
+	if file, err := os.Open(dir); err == nil {
+		file.Sync()
+		file.Close()
+	}
+}
@@ -0,0 +1,237 @@
+package exchange
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newSnapshotRegistry creates the instruments traded by the snapshot tests and recovers them
+func newSnapshotRegistry(t *testing.T, path, dir string) (*InstrumentRegistry, *Journal, Recovery) {
+	registry := NewInstrumentRegistry()
+	registry.Add("AAPL", 100)
+	registry.Add("MSFT", 200)
+	journal, recovery, err := registry.Recover(path, RecoveryOptions{
+		Journal:     JournalOptions{Sync: SyncNever},
+		SnapshotDir: dir,
+	})
+	if err != nil {
+		t.Fatalf("Failed to recover: %v", err)
+	}
+	return registry, journal, recovery
+}
+
+func TestSnapshotRecovery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.log")
+	dir := filepath.Join(t.TempDir(), "snapshots")
+
+	original, journal, _ := newSnapshotRegistry(t, path, dir)
+	original.Accounts().Open("alice", 10000)
+	original.Submit(Transaction{ID: "S1", Symbol: "AAPL", Type: SellTransactionType, Amount: 101, Quantity: 5})
+	original.Submit(Transaction{ID: "B1", Symbol: "AAPL", AccountID: "alice", Type: BuyTransactionType, Amount: 101, Quantity: 2})
+	original.Submit(Transaction{ID: "B2", Symbol: "AAPL", AccountID: "alice", Type: BuyTransactionType, Amount: 99, Quantity: 4})
+	original.Submit(Transaction{ID: "S2", Symbol: "MSFT", Type: SellTransactionType, Amount: 205, Quantity: 3})
+
+	snapshot, err := original.WriteSnapshot(dir)
+	if err != nil {
+		t.Fatalf("Failed to write snapshot: %v", err)
+	}
+	if snapshot.Sequence != journal.Sequence() {
+		t.Errorf("Expected the snapshot at sequence %d, got %d", journal.Sequence(), snapshot.Sequence)
+	}
+
+	// Events after the snapshot depend on the state it restores
+	original.Submit(Transaction{ID: "S3", Symbol: "AAPL", AccountID: "alice", Type: SellTransactionType, Amount: 99, Quantity: 1})
+	original.Submit(Transaction{ID: "B3", Symbol: "AAPL", Type: BuyTransactionType, Amount: 102, Quantity: 3})
+	msft, _ := original.Get("MSFT")
+	msft.AmendOrder("S2", 204, 3)
+	original.Checkpoint()
+	journal.Close()
+
+	recovered, journal, recovery := newSnapshotRegistry(t, path, dir)
+	defer journal.Close()
+
+	if recovery.Snapshot != snapshot.Sequence {
+		t.Errorf("Expected to start from the snapshot at %d, got %d", snapshot.Sequence, recovery.Snapshot)
+	}
+	if recovery.Accounts != 0 || recovery.Orders != 2 || recovery.Checkpoints != 2 {
+		t.Errorf("Expected only the events after the snapshot to be replayed, got %+v", recovery)
+	}
+
+	for _, symbol := range []string{"AAPL", "MSFT"} {
+		before, _ := original.Get(symbol)
+		after, _ := recovered.Get(symbol)
+		if before.StateChecksum() != after.StateChecksum() {
+			t.Errorf("%s: expected state checksum %08x, got %08x", symbol, before.StateChecksum(), after.StateChecksum())
+		}
+		if !reflect.DeepEqual(after.GetBookSnapshot().Bids, before.GetBookSnapshot().Bids) ||
+			!reflect.DeepEqual(after.GetBookSnapshot().Asks, before.GetBookSnapshot().Asks) {
+			t.Errorf("%s: expected levels %+v, got %+v", symbol, before.GetBookSnapshot(), after.GetBookSnapshot())
+		}
+		if len(after.GetTrades(0)) != len(before.GetTrades(0)) {
+			t.Errorf("%s: expected %d trades, got %d", symbol, len(before.GetTrades(0)), len(after.GetTrades(0)))
+		}
+		beforeCandles := before.GetCandles(Interval1h, time.Time{}, time.Time{})
+		afterCandles := after.GetCandles(Interval1h, time.Time{}, time.Time{})
+		if len(afterCandles) != len(beforeCandles) || (len(afterCandles) > 0 && afterCandles[0].Volume != beforeCandles[0].Volume) {
+			t.Errorf("%s: expected candles %+v, got %+v", symbol, beforeCandles, afterCandles)
+		}
+	}
+
+	beforeSummary, _ := original.AccountSummary("alice")
+	afterSummary, err := recovered.AccountSummary("alice")
+	if err != nil || !reflect.DeepEqual(afterSummary, beforeSummary) {
+		t.Errorf("Expected account %+v, got %+v (%v)", beforeSummary, afterSummary, err)
+	}
+	beforeOrders, _ := original.Accounts().Orders("alice")
+	afterOrders, _ := recovered.Accounts().Orders("alice")
+	if !reflect.DeepEqual(afterOrders, beforeOrders) {
+		t.Errorf("Expected orders %+v, got %+v", beforeOrders, afterOrders)
+	}
+	if open := recovered.Accounts().OpenOrders("alice"); len(open) != 1 || open[0].OrderID != "B2" {
+		t.Errorf("Expected B2 to be open, got %+v", open)
+	}
+}
+
+func TestLoadSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.log")
+	dir := filepath.Join(t.TempDir(), "snapshots")
+
+	registry, journal, _ := newSnapshotRegistry(t, path, dir)
+	defer journal.Close()
+	sequences := make([]uint64, 0)
+	for i := 0; i < 5; i++ {
+		registry.Submit(Transaction{Symbol: "AAPL", Type: BuyTransactionType, Amount: TransactionAmtDataType(90 + i), Quantity: 1})
+		snapshot, err := registry.WriteSnapshot(dir)
+		if err != nil {
+			t.Fatalf("Failed to write snapshot: %v", err)
+		}
+		sequences = append(sequences, snapshot.Sequence)
+	}
+
+	paths, _ := snapshotPaths(dir)
+	if len(paths) != snapshotsKept {
+		t.Fatalf("Expected %d snapshots to be kept, got %d", snapshotsKept, len(paths))
+	}
+
+	tests := []struct {
+		name        string
+		maxSequence uint64
+		expected    uint64
+	}{
+		{"Latest", sequences[4], sequences[4]},
+		{"Snapshot Ahead Of Journal", sequences[3], sequences[3]},
+		{"No Snapshot Old Enough", sequences[1], 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			snapshot, err := LoadSnapshot(dir, test.maxSequence)
+			if err != nil {
+				t.Fatalf("Failed to load snapshot: %v", err)
+			}
+			if (snapshot == nil && test.expected != 0) || (snapshot != nil && snapshot.Sequence != test.expected) {
+				t.Errorf("Expected the snapshot at %d, got %+v", test.expected, snapshot)
+			}
+		})
+	}
+
+	// A damaged snapshot falls back to the one before it
+	if err := os.WriteFile(paths[2], []byte("00000000 {}\n"), 0644); err != nil {
+		t.Fatalf("Failed to damage snapshot: %v", err)
+	}
+	if snapshot, _ := LoadSnapshot(dir, sequences[4]); snapshot == nil || snapshot.Sequence != sequences[3] {
+		t.Errorf("Expected the snapshot at %d, got %+v", sequences[3], snapshot)
+	}
+
+	if _, err := NewInstrumentRegistry().Snapshot(); !errors.Is(err, ErrNoJournal) {
+		t.Errorf("Expected ErrNoJournal, got %v", err)
+	}
+}
+
+func TestSnapshotRecoverySeeksJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.log")
+	dir := filepath.Join(t.TempDir(), "snapshots")
+
+	original, journal, _ := newSnapshotRegistry(t, path, dir)
+	original.Submit(Transaction{ID: "S1", Symbol: "AAPL", Type: SellTransactionType, Amount: 101, Quantity: 5})
+	snapshot, err := original.WriteSnapshot(dir)
+	if err != nil {
+		t.Fatalf("Failed to write snapshot: %v", err)
+	}
+	original.Submit(Transaction{ID: "B1", Symbol: "AAPL", Type: BuyTransactionType, Amount: 101, Quantity: 2})
+	journal.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read journal: %v", err)
+	}
+	if snapshot.Offset <= 0 || snapshot.Offset >= int64(len(data)) {
+		t.Fatalf("Expected the snapshot offset within the journal of %d bytes, got %d", len(data), snapshot.Offset)
+	}
+
+	// Damaging a record before the snapshot shows that it is not read
+	damaged := append([]byte(nil), data...)
+	damaged[0] ^= 1
+	if err := os.WriteFile(path, damaged, 0644); err != nil {
+		t.Fatalf("Failed to damage journal: %v", err)
+	}
+	recovered, journal, recovery := newSnapshotRegistry(t, path, dir)
+	if recovery.Snapshot != snapshot.Sequence || recovery.Events != 2 {
+		t.Errorf("Expected the order and trade after the snapshot to be replayed, got %+v", recovery)
+	}
+	if aapl, _ := recovered.Get("AAPL"); aapl.LastTradedPrice != 101 {
+		t.Errorf("Expected LTP 101, got %d", aapl.LastTradedPrice)
+	}
+	if sequence := journal.Sequence(); sequence != snapshot.Sequence+2 {
+		t.Errorf("Expected the journal to continue after sequence %d, got %d", snapshot.Sequence+2, sequence)
+	}
+	journal.Close()
+
+	// A journal that no longer reaches the snapshot is replayed from the start
+	if err := os.WriteFile(path, data[:snapshot.Offset-1], 0644); err != nil {
+		t.Fatalf("Failed to shorten journal: %v", err)
+	}
+	registry := NewInstrumentRegistry()
+	registry.Add("AAPL", 100)
+	registry.Add("MSFT", 200)
+	journal, recovery, err = registry.Recover(path, RecoveryOptions{
+		Journal:             JournalOptions{Sync: SyncNever},
+		SnapshotDir:         dir,
+		TruncateCorruptTail: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to recover: %v", err)
+	}
+	defer journal.Close()
+	if recovery.Snapshot != 0 || recovery.Orders != 0 || recovery.TruncatedBytes == 0 {
+		t.Errorf("Expected a full replay of the truncated journal, got %+v", recovery)
+	}
+}
+
+func TestSnapshotPeriodically(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.log")
+	dir := filepath.Join(t.TempDir(), "snapshots")
+
+	registry, journal, _ := newSnapshotRegistry(t, path, dir)
+	defer journal.Close()
+	clock := NewSimulatedClock(time.Date(2025, 4, 27, 15, 0, 0, 0, time.UTC))
+	registry.SetClock(clock)
+
+	go registry.SnapshotPeriodically(dir, time.Minute)
+	clock.WaitForTickers(1)
+	clock.Advance(time.Minute)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if paths, _ := snapshotPaths(dir); len(paths) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected a snapshot a minute of simulated time after starting")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,159 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Channel is a named stream of updates a WebSocket client can subscribe to
+type Channel string
+
+const (
+	// PriceChannel streams the price updates of a symbol
+	PriceChannel Channel = "price"
+	// BookChannel streams the order book of a symbol, limited to a depth
+	BookChannel Channel = "book"
+	// LevelsChannel streams sequence numbered changes to the price levels of a symbol's full book
+	LevelsChannel Channel = "levels"
+	// TradesChannel streams the trades of a symbol
+	TradesChannel Channel = "trades"
+	// CandlesChannel streams the candle updates of a symbol
+	CandlesChannel Channel = "candles"
+	// OrdersChannel streams the order reports of an account
+	OrdersChannel Channel = "orders"
+)
+
+// defaultChannels are subscribed for every requested symbol when a client does not name any channel
+var defaultChannels = []Channel{PriceChannel, BookChannel, TradesChannel}
+
+var (
+	// ErrUnknownChannel is returned when a client subscribes to a channel that does not exist
+	ErrUnknownChannel = errors.New("unknown channel")
+	// ErrInvalidDepth is returned when a book subscription has a negative depth or one
+	// deeper than the order book that is broadcast
+	ErrInvalidDepth = fmt.Errorf("depth must be from 0 to %d", orderBookSize)
+	// ErrAccountRequired is returned when the orders channel is subscribed without an account
+	ErrAccountRequired = errors.New("accountId required for the orders channel")
+)
+
+// Subscription is one channel a client receives. Market data channels are
+// subscribed per symbol and the orders channel per account.
+type Subscription struct {
+	Channel   Channel `json:"channel"`
+	Symbol    string  `json:"symbol,omitempty"`
+	AccountID string  `json:"accountId,omitempty"`
+	// Depth limits each side of the book channel to its best entries; zero sends all
+	// of the entries in the broadcast book, which holds the best 10 of each side
+	Depth int `json:"depth,omitempty"`
+	// Interval limits the candles channel to one interval; empty sends every interval
+	Interval CandleInterval `json:"interval,omitempty"`
+}
+
+// topic identifies the updates a subscription listens to
+type topic struct {
+	channel Channel
+	key     string
+}
+
+// topic returns the topic of the subscription
+func (sub Subscription) topic() topic {
+	if sub.Channel == OrdersChannel {
+		return topic{channel: OrdersChannel, key: sub.AccountID}
+	}
+	return topic{channel: sub.Channel, key: sub.Symbol}
+}
+
+// resolveSubscriptions expands channels and symbols into one subscription per channel
+// and symbol. No channels means the default channels and no symbols the registry's
+// default symbol. The orders channel is subscribed for the account instead of symbols.
+func resolveSubscriptions(channels []Channel, symbols []string, accountID string, depth int, interval string, registry *InstrumentRegistry) ([]Subscription, error) {
+	if len(channels) == 0 {
+		channels = defaultChannels
+	}
+	if depth < 0 || depth > orderBookSize {
+		return nil, ErrInvalidDepth
+	}
+	var candleInterval CandleInterval
+	if interval != "" {
+		var err error
+		if candleInterval, err = ParseCandleInterval(interval); err != nil {
+			return nil, err
+		}
+	}
+
+	resolved := make([]string, 0, len(symbols))
+	for _, symbol := range symbols {
+		var exchange *Exchange
+		if registry != nil {
+			exchange, _ = registry.Get(symbol)
+		}
+		if exchange == nil {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownSymbol, symbol)
+		}
+		resolved = append(resolved, exchange.Symbol)
+	}
+	if len(resolved) == 0 {
+		if registry != nil && registry.Default() != nil {
+			resolved = append(resolved, registry.Default().Symbol)
+		} else {
+			resolved = append(resolved, DefaultSymbol)
+		}
+	}
+
+	subscriptions := make([]Subscription, 0, len(channels)*len(resolved))
+	for _, channel := range channels {
+		switch channel {
+		case OrdersChannel:
+			if accountID == "" {
+				return nil, ErrAccountRequired
+			}
+			if registry == nil || !registry.Accounts().Exists(accountID) {
+				return nil, fmt.Errorf("%w: %s", ErrUnknownAccount, accountID)
+			}
+			subscriptions = append(subscriptions, Subscription{Channel: OrdersChannel, AccountID: accountID})
+		case PriceChannel, BookChannel, LevelsChannel, TradesChannel, CandlesChannel:
+			for _, symbol := range resolved {
+				subscription := Subscription{Channel: channel, Symbol: symbol}
+				switch channel {
+				case BookChannel:
+					subscription.Depth = depth
+				case CandlesChannel:
+					subscription.Interval = candleInterval
+				}
+				subscriptions = append(subscriptions, subscription)
+			}
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnknownChannel, channel)
+		}
+	}
+	return subscriptions, nil
+}
+
+// splitList splits comma separated query values into their trimmed, non-empty items
+func splitList(values []string) []string {
+	items := make([]string, 0, len(values))
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// truncateBook limits each side of an order book to its best depth entries.
+// A depth of zero leaves the book unchanged, with the entries GetOrderBook returns.
+func truncateBook(orderBook OrderBook, depth int) OrderBook {
+	if depth <= 0 {
+		return orderBook
+	}
+	if len(orderBook.BuyOrders) > depth {
+		orderBook.BuyOrders = orderBook.BuyOrders[:depth]
+	}
+	if len(orderBook.SellOrders) > depth {
+		orderBook.SellOrders = orderBook.SellOrders[:depth]
+	}
+	return orderBook
+}
@@ -0,0 +1,93 @@
+package exchange
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResolveSubscriptions(t *testing.T) {
+	registry := NewInstrumentRegistry()
+	registry.Add("AAPL", 150)
+	registry.Add("MSFT", 300)
+	registry.Accounts().Open("alice", 1000)
+
+	testCases := []struct {
+		name          string
+		channels      []Channel
+		symbols       []string
+		accountID     string
+		depth         int
+		expectedCount int
+		expectedErr   error
+	}{
+		{"Defaults", nil, nil, "", 0, len(defaultChannels), nil},
+		{"Default Channels For Symbols", nil, []string{"aapl", "MSFT"}, "", 0, 2 * len(defaultChannels), nil},
+		{"Book With Depth", []Channel{BookChannel}, []string{"MSFT"}, "", 5, 1, nil},
+		{"Orders", []Channel{OrdersChannel, CandlesChannel}, nil, "alice", 0, 2, nil},
+		{"Orders Without Account", []Channel{OrdersChannel}, nil, "", 0, 0, ErrAccountRequired},
+		{"Orders For Unknown Account", []Channel{OrdersChannel}, nil, "bob", 0, 0, ErrUnknownAccount},
+		{"Unknown Channel", []Channel{"news"}, nil, "", 0, 0, ErrUnknownChannel},
+		{"Unknown Symbol", nil, []string{"GOOG"}, "", 0, 0, ErrUnknownSymbol},
+		{"Negative Depth", []Channel{BookChannel}, nil, "", -1, 0, ErrInvalidDepth},
+		{"Maximum Depth", []Channel{BookChannel}, nil, "", orderBookSize, 1, nil},
+		{"Depth Beyond Broadcast Book", []Channel{BookChannel}, nil, "", orderBookSize + 1, 0, ErrInvalidDepth},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			subscriptions, err := resolveSubscriptions(tc.channels, tc.symbols, tc.accountID, tc.depth, "", registry)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("Expected error %v, got %v", tc.expectedErr, err)
+			}
+			if len(subscriptions) != tc.expectedCount {
+				t.Errorf("Expected %d subscriptions, got %d: %+v", tc.expectedCount, len(subscriptions), subscriptions)
+			}
+			for _, subscription := range subscriptions {
+				if subscription.Channel != OrdersChannel && subscription.Symbol == "" {
+					t.Errorf("Expected a symbol for the %s channel", subscription.Channel)
+				}
+				if subscription.Channel == BookChannel && subscription.Depth != tc.depth {
+					t.Errorf("Expected depth %d, got %d", tc.depth, subscription.Depth)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveCandleInterval(t *testing.T) {
+	registry := NewInstrumentRegistry()
+	registry.Add("AAPL", 150)
+
+	subscriptions, err := resolveSubscriptions([]Channel{CandlesChannel, TradesChannel}, nil, "", 0, "5m", registry)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for _, subscription := range subscriptions {
+		expected := CandleInterval("")
+		if subscription.Channel == CandlesChannel {
+			expected = Interval5m
+		}
+		if subscription.Interval != expected {
+			t.Errorf("Expected the %s channel to have interval %q, got %q", subscription.Channel, expected, subscription.Interval)
+		}
+	}
+
+	if _, err := resolveSubscriptions([]Channel{CandlesChannel}, nil, "", 0, "2m", registry); !errors.Is(err, ErrUnknownInterval) {
+		t.Errorf("Expected ErrUnknownInterval, got %v", err)
+	}
+}
+
+func TestTruncateBook(t *testing.T) {
+	orderBook := OrderBook{
+		BuyOrders:  []OrderBookEntry{{Price: 99}, {Price: 98}, {Price: 97}},
+		SellOrders: []OrderBookEntry{{Price: 101}},
+	}
+
+	truncated := truncateBook(orderBook, 2)
+	if len(truncated.BuyOrders) != 2 || len(truncated.SellOrders) != 1 {
+		t.Errorf("Expected 2 buy and 1 sell entries, got %d and %d", len(truncated.BuyOrders), len(truncated.SellOrders))
+	}
+	if full := truncateBook(orderBook, 0); len(full.BuyOrders) != 3 {
+		t.Errorf("Expected depth 0 to keep all 3 buy entries, got %d", len(full.BuyOrders))
+	}
+}
@@ -0,0 +1,76 @@
+package exchange
+
+import (
+	"sync"
+	"time"
+)
+
+// Trade is an execution between a buy and a sell order
+type Trade struct {
+	ID          string                 `json:"id"`
+	Symbol      string                 `json:"symbol"`
+	BuyOrderID  string                 `json:"buyOrderId"`
+	SellOrderID string                 `json:"sellOrderId"`
+	Price       TransactionAmtDataType `json:"price"`
+	Quantity    TransactionQtyDataType `json:"quantity"`
+	// Aggressor is the side (BUY or SELL) of the order that took liquidity
+	Aggressor string    `json:"aggressor"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// TradeTape keeps the most recent trades in a fixed size ring buffer
+type TradeTape struct {
+	trades []Trade
+	start  int
+	count  int
+	mutex  sync.RWMutex
+}
+
+// NewTradeTape creates a trade tape holding at most capacity trades
+func NewTradeTape(capacity int) *TradeTape {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &TradeTape{
+		trades: make([]Trade, capacity),
+	}
+}
+
+// Add appends a trade to the tape, evicting the oldest one when the tape is full
+func (tt *TradeTape) Add(trade Trade) {
+	tt.mutex.Lock()
+	defer tt.mutex.Unlock()
+
+	end := (tt.start + tt.count) % len(tt.trades)
+	tt.trades[end] = trade
+	if tt.count < len(tt.trades) {
+		tt.count++
+	} else {
+		tt.start = (tt.start + 1) % len(tt.trades)
+	}
+}
+
+// Recent returns up to limit of the most recent trades, oldest first.
+// A limit of zero or less returns every trade on the tape.
+func (tt *TradeTape) Recent(limit int) []Trade {
+	tt.mutex.RLock()
+	defer tt.mutex.RUnlock()
+
+	if limit <= 0 || limit > tt.count {
+		limit = tt.count
+	}
+
+	result := make([]Trade, 0, limit)
+	for i := tt.count - limit; i < tt.count; i++ {
+		result = append(result, tt.trades[(tt.start+i)%len(tt.trades)])
+	}
+	return result
+}
+
+// Len returns the number of trades on the tape
+func (tt *TradeTape) Len() int {
+	tt.mutex.RLock()
+	defer tt.mutex.RUnlock()
+
+	return tt.count
+}
@@ -0,0 +1,39 @@
+package exchange
+
+import (
+	"testing"
+)
+
+func TestTradeTape(t *testing.T) {
+	tape := NewTradeTape(3)
+
+	if trades := tape.Recent(10); len(trades) != 0 {
+		t.Errorf("Expected an empty tape, got %d trades", len(trades))
+	}
+
+	for i := 1; i <= 5; i++ {
+		tape.Add(Trade{Price: TransactionAmtDataType(100 + i)})
+	}
+
+	// Only the last 3 trades are kept
+	if tape.Len() != 3 {
+		t.Errorf("Expected 3 trades on the tape, got %d", tape.Len())
+	}
+
+	trades := tape.Recent(0)
+	if len(trades) != 3 {
+		t.Fatalf("Expected 3 trades, got %d", len(trades))
+	}
+	for i, trade := range trades {
+		expectedPrice := TransactionAmtDataType(103 + i)
+		if trade.Price != expectedPrice {
+			t.Errorf("Expected price %d at index %d, got %d", expectedPrice, i, trade.Price)
+		}
+	}
+
+	// A limit returns the most recent trades, oldest first
+	trades = tape.Recent(2)
+	if len(trades) != 2 || trades[0].Price != 104 || trades[1].Price != 105 {
+		t.Errorf("Expected the 2 most recent trades [104 105], got %+v", trades)
+	}
+}
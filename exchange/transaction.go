@@ -2,36 +2,159 @@ package exchange
 
 import (
 	"fmt"
-	"time"
+	"sync/atomic"
 )
 
 type Transaction struct {
-	ID     string
+	ID string
+	// Symbol is the instrument traded; an empty value means the exchange's own symbol
+	Symbol string
+	// AccountID is the account that owns the order; anonymous orders leave it empty
+	AccountID string
 	Type   string
+	// OrderType controls how the order is matched; an empty value is treated as a limit order
+	OrderType string
+	// Amount is the limit price, ignored for market orders
 	Amount TransactionAmtDataType
+	// Quantity is the number of units ordered and Filled how many of them have traded
+	Quantity TransactionQtyDataType
+	Filled   TransactionQtyDataType
+	// Seq is assigned by the exchange when the order is accepted and gives
+	// earlier orders priority over later ones at the same price
+	Seq uint64
 }
 
 type TransactionAmtDataType int32
 
+type TransactionQtyDataType int32
+
 const (
 	BuyTransactionType  = "BUY"
 	SellTransactionType = "SELL"
 )
 
-// generateID creates a unique ID for a transaction based on timestamp and type
+const (
+	// LimitOrderType matches at the limit price or better and rests any remainder in the book
+	LimitOrderType = "LIMIT"
+	// MarketOrderType sweeps the opposite book at any price until filled or the book is empty
+	MarketOrderType = "MARKET"
+	// ImmediateOrCancelOrderType matches what it can at the limit price or better and cancels the rest
+	ImmediateOrCancelOrderType = "IOC"
+	// FillOrKillOrderType is filled completely at the limit price or better, or cancelled without any fills
+	FillOrKillOrderType = "FOK"
+)
+
+// OrderStatus describes the state of an order after the exchange has processed it
+type OrderStatus string
+
+const (
+	OrderStatusNew             OrderStatus = "NEW"
+	OrderStatusPartiallyFilled OrderStatus = "PARTIALLY_FILLED"
+	OrderStatusFilled          OrderStatus = "FILLED"
+	OrderStatusCancelled       OrderStatus = "CANCELLED"
+	OrderStatusRejected        OrderStatus = "REJECTED"
+)
+
+// OrderReport reports the outcome of processing an order back to its submitter
+type OrderReport struct {
+	OrderID   string                 `json:"orderId"`
+	AccountID string                 `json:"accountId,omitempty"`
+	Symbol    string                 `json:"symbol"`
+	Type      string                 `json:"type"`
+	OrderType string                 `json:"orderType"`
+	Status    OrderStatus            `json:"status"`
+	Price     TransactionAmtDataType `json:"price"`
+	Quantity  TransactionQtyDataType `json:"quantity"`
+	Filled    TransactionQtyDataType `json:"filled"`
+	// Cancelled is the unfilled quantity that was not placed in the book
+	Cancelled TransactionQtyDataType `json:"cancelled"`
+	// RejectReason and Reason explain why a rejected order never reached the book
+	RejectReason RejectReason `json:"rejectReason,omitempty"`
+	Reason       string       `json:"reason,omitempty"`
+}
+
+// IsOpen reports whether the order is still resting in the book
+func (report OrderReport) IsOpen() bool {
+	return report.Status == OrderStatusNew || report.Status == OrderStatusPartiallyFilled
+}
+
+// lastIDTimestamp is the timestamp used by the most recently generated ID
+var lastIDTimestamp int64
+
+// generateID creates a unique ID for a transaction based on timestamp and type.
+// IDs generated within the same nanosecond are bumped forward so they never collide.
 func generateID(txnType string) string {
-	timestamp := time.Now().UnixNano()
-	return fmt.Sprintf("%s-%d", txnType, timestamp)
+	return nextID(RealClock, &lastIDTimestamp, txnType)
+}
+
+// nextID creates an ID from the clock's time, bumping it past the last timestamp used
+func nextID(clock Clock, lastTimestamp *int64, txnType string) string {
+	timestamp := clock.Now().UnixNano()
+	for {
+		last := atomic.LoadInt64(lastTimestamp)
+		next := timestamp
+		if next <= last {
+			next = last + 1
+		}
+		if atomic.CompareAndSwapInt64(lastTimestamp, last, next) {
+			return fmt.Sprintf("%s-%d", txnType, next)
+		}
+	}
 }
 
 /**
  * NewTransaction
- * Returns an instance of a new transaction with a unique ID
+ * Returns an instance of a new single unit transaction with a unique ID
  */
 func NewTransaction(t string, amount TransactionAmtDataType) Transaction {
+	return NewTransactionWithQuantity(t, amount, 1)
+}
+
+/**
+ * NewTransactionWithQuantity
+ * Returns an instance of a new transaction for the given quantity with a unique ID
+ */
+func NewTransactionWithQuantity(t string, amount TransactionAmtDataType, quantity TransactionQtyDataType) Transaction {
 	return Transaction{
-		ID:     generateID(t),
-		Type:   t,
-		Amount: amount,
+		ID:        generateID(t),
+		Type:      t,
+		OrderType: LimitOrderType,
+		Amount:    amount,
+		Quantity:  quantity,
+	}
+}
+
+// isValidOrderType reports whether the exchange knows how to match the order type
+func isValidOrderType(orderType string) bool {
+	switch orderType {
+	case "", LimitOrderType, MarketOrderType, ImmediateOrCancelOrderType, FillOrKillOrderType:
+		return true
+	}
+	return false
+}
+
+// IsMarket reports whether the order ignores its price
+func (txn Transaction) IsMarket() bool {
+	return txn.OrderType == MarketOrderType
+}
+
+// Rests reports whether an unfilled remainder of the order is placed in the book
+func (txn Transaction) Rests() bool {
+	return txn.OrderType == "" || txn.OrderType == LimitOrderType
+}
+
+// crosses reports whether the order can trade against a resting order on the opposite side
+func (txn Transaction) crosses(resting Transaction) bool {
+	if txn.IsMarket() {
+		return true
+	}
+	if txn.Type == BuyTransactionType {
+		return txn.Amount >= resting.Amount
 	}
+	return txn.Amount <= resting.Amount
+}
+
+// Remaining returns the quantity that has not been filled yet
+func (txn Transaction) Remaining() TransactionQtyDataType {
+	return txn.Quantity - txn.Filled
 }
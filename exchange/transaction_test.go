@@ -2,6 +2,7 @@ package exchange
 
 import (
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -138,3 +139,49 @@ func TestTransactionIDFormat(t *testing.T) {
 		t.Errorf("Expected transaction ID to start with %s, got %s", SellTransactionType, parts[0])
 	}
 }
+
+func TestTransactionQuantity(t *testing.T) {
+	// NewTransaction defaults to a single unit
+	txn := NewTransaction(BuyTransactionType, 100)
+	if txn.Quantity != 1 || txn.Remaining() != 1 {
+		t.Errorf("Expected a single unit transaction, got quantity %d remaining %d", txn.Quantity, txn.Remaining())
+	}
+
+	txn = NewTransactionWithQuantity(SellTransactionType, 100, 10)
+	if txn.Quantity != 10 || txn.Filled != 0 {
+		t.Errorf("Expected quantity 10 and nothing filled, got quantity %d filled %d", txn.Quantity, txn.Filled)
+	}
+
+	txn.Filled = 4
+	if txn.Remaining() != 6 {
+		t.Errorf("Expected 6 remaining, got %d", txn.Remaining())
+	}
+}
+
+func TestTransactionIDUniquenessConcurrent(t *testing.T) {
+	// IDs generated back to back from several goroutines must never collide
+	const numGoroutines = 8
+	const numTransactions = 1000
+
+	var mu sync.Mutex
+	ids := make(map[string]bool)
+	var wg sync.WaitGroup
+	wg.Add(numGoroutines)
+
+	for i := 0; i < numGoroutines; i++ {
+		go func() {
+			defer wg.Done()
+			for j := 0; j < numTransactions; j++ {
+				txn := NewTransaction(BuyTransactionType, 100)
+				mu.Lock()
+				if ids[txn.ID] {
+					t.Errorf("Duplicate transaction ID found: %s", txn.ID)
+				}
+				ids[txn.ID] = true
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+}
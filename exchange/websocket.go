@@ -2,8 +2,14 @@ package exchange
 
 import (
 	"encoding/json"
+	"fmt"
+	"math"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -17,47 +23,137 @@ const (
 	PriceUpdateMessage MessageType = "price_update"
 	// OrderBookMessage is sent when the order book changes
 	OrderBookMessage MessageType = "order_book"
+	// BookSnapshotMessage is sent with every price level of a book when the levels
+	// channel is subscribed or a resync is requested
+	BookSnapshotMessage MessageType = "book_snapshot"
+	// BookUpdateMessage is sent with the price levels changed by each operation on a book
+	BookUpdateMessage MessageType = "book_update"
+	// TradeMessage is sent for every executed trade
+	TradeMessage MessageType = "trade"
+	// OrderReportMessage is sent to a client in reply to an order request
+	OrderReportMessage MessageType = "order_report"
+	// ErrorMessage is sent to a client when its request cannot be processed
+	ErrorMessage MessageType = "error"
+	// CandleMessage is sent when a candle of a symbol is updated
+	CandleMessage MessageType = "candle"
+	// SubscriptionsMessage is sent to a client in reply to a subscribe or unsubscribe request
+	SubscriptionsMessage MessageType = "subscriptions"
+	// PongMessage is sent to a client in reply to a ping
+	PongMessage MessageType = "pong"
+
+	// PlaceOrderRequest is sent by a client to submit a new order
+	PlaceOrderRequest MessageType = "place_order"
+	// CancelOrderRequest is sent by a client to cancel a resting order
+	CancelOrderRequest MessageType = "cancel_order"
+	// AmendOrderRequest is sent by a client to change the price and quantity of a resting order
+	AmendOrderRequest MessageType = "amend_order"
+	// SubscribeRequest is sent by a client to receive more channels
+	SubscribeRequest MessageType = "subscribe"
+	// UnsubscribeRequest is sent by a client to stop receiving channels
+	UnsubscribeRequest MessageType = "unsubscribe"
+	// ResyncRequest is sent by a client that missed a book update to receive a new book snapshot
+	ResyncRequest MessageType = "resync"
+	// PingRequest is sent by a client to check that the connection is alive
+	PingRequest MessageType = "ping"
 )
 
-// WebSocketMessage is the base structure for all messages sent over WebSocket
+// WebSocketMessage is the base structure for all messages sent over WebSocket.
+// Replies to a client request echo the request's ID.
 type WebSocketMessage struct {
 	Type      MessageType `json:"type"`
+	RequestID string      `json:"requestId,omitempty"`
 	Timestamp time.Time   `json:"timestamp"`
 	Data      interface{} `json:"data"`
 }
 
 // PriceUpdate represents a price update message sent to clients
 type PriceUpdate struct {
-	Price int `json:"price"`
+	Symbol string `json:"symbol"`
+	Price  int    `json:"price"`
+}
+
+// ClientMessage is a request sent by a client over WebSocket. Only the fields used
+// by the request type need to be set. An empty symbol refers to the default instrument.
+type ClientMessage struct {
+	Type MessageType `json:"type"`
+	// RequestID is chosen by the client and echoed in the reply
+	RequestID string `json:"requestId,omitempty"`
+	Symbol    string `json:"symbol,omitempty"`
+	// Channels, Symbols, Depth and Interval describe a subscribe or unsubscribe
+	// request. The orders channel is subscribed for AccountID.
+	Channels []Channel `json:"channels,omitempty"`
+	Symbols  []string  `json:"symbols,omitempty"`
+	Depth    int       `json:"depth,omitempty"`
+	Interval string    `json:"interval,omitempty"`
+	// OrderID identifies the order to cancel or amend
+	OrderID string `json:"orderId,omitempty"`
+	// Side, OrderType and AccountID describe an order to place
+	Side      string `json:"side,omitempty"`
+	OrderType string `json:"orderType,omitempty"`
+	AccountID string `json:"accountId,omitempty"`
+	Price     int    `json:"price,omitempty"`
+	Quantity  int    `json:"quantity,omitempty"`
+}
+
+// ErrorResponse describes why a client request failed
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// SubscriptionsResponse lists the channels a client receives
+type SubscriptionsResponse struct {
+	Subscriptions []Subscription `json:"subscriptions"`
 }
 
 // WebSocketManager manages WebSocket connections and broadcasts updates
 type WebSocketManager struct {
-	clients      map[*websocket.Conn]bool
+	clients      map[*websocket.Conn]*wsClient
 	clientsMutex sync.Mutex
 	upgrader     websocket.Upgrader
-	priceHistory []WebSocketMessage
+	// priceHistory keeps the most recent price updates of each symbol
+	priceHistory map[string][]WebSocketMessage
 	historyMutex sync.Mutex
 	logger       *Logger
+	// clock stamps every message
+	clock Clock
+	// Counters of messages that never reached slow clients
+	droppedMessages       int64
+	conflatedSnapshots    int64
+	slowClientDisconnects int64
 }
 
+// priceHistorySize is the number of price updates kept per symbol
+const priceHistorySize = 100
+
 // NewWebSocketManager creates a new WebSocketManager
 func NewWebSocketManager() *WebSocketManager {
 	return &WebSocketManager{
-		clients:      make(map[*websocket.Conn]bool),
+		clients:      make(map[*websocket.Conn]*wsClient),
 		upgrader: websocket.Upgrader{
 			ReadBufferSize:  1024,
 			WriteBufferSize: 1024,
 			// Allow connections from any origin for development
 			CheckOrigin: func(r *http.Request) bool { return true },
 		},
-		priceHistory: make([]WebSocketMessage, 0, 100),
+		priceHistory: make(map[string][]WebSocketMessage),
 		logger:       NewLogger("WebSocket"),
+		clock:        RealClock,
 	}
 }
 
-// HandleWebSocket handles WebSocket connections
-func (wsm *WebSocketManager) HandleWebSocket(w http.ResponseWriter, r *http.Request, exchange *Exchange) {
+// SetClock sets the clock that stamps messages. It must be called before clients connect.
+func (wsm *WebSocketManager) SetClock(clock Clock) {
+	wsm.clock = clock
+	wsm.logger.SetClock(clock)
+}
+
+// HandleWebSocket handles WebSocket connections. Clients pick what they receive
+// with the channel, symbol, depth and account query parameters, each of which may
+// be repeated or comma separated (/ws?channel=price,book&symbol=AAPL&depth=5), and
+// limit the candles channel to one interval with the interval parameter.
+// Without channels a client receives the price, book and trades channels, and
+// without symbols the registry's default instrument.
+func (wsm *WebSocketManager) HandleWebSocket(w http.ResponseWriter, r *http.Request, registry *InstrumentRegistry) {
 	// Upgrade the HTTP connection to a WebSocket connection
 	conn, err := wsm.upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -65,131 +161,497 @@ func (wsm *WebSocketManager) HandleWebSocket(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	client := newWSClient(conn)
+	go client.writePump(wsm.logger)
+
+	subscriptions, err := connectSubscriptions(r, registry)
+	if err != nil {
+		wsm.sendError(client, "", err.Error())
+		subscriptions, _ = resolveSubscriptions(nil, nil, "", 0, "", registry)
+	}
+
 	// Register the new client
 	wsm.clientsMutex.Lock()
-	wsm.clients[conn] = true
+	for _, subscription := range subscriptions {
+		client.subscriptions[subscription.topic()] = subscription
+	}
+	wsm.clients[conn] = client
 	wsm.clientsMutex.Unlock()
 
-	wsm.logger.Info("New client connected")
-
-	// Send the price history to the new client
-	wsm.historyMutex.Lock()
-	if len(wsm.priceHistory) > 0 {
-		historyJSON, err := json.Marshal(wsm.priceHistory)
-		if err == nil {
-			conn.WriteMessage(websocket.TextMessage, historyJSON)
+	// Level updates are deltas, so their subscribers start from a snapshot
+	for _, subscription := range subscriptions {
+		if subscription.Channel == LevelsChannel {
+			wsm.sendSnapshot(client, subscription, registry)
 		}
 	}
-	wsm.historyMutex.Unlock()
-
-	// Send the current order book to the new client
-	if exchange != nil {
-		orderBook := exchange.GetOrderBook()
-		message := WebSocketMessage{
-			Type:      OrderBookMessage,
-			Timestamp: time.Now(),
-			Data:      orderBook,
-		}
 
-		messageJSON, err := json.Marshal(message)
-		if err == nil {
-			conn.WriteMessage(websocket.TextMessage, messageJSON)
-		}
-	}
+	wsm.logger.Info("New client connected")
 
-	// Handle disconnections
+	// Handle client requests and disconnections
 	go func() {
 		for {
-			// Read messages from the client (we don't actually use them, but need to detect disconnections)
-			_, _, err := conn.ReadMessage()
+			_, data, err := conn.ReadMessage()
 			if err != nil {
 				wsm.clientsMutex.Lock()
 				delete(wsm.clients, conn)
 				wsm.clientsMutex.Unlock()
-				conn.Close()
+				client.close()
 				wsm.logger.Info("Client disconnected")
 				break
 			}
+			wsm.handleClientMessage(client, data, registry)
 		}
 	}()
 }
 
-// BroadcastPriceUpdate broadcasts a price update to all connected clients
+// connectSubscriptions returns the subscriptions named in the query parameters of a connection request
+func connectSubscriptions(r *http.Request, registry *InstrumentRegistry) ([]Subscription, error) {
+	query := r.URL.Query()
+
+	var channels []Channel
+	for _, channel := range splitList(query["channel"]) {
+		channels = append(channels, Channel(strings.ToLower(channel)))
+	}
+
+	depth := 0
+	if value := query.Get("depth"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, ErrInvalidDepth
+		}
+		depth = parsed
+	}
+
+	return resolveSubscriptions(channels, splitList(query["symbol"]), query.Get("account"), depth, query.Get("interval"), registry)
+}
+
+// sendSnapshot sends the current state of a newly subscribed channel to a client:
+// the latest price of the price channel, the order book of the book channel and
+// the price levels of the levels channel
+func (wsm *WebSocketManager) sendSnapshot(client *wsClient, subscription Subscription, registry *InstrumentRegistry) {
+	switch subscription.Channel {
+	case PriceChannel:
+		history := wsm.GetSymbolPriceHistory(subscription.Symbol)
+		if len(history) > 0 {
+			wsm.sendToClient(client, history[len(history)-1])
+		}
+	case BookChannel:
+		if registry == nil {
+			return
+		}
+		if exchange, ok := registry.Get(subscription.Symbol); ok {
+			wsm.sendToClient(client, WebSocketMessage{
+				Type:      OrderBookMessage,
+				Timestamp: wsm.clock.Now(),
+				Data:      truncateBook(exchange.GetOrderBook(), subscription.Depth),
+			})
+		}
+	case LevelsChannel:
+		if registry == nil {
+			return
+		}
+		if exchange, ok := registry.Get(subscription.Symbol); ok {
+			wsm.reply(client, "", BookSnapshotMessage, exchange.GetBookSnapshot())
+		}
+	}
+}
+
+// handleClientMessage processes a request from a client and sends the reply back to it
+func (wsm *WebSocketManager) handleClientMessage(client *wsClient, data []byte, registry *InstrumentRegistry) {
+	var request ClientMessage
+	if err := json.Unmarshal(data, &request); err != nil {
+		wsm.sendError(client, "", "invalid message: "+err.Error())
+		return
+	}
+
+	switch request.Type {
+	case PingRequest:
+		wsm.reply(client, request.RequestID, PongMessage, nil)
+		return
+	case SubscribeRequest, UnsubscribeRequest:
+		wsm.handleSubscription(client, request, registry)
+		return
+	case ResyncRequest:
+		wsm.handleResync(client, request, registry)
+		return
+	case PlaceOrderRequest, CancelOrderRequest, AmendOrderRequest:
+	default:
+		wsm.sendError(client, request.RequestID, "unknown message type: "+string(request.Type))
+		return
+	}
+
+	exchange := requestExchange(registry, request.Symbol)
+	if exchange == nil {
+		wsm.sendError(client, request.RequestID, ErrUnknownSymbol.Error()+": "+request.Symbol)
+		return
+	}
+	// Prices and quantities that do not fit in an order would wrap to other values
+	if request.Price < math.MinInt32 || request.Price > math.MaxInt32 {
+		wsm.sendError(client, request.RequestID, "price out of range")
+		return
+	}
+	if request.Quantity < math.MinInt32 || request.Quantity > math.MaxInt32 {
+		wsm.sendError(client, request.RequestID, "quantity out of range")
+		return
+	}
+
+	var report OrderReport
+	var err error
+	switch request.Type {
+	case PlaceOrderRequest:
+		// Rejected orders are answered with their report, which carries the reason
+		report, _ = exchange.Submit(Transaction{
+			Type:      strings.ToUpper(request.Side),
+			OrderType: strings.ToUpper(request.OrderType),
+			AccountID: request.AccountID,
+			Amount:    TransactionAmtDataType(request.Price),
+			Quantity:  TransactionQtyDataType(request.Quantity),
+		})
+	case CancelOrderRequest:
+		report, err = exchange.CancelOrder(request.OrderID)
+	case AmendOrderRequest:
+		report, err = exchange.AmendOrder(request.OrderID,
+			TransactionAmtDataType(request.Price), TransactionQtyDataType(request.Quantity))
+	}
+
+	if err != nil {
+		wsm.sendError(client, request.RequestID, err.Error())
+		return
+	}
+	wsm.reply(client, request.RequestID, OrderReportMessage, report)
+}
+
+// handleSubscription adds or removes channels from what a client receives and
+// replies with its subscriptions. Newly subscribed channels are followed by a
+// snapshot of their current state.
+func (wsm *WebSocketManager) handleSubscription(client *wsClient, request ClientMessage, registry *InstrumentRegistry) {
+	symbols := request.Symbols
+	if request.Symbol != "" {
+		symbols = append(symbols, request.Symbol)
+	}
+
+	requested, err := resolveSubscriptions(request.Channels, symbols, request.AccountID, request.Depth, request.Interval, registry)
+	if err != nil {
+		wsm.sendError(client, request.RequestID, err.Error())
+		return
+	}
+
+	added := make([]Subscription, 0, len(requested))
+	wsm.clientsMutex.Lock()
+	for _, subscription := range requested {
+		if request.Type == UnsubscribeRequest {
+			delete(client.subscriptions, subscription.topic())
+			continue
+		}
+		if existing, ok := client.subscriptions[subscription.topic()]; !ok || existing != subscription {
+			client.subscriptions[subscription.topic()] = subscription
+			added = append(added, subscription)
+		}
+	}
+	subscriptions := make([]Subscription, 0, len(client.subscriptions))
+	for _, subscription := range client.subscriptions {
+		subscriptions = append(subscriptions, subscription)
+	}
+	wsm.clientsMutex.Unlock()
+
+	sort.Slice(subscriptions, func(i, j int) bool {
+		a, b := subscriptions[i], subscriptions[j]
+		if a.Channel != b.Channel {
+			return a.Channel < b.Channel
+		}
+		return a.Symbol+a.AccountID < b.Symbol+b.AccountID
+	})
+	wsm.reply(client, request.RequestID, SubscriptionsMessage, SubscriptionsResponse{Subscriptions: subscriptions})
+	for _, subscription := range added {
+		wsm.sendSnapshot(client, subscription, registry)
+	}
+}
+
+// requestExchange returns the exchange a request refers to, the default instrument
+// if it does not name a symbol, or nil if the symbol is not traded
+func requestExchange(registry *InstrumentRegistry, symbol string) *Exchange {
+	if registry == nil {
+		return nil
+	}
+	if symbol == "" {
+		return registry.Default()
+	}
+	exchange, _ := registry.Get(symbol)
+	return exchange
+}
+
+// handleResync replies with a new snapshot of a book whose levels the client is subscribed to
+func (wsm *WebSocketManager) handleResync(client *wsClient, request ClientMessage, registry *InstrumentRegistry) {
+	exchange := requestExchange(registry, request.Symbol)
+	if exchange == nil {
+		wsm.sendError(client, request.RequestID, ErrUnknownSymbol.Error()+": "+request.Symbol)
+		return
+	}
+
+	wsm.clientsMutex.Lock()
+	_, subscribed := client.subscriptions[topic{channel: LevelsChannel, key: exchange.Symbol}]
+	wsm.clientsMutex.Unlock()
+	if !subscribed {
+		wsm.sendError(client, request.RequestID, "not subscribed to the levels of "+exchange.Symbol)
+		return
+	}
+
+	wsm.reply(client, request.RequestID, BookSnapshotMessage, exchange.GetBookSnapshot())
+}
+
+// reply sends the response to a client request, echoing its ID
+func (wsm *WebSocketManager) reply(client *wsClient, requestID string, messageType MessageType, data interface{}) {
+	wsm.sendToClient(client, WebSocketMessage{
+		Type:      messageType,
+		RequestID: requestID,
+		Timestamp: wsm.clock.Now(),
+		Data:      data,
+	})
+}
+
+// sendError sends an error message in reply to a client request
+func (wsm *WebSocketManager) sendError(client *wsClient, requestID string, message string) {
+	wsm.reply(client, requestID, ErrorMessage, ErrorResponse{Error: message})
+}
+
+// sendToClient queues a message for a single client
+func (wsm *WebSocketManager) sendToClient(client *wsClient, message WebSocketMessage) {
+	messageJSON, err := json.Marshal(message)
+	if err != nil {
+		wsm.logger.Error("Failed to marshal message: " + err.Error())
+		return
+	}
+
+	wsm.sendRaw(client, messageJSON)
+}
+
+// sendRaw queues an encoded message for a single client, disconnecting the client
+// if it has fallen so far behind that its queue is full
+func (wsm *WebSocketManager) sendRaw(client *wsClient, messageJSON []byte) {
+	if client.enqueue(messageJSON) {
+		return
+	}
+
+	// The message and everything still queued will never be delivered
+	dropped := int64(1 + client.pending())
+	atomic.AddInt64(&wsm.droppedMessages, dropped)
+	atomic.AddInt64(&wsm.slowClientDisconnects, 1)
+	wsm.logger.Warn(fmt.Sprintf("Disconnecting slow client, dropped %d queued messages", dropped))
+	client.close()
+}
+
+// Stats returns the number of connected clients and counters of the messages that
+// could not be delivered to slow clients
+func (wsm *WebSocketManager) Stats() map[string]int64 {
+	wsm.clientsMutex.Lock()
+	clients := len(wsm.clients)
+	wsm.clientsMutex.Unlock()
+
+	return map[string]int64{
+		"Clients":               int64(clients),
+		"DroppedMessages":       atomic.LoadInt64(&wsm.droppedMessages),
+		"ConflatedSnapshots":    atomic.LoadInt64(&wsm.conflatedSnapshots),
+		"SlowClientDisconnects": atomic.LoadInt64(&wsm.slowClientDisconnects),
+	}
+}
+
+// BroadcastPriceUpdate broadcasts a price update of the default symbol to its subscribers
 func (wsm *WebSocketManager) BroadcastPriceUpdate(price int) {
+	wsm.BroadcastSymbolPriceUpdate(DefaultSymbol, price)
+}
+
+// BroadcastSymbolPriceUpdate broadcasts a price update to the clients subscribed to the symbol
+func (wsm *WebSocketManager) BroadcastSymbolPriceUpdate(symbol string, price int) {
 	priceData := PriceUpdate{
-		Price: price,
+		Symbol: symbol,
+		Price:  price,
 	}
 
 	message := WebSocketMessage{
 		Type:      PriceUpdateMessage,
-		Timestamp: time.Now(),
+		Timestamp: wsm.clock.Now(),
 		Data:      priceData,
 	}
 
 	// Add to price history
 	wsm.historyMutex.Lock()
-	wsm.priceHistory = append(wsm.priceHistory, message)
+	history := append(wsm.priceHistory[symbol], message)
 	// Keep only the last 100 price updates
-	if len(wsm.priceHistory) > 100 {
-		wsm.priceHistory = wsm.priceHistory[len(wsm.priceHistory)-100:]
+	if len(history) > priceHistorySize {
+		history = history[len(history)-priceHistorySize:]
 	}
+	wsm.priceHistory[symbol] = history
 	wsm.historyMutex.Unlock()
 
-	// Marshal the message to JSON
-	messageJSON, err := json.Marshal(message)
-	if err != nil {
-		wsm.logger.Error("Failed to marshal price update: " + err.Error())
+	wsm.broadcast(topic{channel: PriceChannel, key: symbol}, message)
+}
+
+// RestorePriceHistory rebuilds the price history of a symbol from its trades, oldest
+// first, such as those recovered from the journal. The updates are not broadcast.
+func (wsm *WebSocketManager) RestorePriceHistory(symbol string, trades []Trade) {
+	if len(trades) > priceHistorySize {
+		trades = trades[len(trades)-priceHistorySize:]
+	}
+	history := make([]WebSocketMessage, 0, len(trades))
+	for _, trade := range trades {
+		history = append(history, WebSocketMessage{
+			Type:      PriceUpdateMessage,
+			Timestamp: trade.Timestamp,
+			Data:      PriceUpdate{Symbol: symbol, Price: int(trade.Price)},
+		})
+	}
+
+	wsm.historyMutex.Lock()
+	wsm.priceHistory[symbol] = history
+	wsm.historyMutex.Unlock()
+}
+
+// BroadcastTrade broadcasts an executed trade to the clients subscribed to the trades of its symbol
+func (wsm *WebSocketManager) BroadcastTrade(trade Trade) {
+	wsm.broadcast(topic{channel: TradesChannel, key: trade.Symbol}, WebSocketMessage{
+		Type:      TradeMessage,
+		Timestamp: wsm.clock.Now(),
+		Data:      trade,
+	})
+}
+
+// BroadcastBookUpdate sends the price levels changed on a book to the clients
+// subscribed to its levels. Updates are queued in order and never conflated.
+func (wsm *WebSocketManager) BroadcastBookUpdate(update BookUpdate) {
+	wsm.broadcast(topic{channel: LevelsChannel, key: update.Symbol}, WebSocketMessage{
+		Type:      BookUpdateMessage,
+		Timestamp: update.Timestamp,
+		Data:      update,
+	})
+}
+
+// BroadcastCandle sends an updated candle to the clients subscribed to the candles of
+// its symbol, unless their subscription is limited to another interval
+func (wsm *WebSocketManager) BroadcastCandle(candle Candle) {
+	t := topic{channel: CandlesChannel, key: candle.Symbol}
+	message := WebSocketMessage{
+		Type:      CandleMessage,
+		Timestamp: wsm.clock.Now(),
+		Data:      candle,
+	}
+	wsm.broadcastMatching(t, message, func(subscription Subscription) bool {
+		return subscription.Interval == "" || subscription.Interval == candle.Interval
+	})
+}
+
+// BroadcastOrderReport sends an order report to the clients subscribed to the orders
+// of its account. Reports of anonymous orders are not sent.
+func (wsm *WebSocketManager) BroadcastOrderReport(report OrderReport) {
+	if report.AccountID == "" {
 		return
 	}
+	wsm.broadcast(topic{channel: OrdersChannel, key: report.AccountID}, WebSocketMessage{
+		Type:      OrderReportMessage,
+		Timestamp: wsm.clock.Now(),
+		Data:      report,
+	})
+}
 
-	// Broadcast to all clients
+// HasSubscribers reports whether any client is subscribed to a channel of a symbol,
+// or to the orders of an account, so callers can skip building unwanted updates
+func (wsm *WebSocketManager) HasSubscribers(channel Channel, key string) bool {
 	wsm.clientsMutex.Lock()
-	for client := range wsm.clients {
-		err := client.WriteMessage(websocket.TextMessage, messageJSON)
-		if err != nil {
-			wsm.logger.Warn("Error sending to client: " + err.Error())
-			client.Close()
-			delete(wsm.clients, client)
+	defer wsm.clientsMutex.Unlock()
+
+	t := topic{channel: channel, key: key}
+	for _, client := range wsm.clients {
+		if _, ok := client.subscriptions[t]; ok {
+			return true
 		}
 	}
-	wsm.clientsMutex.Unlock()
+	return false
 }
 
-// GetPriceHistory returns the price history
+// GetPriceHistory returns the price history of the default symbol
 func (wsm *WebSocketManager) GetPriceHistory() []WebSocketMessage {
+	return wsm.GetSymbolPriceHistory(DefaultSymbol)
+}
+
+// GetSymbolPriceHistory returns the price history of a symbol
+func (wsm *WebSocketManager) GetSymbolPriceHistory(symbol string) []WebSocketMessage {
 	wsm.historyMutex.Lock()
 	defer wsm.historyMutex.Unlock()
 
 	// Return a copy to avoid race conditions
-	history := make([]WebSocketMessage, len(wsm.priceHistory))
-	copy(history, wsm.priceHistory)
+	history := make([]WebSocketMessage, len(wsm.priceHistory[symbol]))
+	copy(history, wsm.priceHistory[symbol])
 	return history
 }
 
-// BroadcastOrderBook broadcasts the current order book to all connected clients
+// BroadcastOrderBook broadcasts an order book to the clients subscribed to the book
+// of its symbol, limited to the depth of each subscription. The book is encoded once
+// per requested depth. An order book without a symbol belongs to the default instrument.
 func (wsm *WebSocketManager) BroadcastOrderBook(orderBook OrderBook) {
-	message := WebSocketMessage{
-		Type:      OrderBookMessage,
-		Timestamp: time.Now(),
-		Data:      orderBook,
+	symbol := orderBook.Symbol
+	if symbol == "" {
+		symbol = DefaultSymbol
 	}
+	t := topic{channel: BookChannel, key: symbol}
+	timestamp := wsm.clock.Now()
 
-	// Marshal the message to JSON
-	messageJSON, err := json.Marshal(message)
-	if err != nil {
-		wsm.logger.Error("Failed to marshal order book: " + err.Error())
-		return
+	wsm.clientsMutex.Lock()
+	defer wsm.clientsMutex.Unlock()
+
+	encoded := make(map[int][]byte)
+	for _, client := range wsm.clients {
+		subscription, ok := client.subscriptions[t]
+		if !ok {
+			continue
+		}
+
+		messageJSON, ok := encoded[subscription.Depth]
+		if !ok {
+			var err error
+			messageJSON, err = json.Marshal(WebSocketMessage{
+				Type:      OrderBookMessage,
+				Timestamp: timestamp,
+				Data:      truncateBook(orderBook, subscription.Depth),
+			})
+			if err != nil {
+				wsm.logger.Error("Failed to marshal order book: " + err.Error())
+				return
+			}
+			encoded[subscription.Depth] = messageJSON
+		}
+
+		// A newer order book supersedes one the client has not received yet
+		if client.enqueueBook(symbol, messageJSON) {
+			atomic.AddInt64(&wsm.conflatedSnapshots, 1)
+		}
 	}
+}
 
-	// Broadcast to all clients
+// broadcast queues a message for the clients subscribed to a topic. The message is
+// only encoded if at least one client is listening.
+func (wsm *WebSocketManager) broadcast(t topic, message WebSocketMessage) {
+	wsm.broadcastMatching(t, message, nil)
+}
+
+// broadcastMatching queues a message for the clients subscribed to a topic whose
+// subscription matches, or for all of them if match is nil
+func (wsm *WebSocketManager) broadcastMatching(t topic, message WebSocketMessage, match func(Subscription) bool) {
 	wsm.clientsMutex.Lock()
-	for client := range wsm.clients {
-		err := client.WriteMessage(websocket.TextMessage, messageJSON)
-		if err != nil {
-			wsm.logger.Warn("Error sending to client: " + err.Error())
-			client.Close()
-			delete(wsm.clients, client)
+	defer wsm.clientsMutex.Unlock()
+
+	var messageJSON []byte
+	for _, client := range wsm.clients {
+		subscription, ok := client.subscriptions[t]
+		if !ok || (match != nil && !match(subscription)) {
+			continue
 		}
+		if messageJSON == nil {
+			var err error
+			messageJSON, err = json.Marshal(message)
+			if err != nil {
+				wsm.logger.Error(fmt.Sprintf("Failed to marshal %s message: %s", message.Type, err.Error()))
+				return
+			}
+		}
+		wsm.sendRaw(client, messageJSON)
 	}
-	wsm.clientsMutex.Unlock()
 }
@@ -0,0 +1,166 @@
+package exchange
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// clientSendQueueSize is the number of messages a client may fall behind before it is disconnected
+	clientSendQueueSize = 256
+	// clientWriteWait is the time allowed to write a message before the client is disconnected
+	clientWriteWait = 10 * time.Second
+)
+
+// wsClient is a connected client and the channels it is subscribed to.
+// Messages are queued and written by the client's own writer goroutine so that a
+// slow client never blocks broadcasts to the others.
+type wsClient struct {
+	conn *websocket.Conn
+	// subscriptions is guarded by the manager's clientsMutex
+	subscriptions map[topic]Subscription
+	send          chan []byte
+	// books holds the latest unsent order book of each symbol. A newer snapshot
+	// replaces one that has not been written yet and takes its place in the queue.
+	books      map[string]pendingBook
+	booksMutex sync.Mutex
+	// queued counts the messages put on send and is guarded by booksMutex; written
+	// counts those the writer has written and is only used by the writer
+	queued    uint64
+	written   uint64
+	bookReady chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// pendingBook is an unsent order book snapshot and its place in the queue
+type pendingBook struct {
+	messageJSON []byte
+	// after is the number of queued messages to write before the snapshot
+	after uint64
+}
+
+// newWSClient creates a client for a connection without any subscriptions
+func newWSClient(conn *websocket.Conn) *wsClient {
+	return &wsClient{
+		conn:          conn,
+		subscriptions: make(map[topic]Subscription),
+		send:          make(chan []byte, clientSendQueueSize),
+		books:         make(map[string]pendingBook),
+		bookReady:     make(chan struct{}, 1),
+		done:          make(chan struct{}),
+	}
+}
+
+// enqueue queues a message without blocking. It returns false if the queue is full.
+func (client *wsClient) enqueue(messageJSON []byte) bool {
+	select {
+	case <-client.done:
+		// Messages to a disconnected client are discarded
+		return true
+	default:
+	}
+
+	client.booksMutex.Lock()
+	defer client.booksMutex.Unlock()
+	select {
+	case client.send <- messageJSON:
+		client.queued++
+		return true
+	default:
+		return false
+	}
+}
+
+// enqueueBook queues an order book snapshot behind the messages already queued,
+// replacing any unsent snapshot of the same symbol. It returns true if a snapshot
+// was replaced.
+func (client *wsClient) enqueueBook(symbol string, messageJSON []byte) bool {
+	client.booksMutex.Lock()
+	_, replaced := client.books[symbol]
+	client.books[symbol] = pendingBook{messageJSON: messageJSON, after: client.queued}
+	client.booksMutex.Unlock()
+
+	select {
+	case client.bookReady <- struct{}{}:
+	default:
+	}
+	return replaced
+}
+
+// pending returns the number of queued messages that have not been written
+func (client *wsClient) pending() int {
+	client.booksMutex.Lock()
+	defer client.booksMutex.Unlock()
+	return len(client.send) + len(client.books)
+}
+
+// writePump writes queued messages to the connection until the client is closed or
+// a write fails. Pending order books are written as soon as the messages queued
+// before them have been, so a snapshot is delivered neither ahead of older messages
+// nor behind newer ones.
+func (client *wsClient) writePump(logger *Logger) {
+	defer client.close()
+
+	for {
+		select {
+		case messageJSON := <-client.send:
+			if !client.write(messageJSON, logger) {
+				return
+			}
+			client.written++
+			if !client.writeBooks(logger) {
+				return
+			}
+		case <-client.bookReady:
+			if !client.writeBooks(logger) {
+				return
+			}
+		case <-client.done:
+			return
+		}
+	}
+}
+
+// writeBooks writes the pending order book snapshots whose turn has come, in the
+// order they were queued. The others are written once the messages ahead of them are.
+func (client *wsClient) writeBooks(logger *Logger) bool {
+	client.booksMutex.Lock()
+	due := make([]pendingBook, 0, len(client.books))
+	for symbol, book := range client.books {
+		if book.after <= client.written {
+			due = append(due, book)
+			delete(client.books, symbol)
+		}
+	}
+	client.booksMutex.Unlock()
+
+	sort.Slice(due, func(i, j int) bool { return due[i].after < due[j].after })
+	for _, book := range due {
+		if !client.write(book.messageJSON, logger) {
+			return false
+		}
+	}
+	return true
+}
+
+// write sends one message with a deadline
+func (client *wsClient) write(messageJSON []byte, logger *Logger) bool {
+	client.conn.SetWriteDeadline(time.Now().Add(clientWriteWait))
+	if err := client.conn.WriteMessage(websocket.TextMessage, messageJSON); err != nil {
+		logger.Warn("Error sending to client: " + err.Error())
+		return false
+	}
+	return true
+}
+
+// close stops the writer and closes the connection, which also ends the reader
+func (client *wsClient) close() {
+	client.closeOnce.Do(func() {
+		close(client.done)
+		client.conn.Close()
+	})
+}
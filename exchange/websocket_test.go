@@ -36,12 +36,12 @@ func TestBroadcastPriceUpdate(t *testing.T) {
 	wsm.BroadcastPriceUpdate(testPrice)
 
 	// Check that the price history was updated
-	if len(wsm.priceHistory) != 1 {
-		t.Errorf("Expected 1 entry in price history, got %d", len(wsm.priceHistory))
+	if len(wsm.priceHistory[DefaultSymbol]) != 1 {
+		t.Errorf("Expected 1 entry in price history, got %d", len(wsm.priceHistory[DefaultSymbol]))
 	}
 
-	if len(wsm.priceHistory) > 0 {
-		message := wsm.priceHistory[0]
+	if len(wsm.priceHistory[DefaultSymbol]) > 0 {
+		message := wsm.priceHistory[DefaultSymbol][0]
 		if message.Type != PriceUpdateMessage {
 			t.Errorf("Expected message type %s, got %s", PriceUpdateMessage, message.Type)
 		}
@@ -141,6 +141,21 @@ func TestBroadcastOrderBook(t *testing.T) {
 	// But we can verify that the method doesn't panic
 }
 
+func TestBroadcastTrade(t *testing.T) {
+	wsm := NewWebSocketManager()
+
+	// With no connected clients the broadcast should simply not panic
+	wsm.BroadcastTrade(Trade{
+		ID:          "TRADE-1",
+		BuyOrderID:  "buy1",
+		SellOrderID: "sell1",
+		Price:       100,
+		Quantity:    1,
+		Aggressor:   BuyTransactionType,
+		Timestamp:   time.Now(),
+	})
+}
+
 // This is a more complex test that requires a WebSocket server and client
 // It's included for completeness but may be skipped in some environments
 func TestHandleWebSocket(t *testing.T) {
@@ -151,13 +166,15 @@ func TestHandleWebSocket(t *testing.T) {
 
 	// Create a test exchange
 	exchange := NewExchange(100)
+	registry := NewInstrumentRegistry()
+	registry.Register(&exchange)
 
 	// Create a WebSocket manager
 	wsm := NewWebSocketManager()
 
 	// Create a test HTTP server
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		wsm.HandleWebSocket(w, r, &exchange)
+		wsm.HandleWebSocket(w, r, registry)
 	}))
 	defer server.Close()
 
@@ -205,3 +222,544 @@ func TestHandleWebSocket(t *testing.T) {
 		}
 	}
 }
+
+func TestWebSocketCancelOrder(t *testing.T) {
+	exchange := NewExchange(100)
+	order := NewTransactionWithQuantity(BuyTransactionType, 90, 5)
+	exchange.accept(order, NewLogger("TestWebSocketCancelOrder"))
+	registry := NewInstrumentRegistry()
+	registry.Register(&exchange)
+
+	wsm := NewWebSocketManager()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wsm.HandleWebSocket(w, r, registry)
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/"
+	ws, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Could not connect to WebSocket server: %v", err)
+	}
+	defer ws.Close()
+
+	// readUntil skips market data until a message of the given type arrives
+	readUntil := func(messageType MessageType) map[string]interface{} {
+		ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+		for {
+			_, message, err := ws.ReadMessage()
+			if err != nil {
+				t.Fatalf("Failed to read message: %v", err)
+			}
+			var wsMessage WebSocketMessage
+			if json.Unmarshal(message, &wsMessage) == nil && wsMessage.Type == messageType {
+				data, _ := wsMessage.Data.(map[string]interface{})
+				return data
+			}
+		}
+	}
+
+	ws.WriteJSON(ClientMessage{Type: CancelOrderRequest, OrderID: order.ID})
+	report := readUntil(OrderReportMessage)
+	if report["orderId"] != order.ID || report["status"] != string(OrderStatusCancelled) {
+		t.Errorf("Expected cancelled report for %s, got %v", order.ID, report)
+	}
+
+	ws.WriteJSON(ClientMessage{Type: CancelOrderRequest, OrderID: order.ID})
+	errorData := readUntil(ErrorMessage)
+	if errorData["error"] != ErrOrderNotFound.Error() {
+		t.Errorf("Expected %q error, got %v", ErrOrderNotFound.Error(), errorData)
+	}
+}
+
+func TestWebSocketSymbolSubscriptions(t *testing.T) {
+	registry := NewInstrumentRegistry()
+	registry.Add("AAPL", 150)
+	registry.Add("MSFT", 300)
+
+	wsm := NewWebSocketManager()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wsm.HandleWebSocket(w, r, registry)
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/?symbol=msft"
+	ws, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Could not connect to WebSocket server: %v", err)
+	}
+	defer ws.Close()
+
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	// Only the MSFT update should reach the client
+	wsm.BroadcastSymbolPriceUpdate("AAPL", 151)
+	wsm.BroadcastSymbolPriceUpdate("MSFT", 301)
+
+	var update struct {
+		Type MessageType `json:"type"`
+		Data PriceUpdate `json:"data"`
+	}
+	if err := ws.ReadJSON(&update); err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	if update.Data.Symbol != "MSFT" || update.Data.Price != 301 {
+		t.Errorf("Expected MSFT price update 301, got %s %d", update.Data.Symbol, update.Data.Price)
+	}
+
+	if history := wsm.GetSymbolPriceHistory("AAPL"); len(history) != 1 {
+		t.Errorf("Expected 1 AAPL price update in history, got %d", len(history))
+	}
+}
+
+func TestWebSocketTradingProtocol(t *testing.T) {
+	registry := NewInstrumentRegistry()
+	aapl, _ := registry.Add("AAPL", 150)
+	registry.Add("MSFT", 300)
+
+	wsm := NewWebSocketManager()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wsm.HandleWebSocket(w, r, registry)
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/"
+	ws, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Could not connect to WebSocket server: %v", err)
+	}
+	defer ws.Close()
+
+	// request sends a message and returns the reply carrying its request ID
+	request := func(message ClientMessage) (MessageType, json.RawMessage) {
+		ws.WriteJSON(message)
+		ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+		for {
+			var reply struct {
+				Type      MessageType     `json:"type"`
+				RequestID string          `json:"requestId"`
+				Data      json.RawMessage `json:"data"`
+			}
+			if err := ws.ReadJSON(&reply); err != nil {
+				t.Fatalf("Failed to read reply to %s: %v", message.RequestID, err)
+			}
+			if reply.RequestID == message.RequestID {
+				return reply.Type, reply.Data
+			}
+		}
+	}
+
+	if messageType, _ := request(ClientMessage{Type: PingRequest, RequestID: "1"}); messageType != PongMessage {
+		t.Errorf("Expected %s, got %s", PongMessage, messageType)
+	}
+
+	// Place an order and amend it over the same connection
+	messageType, data := request(ClientMessage{Type: PlaceOrderRequest, RequestID: "2",
+		Side: "buy", Price: 149, Quantity: 5})
+	var report OrderReport
+	json.Unmarshal(data, &report)
+	if messageType != OrderReportMessage || report.Status != OrderStatusNew || report.Symbol != "AAPL" {
+		t.Fatalf("Expected a NEW AAPL order, got %s %+v", messageType, report)
+	}
+
+	messageType, data = request(ClientMessage{Type: AmendOrderRequest, RequestID: "3",
+		OrderID: report.OrderID, Price: 148, Quantity: 3})
+	json.Unmarshal(data, &report)
+	if messageType != OrderReportMessage || report.Price != 148 || report.Quantity != 3 {
+		t.Errorf("Expected the order amended to 3 at 148, got %s %+v", messageType, report)
+	}
+	if resting, ok := aapl.GetOrder(report.OrderID); !ok || resting.Amount != 148 {
+		t.Errorf("Expected the order to rest at 148, got %+v", resting)
+	}
+
+	// Rejections are reported with their reason
+	messageType, data = request(ClientMessage{Type: PlaceOrderRequest, RequestID: "4",
+		Side: "HOLD", Price: 149, Quantity: 5})
+	json.Unmarshal(data, &report)
+	if messageType != OrderReportMessage || report.RejectReason != RejectInvalidSide {
+		t.Errorf("Expected an invalid side rejection, got %s %+v", messageType, report)
+	}
+
+	// Values that do not fit in an order are refused rather than wrapped
+	if messageType, _ := request(ClientMessage{Type: PlaceOrderRequest, RequestID: "4a",
+		Side: "buy", Price: 4294967397, Quantity: 5}); messageType != ErrorMessage {
+		t.Errorf("Expected an error for an oversized price, got %s", messageType)
+	}
+	if messageType, _ := request(ClientMessage{Type: AmendOrderRequest, RequestID: "4b",
+		OrderID: report.OrderID, Price: 148, Quantity: 4294967298}); messageType != ErrorMessage {
+		t.Errorf("Expected an error for an oversized quantity, got %s", messageType)
+	}
+	if depth := aapl.GetDepth(0); len(depth.Bids) != 1 || depth.Bids[0].Price != 148 || depth.Bids[0].Quantity != 3 {
+		t.Errorf("Expected only the amended order at 148 in the book, got %+v", depth.Bids)
+	}
+
+	// Subscribe to MSFT and unsubscribe from AAPL
+	var subscriptions SubscriptionsResponse
+	messageType, data = request(ClientMessage{Type: SubscribeRequest, RequestID: "5", Symbols: []string{"msft"}})
+	json.Unmarshal(data, &subscriptions)
+	if messageType != SubscriptionsMessage || len(subscriptions.Subscriptions) != 2*len(defaultChannels) {
+		t.Errorf("Expected the default channels of AAPL and MSFT, got %s %+v", messageType, subscriptions)
+	}
+
+	messageType, data = request(ClientMessage{Type: UnsubscribeRequest, RequestID: "6", Symbol: "AAPL"})
+	json.Unmarshal(data, &subscriptions)
+	if messageType != SubscriptionsMessage || len(subscriptions.Subscriptions) != len(defaultChannels) ||
+		subscriptions.Subscriptions[0].Symbol != "MSFT" {
+		t.Errorf("Expected the default channels of MSFT only, got %s %+v", messageType, subscriptions)
+	}
+
+	if messageType, _ := request(ClientMessage{Type: SubscribeRequest, RequestID: "7", Symbols: []string{"GOOG"}}); messageType != ErrorMessage {
+		t.Errorf("Expected an error for an unknown symbol, got %s", messageType)
+	}
+	if messageType, _ := request(ClientMessage{Type: "dance", RequestID: "8"}); messageType != ErrorMessage {
+		t.Errorf("Expected an error for an unknown message type, got %s", messageType)
+	}
+}
+
+// dialTestClient connects to a server that accepts WebSocket connections but never reads from them
+func dialTestClient(t *testing.T) (*websocket.Conn, func()) {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrader.Upgrade(w, r, nil)
+	}))
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/", nil)
+	if err != nil {
+		server.Close()
+		t.Fatalf("Could not connect to WebSocket server: %v", err)
+	}
+	return ws, func() {
+		ws.Close()
+		server.Close()
+	}
+}
+
+func TestSlowClientDisconnected(t *testing.T) {
+	ws, cleanup := dialTestClient(t)
+	defer cleanup()
+
+	// Without a writer goroutine the client's queue is never drained
+	wsm := NewWebSocketManager()
+	client := newWSClient(ws)
+	client.subscriptions[topic{channel: PriceChannel, key: DefaultSymbol}] = Subscription{Channel: PriceChannel, Symbol: DefaultSymbol}
+	wsm.clients[ws] = client
+
+	for i := 0; i < clientSendQueueSize; i++ {
+		wsm.BroadcastPriceUpdate(100 + i)
+	}
+	if stats := wsm.Stats(); stats["DroppedMessages"] != 0 || stats["SlowClientDisconnects"] != 0 {
+		t.Fatalf("Expected a full queue without drops, got %v", stats)
+	}
+
+	// One message too many disconnects the client and drops everything it had queued
+	wsm.BroadcastPriceUpdate(99)
+	stats := wsm.Stats()
+	if stats["DroppedMessages"] != clientSendQueueSize+1 || stats["SlowClientDisconnects"] != 1 {
+		t.Errorf("Expected %d dropped messages and 1 disconnect, got %v", clientSendQueueSize+1, stats)
+	}
+	select {
+	case <-client.done:
+	default:
+		t.Errorf("Expected the slow client to be closed")
+	}
+
+	// Later messages to the closed client are discarded without being counted again
+	wsm.BroadcastPriceUpdate(98)
+	if wsm.Stats()["DroppedMessages"] != clientSendQueueSize+1 {
+		t.Errorf("Expected no more drops after the disconnect, got %v", wsm.Stats())
+	}
+}
+
+func TestOrderBookConflation(t *testing.T) {
+	ws, cleanup := dialTestClient(t)
+	defer cleanup()
+
+	wsm := NewWebSocketManager()
+	client := newWSClient(ws)
+	for _, symbol := range []string{"AAPL", "MSFT"} {
+		subscription := Subscription{Channel: BookChannel, Symbol: symbol}
+		client.subscriptions[subscription.topic()] = subscription
+	}
+	wsm.clients[ws] = client
+
+	wsm.BroadcastOrderBook(OrderBook{Symbol: "AAPL", BuyOrders: []OrderBookEntry{{ID: "old"}}})
+	wsm.BroadcastOrderBook(OrderBook{Symbol: "MSFT"})
+	wsm.BroadcastOrderBook(OrderBook{Symbol: "AAPL", BuyOrders: []OrderBookEntry{{ID: "new"}}})
+
+	if conflated := wsm.Stats()["ConflatedSnapshots"]; conflated != 1 {
+		t.Errorf("Expected 1 conflated snapshot, got %d", conflated)
+	}
+	if pending := client.pending(); pending != 2 {
+		t.Errorf("Expected one pending snapshot per symbol, got %d", pending)
+	}
+
+	var latest WebSocketMessage
+	json.Unmarshal(client.books["AAPL"].messageJSON, &latest)
+	book, _ := latest.Data.(map[string]interface{})
+	orders, _ := book["buyOrders"].([]interface{})
+	if len(orders) != 1 || orders[0].(map[string]interface{})["id"] != "new" {
+		t.Errorf("Expected the latest AAPL snapshot to be pending, got %v", book)
+	}
+}
+
+func TestOrderBookQueuedInOrder(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	conns := make(chan *websocket.Conn, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _ := upgrader.Upgrade(w, r, nil)
+		conns <- conn
+	}))
+	defer server.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/", nil)
+	if err != nil {
+		t.Fatalf("Could not connect to WebSocket server: %v", err)
+	}
+	defer ws.Close()
+	client := newWSClient(<-conns)
+	defer client.close()
+
+	// A replaced snapshot is sent where the newer one was queued, not where the
+	// first one was, so it never overtakes the messages queued before it
+	client.enqueue([]byte(`"trade 1"`))
+	client.enqueueBook("AAPL", []byte(`"book 1"`))
+	client.enqueue([]byte(`"trade 2"`))
+	client.enqueueBook("AAPL", []byte(`"book 2"`))
+	client.enqueue([]byte(`"trade 3"`))
+	go client.writePump(NewLogger("TestOrderBookQueuedInOrder"))
+
+	expected := []string{"trade 1", "trade 2", "book 2", "trade 3"}
+	for _, want := range expected {
+		var got string
+		ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if err := ws.ReadJSON(&got); err != nil {
+			t.Fatalf("Failed to read message: %v", err)
+		}
+		if got != want {
+			t.Fatalf("Expected %q, got %q", want, got)
+		}
+	}
+}
+
+func TestWebSocketChannelSubscriptions(t *testing.T) {
+	registry := NewInstrumentRegistry()
+	aapl, _ := registry.Add("AAPL", 150)
+	registry.Accounts().Open("alice", 1000)
+	for _, price := range []TransactionAmtDataType{149, 148, 147} {
+		aapl.accept(NewTransaction(BuyTransactionType, price), NewLogger("TestWebSocketChannelSubscriptions"))
+	}
+
+	wsm := NewWebSocketManager()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wsm.HandleWebSocket(w, r, registry)
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/?channel=trades,orders&account=alice&symbol=AAPL"
+	ws, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Could not connect to WebSocket server: %v", err)
+	}
+	defer ws.Close()
+
+	// read returns the type and data of the next message
+	read := func() (MessageType, json.RawMessage) {
+		ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+		var message struct {
+			Type MessageType     `json:"type"`
+			Data json.RawMessage `json:"data"`
+		}
+		if err := ws.ReadJSON(&message); err != nil {
+			t.Fatalf("Failed to read message: %v", err)
+		}
+		return message.Type, message.Data
+	}
+
+	// Wait for the connection to be registered
+	deadline := time.Now().Add(time.Second)
+	for !wsm.HasSubscribers(TradesChannel, "AAPL") {
+		if time.Now().After(deadline) {
+			t.Fatalf("Client was not subscribed within timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if wsm.HasSubscribers(PriceChannel, "AAPL") || wsm.HasSubscribers(BookChannel, "AAPL") {
+		t.Errorf("Expected no price or book subscribers")
+	}
+
+	// Unsubscribed channels and other accounts are filtered out
+	wsm.BroadcastSymbolPriceUpdate("AAPL", 151)
+	wsm.BroadcastOrderBook(aapl.GetOrderBook())
+	wsm.BroadcastOrderReport(OrderReport{OrderID: "BUY-BOB", AccountID: "bob"})
+	wsm.BroadcastOrderReport(OrderReport{OrderID: "BUY-ALICE", AccountID: "alice"})
+	wsm.BroadcastTrade(Trade{ID: "TRADE-1", Symbol: "AAPL"})
+
+	if messageType, data := read(); messageType != OrderReportMessage || !strings.Contains(string(data), "BUY-ALICE") {
+		t.Errorf("Expected alice's order report, got %s %s", messageType, data)
+	}
+	if messageType, _ := read(); messageType != TradeMessage {
+		t.Errorf("Expected a trade, got %s", messageType)
+	}
+
+	// Subscribing to the book sends a snapshot at the requested depth
+	ws.WriteJSON(ClientMessage{Type: SubscribeRequest, Channels: []Channel{BookChannel}, Symbols: []string{"AAPL"}, Depth: 2})
+	if messageType, _ := read(); messageType != SubscriptionsMessage {
+		t.Errorf("Expected the subscriptions, got %s", messageType)
+	}
+	messageType, data := read()
+	var orderBook OrderBook
+	json.Unmarshal(data, &orderBook)
+	if messageType != OrderBookMessage || len(orderBook.BuyOrders) != 2 || orderBook.BuyOrders[0].Price != 149 {
+		t.Errorf("Expected the best 2 bids, got %s %+v", messageType, orderBook)
+	}
+}
+
+func TestWebSocketLevels(t *testing.T) {
+	registry := NewInstrumentRegistry()
+	aapl, _ := registry.Add("AAPL", 150)
+	aapl.Submit(NewTransactionWithQuantity(BuyTransactionType, 149, 10))
+
+	wsm := NewWebSocketManager()
+	aapl.RegisterBookUpdateCallback(wsm.BroadcastBookUpdate)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wsm.HandleWebSocket(w, r, registry)
+	}))
+	defer server.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/?channel=price&symbol=AAPL", nil)
+	if err != nil {
+		t.Fatalf("Could not connect to WebSocket server: %v", err)
+	}
+	defer ws.Close()
+
+	// read returns the type, request ID and data of the next message
+	read := func() (MessageType, string, json.RawMessage) {
+		ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+		var message struct {
+			Type      MessageType     `json:"type"`
+			RequestID string          `json:"requestId"`
+			Data      json.RawMessage `json:"data"`
+		}
+		if err := ws.ReadJSON(&message); err != nil {
+			t.Fatalf("Failed to read message: %v", err)
+		}
+		return message.Type, message.RequestID, message.Data
+	}
+
+	// Resyncing a book without subscribing to its levels is an error
+	ws.WriteJSON(ClientMessage{Type: ResyncRequest, RequestID: "1", Symbol: "AAPL"})
+	if messageType, requestID, _ := read(); messageType != ErrorMessage || requestID != "1" {
+		t.Errorf("Expected an error for request 1, got %s for %q", messageType, requestID)
+	}
+
+	ws.WriteJSON(ClientMessage{Type: SubscribeRequest, Channels: []Channel{LevelsChannel}, Symbol: "AAPL"})
+	if messageType, _, _ := read(); messageType != SubscriptionsMessage {
+		t.Errorf("Expected the subscriptions, got %s", messageType)
+	}
+	messageType, _, data := read()
+	var snapshot BookSnapshot
+	json.Unmarshal(data, &snapshot)
+	if messageType != BookSnapshotMessage || snapshot.Sequence != 1 || len(snapshot.Bids) != 1 || snapshot.Bids[0].Quantity != 10 {
+		t.Fatalf("Expected a snapshot at sequence 1 with one bid level, got %s %+v", messageType, snapshot)
+	}
+
+	// Every change to the book follows with the next sequence number
+	aapl.Submit(NewTransactionWithQuantity(BuyTransactionType, 149, 5))
+	aapl.Submit(NewTransactionWithQuantity(SellTransactionType, 151, 3))
+	for _, expected := range []LevelChange{
+		{Side: BuyTransactionType, Action: LevelChanged, PriceLevel: PriceLevel{Price: 149, Quantity: 15, Orders: 2}},
+		{Side: SellTransactionType, Action: LevelAdded, PriceLevel: PriceLevel{Price: 151, Quantity: 3, Orders: 1}},
+	} {
+		snapshot.Sequence++
+		messageType, _, data := read()
+		var update BookUpdate
+		json.Unmarshal(data, &update)
+		if messageType != BookUpdateMessage || update.Sequence != snapshot.Sequence {
+			t.Fatalf("Expected update %d, got %s %+v", snapshot.Sequence, messageType, update)
+		}
+		if len(update.Changes) != 1 || update.Changes[0] != expected {
+			t.Errorf("Expected change %+v, got %+v", expected, update.Changes)
+		}
+	}
+
+	// A resync replies with the current levels
+	ws.WriteJSON(ClientMessage{Type: ResyncRequest, RequestID: "2", Symbol: "AAPL"})
+	messageType, requestID, data := read()
+	json.Unmarshal(data, &snapshot)
+	if messageType != BookSnapshotMessage || requestID != "2" || snapshot.Sequence != 3 || len(snapshot.Asks) != 1 {
+		t.Errorf("Expected a snapshot at sequence 3 for request 2, got %s %q %+v", messageType, requestID, snapshot)
+	}
+}
+
+func TestWebSocketLevelsOnConnect(t *testing.T) {
+	registry := NewInstrumentRegistry()
+	aapl, _ := registry.Add("AAPL", 150)
+	aapl.Submit(NewTransactionWithQuantity(SellTransactionType, 151, 4))
+
+	wsm := NewWebSocketManager()
+	aapl.RegisterBookUpdateCallback(wsm.BroadcastBookUpdate)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wsm.HandleWebSocket(w, r, registry)
+	}))
+	defer server.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/?channel=levels&symbol=AAPL", nil)
+	if err != nil {
+		t.Fatalf("Could not connect to WebSocket server: %v", err)
+	}
+	defer ws.Close()
+
+	// The levels subscribed on the URL start from a snapshot like subscribed ones do
+	var message struct {
+		Type MessageType  `json:"type"`
+		Data BookSnapshot `json:"data"`
+	}
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := ws.ReadJSON(&message); err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	if message.Type != BookSnapshotMessage || message.Data.Sequence != 1 || len(message.Data.Asks) != 1 || message.Data.Asks[0].Quantity != 4 {
+		t.Errorf("Expected a snapshot at sequence 1 with one ask level, got %s %+v", message.Type, message.Data)
+	}
+}
+
+func TestBroadcastCandle(t *testing.T) {
+	registry := NewInstrumentRegistry()
+	registry.Add("AAPL", 150)
+
+	wsm := NewWebSocketManager()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wsm.HandleWebSocket(w, r, registry)
+	}))
+	defer server.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/?channel=candles&symbol=AAPL&interval=1m", nil)
+	if err != nil {
+		t.Fatalf("Could not connect to WebSocket server: %v", err)
+	}
+	defer ws.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for !wsm.HasSubscribers(CandlesChannel, "AAPL") {
+		if time.Now().After(deadline) {
+			t.Fatalf("Client was not subscribed within timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Only the subscribed interval is sent
+	wsm.BroadcastCandle(Candle{Symbol: "AAPL", Interval: Interval1s, Close: 1})
+	wsm.BroadcastCandle(Candle{Symbol: "AAPL", Interval: Interval1m, Close: 2})
+
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var message struct {
+		Type MessageType `json:"type"`
+		Data Candle      `json:"data"`
+	}
+	if err := ws.ReadJSON(&message); err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	if message.Type != CandleMessage || message.Data.Interval != Interval1m || message.Data.Close != 2 {
+		t.Errorf("Expected the 1m candle, got %s %+v", message.Type, message.Data)
+	}
+}
@@ -0,0 +1,184 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrUnknownModel is returned when a spec names a model that does not exist
+var ErrUnknownModel = errors.New("unknown generator model")
+
+// ErrInvalidParameter is returned when a spec sets a parameter the model does not
+// accept or gives it a value out of range
+var ErrInvalidParameter = errors.New("invalid generator parameter")
+
+// Params holds the numeric parameters of a model by name
+type Params map[string]float64
+
+// Spec selects a model and overrides some of its parameters
+type Spec struct {
+	Model  string
+	Params Params
+}
+
+// String formats the spec the way ParseSpec reads it, with parameters in name order
+func (spec Spec) String() string {
+	names := make([]string, 0, len(spec.Params))
+	for name := range spec.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := make([]string, len(names))
+	for i, name := range names {
+		values[i] = name + "=" + strconv.FormatFloat(spec.Params[name], 'g', -1, 64)
+	}
+	if len(values) == 0 {
+		return spec.Model
+	}
+	return spec.Model + ":" + strings.Join(values, ",")
+}
+
+// ParseSpec reads a spec given as model or model:name=value,name=value
+func ParseSpec(value string) (Spec, error) {
+	name, list, _ := strings.Cut(strings.TrimSpace(value), ":")
+	spec := Spec{Model: strings.ToLower(name), Params: Params{}}
+	if list == "" {
+		return spec, nil
+	}
+
+	for _, param := range strings.Split(list, ",") {
+		key, number, found := strings.Cut(strings.TrimSpace(param), "=")
+		if !found {
+			return Spec{}, fmt.Errorf("%w: %q must be given as name=value", ErrInvalidParameter, param)
+		}
+		parsed, err := strconv.ParseFloat(number, 64)
+		if err != nil {
+			return Spec{}, fmt.Errorf("%w: %s has an invalid value %q", ErrInvalidParameter, key, number)
+		}
+		spec.Params[key] = parsed
+	}
+	return spec, nil
+}
+
+// model is a built-in generator with the parameters it accepts and their defaults
+type model struct {
+	defaults Params
+	// minimums and maximums hold the smallest and largest value of each parameter
+	// that has one
+	minimums Params
+	maximums Params
+	build    func(params Params, rng *rand.Rand) Generator
+}
+
+// models holds the built-in generators by name
+var models = map[string]model{
+	"uniform": {
+		defaults: Params{"orders": 5, "size": 1},
+		minimums: Params{"orders": 0, "size": 1},
+		build:    newUniform,
+	},
+	"randomwalk": {
+		defaults: Params{"step": 1, "spread": 5, "orders": 10, "size": 1},
+		minimums: Params{"step": 0, "spread": 0, "orders": 0, "size": 1},
+		build:    newRandomWalk,
+	},
+	"meanrevert": {
+		defaults: Params{"mean": 0, "theta": 0.1, "sigma": 1, "spread": 5, "orders": 10, "size": 1},
+		minimums: Params{"mean": 0, "theta": 0, "sigma": 0, "spread": 0, "orders": 0, "size": 1},
+		build:    newMeanReverting,
+	},
+	"gbm": {
+		defaults: Params{"mu": 0, "sigma": 0.01, "spread": 5, "orders": 10, "size": 1},
+		minimums: Params{"sigma": 0, "spread": 0, "orders": 0, "size": 1},
+		build:    newGeometricBrownian,
+	},
+	"poisson": {
+		defaults: Params{"buyRate": 5, "sellRate": 5, "spread": 10, "market": 0, "size": 1},
+		minimums: Params{"buyRate": 0, "sellRate": 0, "spread": 0, "market": 0, "size": 1},
+		maximums: Params{"market": 1},
+		build:    newPoisson,
+	},
+	"momentum": {
+		defaults: Params{"lookback": 5, "threshold": 1, "orders": 2, "aggression": 2, "size": 1},
+		minimums: Params{"lookback": 1, "threshold": 0, "orders": 0, "aggression": 0, "size": 1},
+		build:    newMomentum,
+	},
+	"marketmaker": {
+		defaults: Params{"spread": 2, "levels": 3, "step": 1, "size": 5},
+		minimums: Params{"spread": 1, "levels": 1, "step": 1, "size": 1},
+		build:    newMarketMaker,
+	},
+}
+
+// DefaultSpec is the generator used when none is configured
+var DefaultSpec = Spec{Model: "uniform", Params: Params{}}
+
+// Models returns the names of the built-in models in alphabetical order
+func Models() []string {
+	names := make([]string, 0, len(models))
+	for name := range models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Defaults returns the parameters a model accepts with their default values
+func Defaults(name string) (Params, bool) {
+	m, ok := models[name]
+	if !ok {
+		return nil, false
+	}
+	params := make(Params, len(m.defaults))
+	for key, value := range m.defaults {
+		params[key] = value
+	}
+	return params, true
+}
+
+// Validate reports whether the spec names a built-in model and sets only parameters
+// it accepts to values in range
+func (spec Spec) Validate() error {
+	_, err := spec.resolve()
+	return err
+}
+
+// resolve returns the parameters of the spec's model with the spec's values in place
+// of the defaults
+func (spec Spec) resolve() (Params, error) {
+	m, ok := models[spec.Model]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q (choose from %s)", ErrUnknownModel, spec.Model, strings.Join(Models(), ", "))
+	}
+
+	params, _ := Defaults(spec.Model)
+	for key, value := range spec.Params {
+		if _, ok := m.defaults[key]; !ok {
+			return nil, fmt.Errorf("%w: %s does not accept %s", ErrInvalidParameter, spec.Model, key)
+		}
+		if minimum, ok := m.minimums[key]; ok && value < minimum {
+			return nil, fmt.Errorf("%w: %s of %s must be at least %g", ErrInvalidParameter, key, spec.Model, minimum)
+		}
+		if maximum, ok := m.maximums[key]; ok && value > maximum {
+			return nil, fmt.Errorf("%w: %s of %s must be at most %g", ErrInvalidParameter, key, spec.Model, maximum)
+		}
+		params[key] = value
+	}
+	return params, nil
+}
+
+// New creates the generator a spec selects. Parameters the spec does not set keep
+// their defaults and counts are rounded down. The generator draws every random
+// number from rng.
+func New(spec Spec, rng *rand.Rand) (Generator, error) {
+	params, err := spec.resolve()
+	if err != nil {
+		return nil, err
+	}
+	return models[spec.Model].build(params, rng), nil
+}
@@ -0,0 +1,85 @@
+package generator
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestParseSpec(t *testing.T) {
+	testCases := []struct {
+		name          string
+		value         string
+		expected      Spec
+		expectedError error
+	}{
+		{
+			name:     "Model Only",
+			value:    "uniform",
+			expected: Spec{Model: "uniform", Params: Params{}},
+		},
+		{
+			name:     "Parameters",
+			value:    " GBM:mu=0.001, sigma=0.02",
+			expected: Spec{Model: "gbm", Params: Params{"mu": 0.001, "sigma": 0.02}},
+		},
+		{
+			name:          "Missing Value",
+			value:         "randomwalk:step",
+			expectedError: ErrInvalidParameter,
+		},
+		{
+			name:          "Invalid Value",
+			value:         "randomwalk:step=far",
+			expectedError: ErrInvalidParameter,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			spec, err := ParseSpec(tc.value)
+			if !errors.Is(err, tc.expectedError) {
+				t.Fatalf("Expected error %v, got %v", tc.expectedError, err)
+			}
+			if err != nil {
+				return
+			}
+			if spec.String() != tc.expected.String() {
+				t.Errorf("Expected spec %s, got %s", tc.expected, spec)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	testCases := []struct {
+		name          string
+		spec          Spec
+		expectedError error
+	}{
+		{"Default", DefaultSpec, nil},
+		{"Parameters", Spec{Model: "poisson", Params: Params{"buyRate": 2, "market": 0.5}}, nil},
+		{"Unknown Model", Spec{Model: "oracle"}, ErrUnknownModel},
+		{"Unknown Parameter", Spec{Model: "uniform", Params: Params{"step": 1}}, ErrInvalidParameter},
+		{"Below Minimum", Spec{Model: "marketmaker", Params: Params{"size": 0}}, ErrInvalidParameter},
+		{"Above Maximum", Spec{Model: "poisson", Params: Params{"market": 1.5}}, ErrInvalidParameter},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			gen, err := New(tc.spec, rand.New(rand.NewSource(1)))
+			if !errors.Is(err, tc.expectedError) {
+				t.Fatalf("Expected error %v, got %v", tc.expectedError, err)
+			}
+			if err == nil && gen == nil {
+				t.Errorf("Expected a generator, got nil")
+			}
+		})
+	}
+
+	for _, name := range Models() {
+		if _, err := New(Spec{Model: name}, rand.New(rand.NewSource(1))); err != nil {
+			t.Errorf("Expected %s to build with its defaults, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package generator
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rohan/stock-simulator/exchange"
+)
+
+// Market is what a generator sees of an instrument when it generates orders
+type Market struct {
+	Symbol          string
+	Time            time.Time
+	LastTradedPrice exchange.TransactionAmtDataType
+}
+
+// Flow is the order flow a generator produces at one tick
+type Flow struct {
+	Orders []exchange.Transaction
+	// Cancels holds the IDs of earlier orders to cancel before the new ones are sent
+	Cancels []string
+}
+
+// Generator models a population of market participants. Generate is called once
+// per tick with the state of the market and returns the orders they send.
+// A generator is used by a single goroutine and keeps whatever state it needs
+// between ticks.
+type Generator interface {
+	Generate(market Market) Flow
+}
+
+// Run sends the flow of gen to the exchange every interval of the clock until stop
+// is closed; a nil stop runs it forever. Orders are sent to IncomingTrades, so
+// AcceptTrades must be running.
+func Run(exch *exchange.Exchange, gen Generator, clock exchange.Clock, interval time.Duration, stop <-chan struct{}) {
+	logger := exchange.NewLogger("Generator")
+	logger.SetClock(clock)
+	ticker := clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C():
+			flow := gen.Generate(Market{
+				Symbol:          exch.Symbol,
+				Time:            now,
+				LastTradedPrice: exch.LTP(),
+			})
+			for _, id := range flow.Cancels {
+				// Quotes that have traded in the meantime are no longer in the book
+				exch.CancelOrder(id)
+			}
+			for _, txn := range flow.Orders {
+				select {
+				case exch.IncomingTrades <- txn:
+				case <-stop:
+					return
+				}
+			}
+			logger.Debug(fmt.Sprintf("[%s] Generated %d orders and %d cancels", exch.Symbol, len(flow.Orders), len(flow.Cancels)))
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package generator
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/rohan/stock-simulator/exchange"
+)
+
+func TestRun(t *testing.T) {
+	exch := exchange.NewExchange(100)
+	clock := exchange.NewSimulatedClock(time.Date(2025, 4, 27, 15, 0, 0, 0, time.UTC))
+	exch.SetClock(clock)
+
+	// Cancelled quotes are reported too, so only new quotes are collected
+	reports := make(chan exchange.OrderReport, 10)
+	exch.RegisterOrderReportCallback(func(report exchange.OrderReport) {
+		if report.Status == exchange.OrderStatusNew {
+			reports <- report
+		}
+	})
+	go exch.AcceptTrades()
+
+	gen, _ := New(Spec{Model: "marketmaker", Params: Params{"levels": 1}}, rand.New(rand.NewSource(1)))
+	stop := make(chan struct{})
+	defer close(stop)
+	go Run(&exch, gen, clock, time.Second, stop)
+	clock.WaitForTickers(1)
+
+	// tick advances the clock a second and returns the reports of the orders sent
+	tick := func() []exchange.OrderReport {
+		clock.Advance(time.Second)
+		received := make([]exchange.OrderReport, 0, 2)
+		for len(received) < 2 {
+			select {
+			case report := <-reports:
+				received = append(received, report)
+			case <-time.After(time.Second):
+				t.Fatalf("Expected 2 quotes, got %d", len(received))
+			}
+		}
+		return received
+	}
+
+	first := tick()
+	second := tick()
+
+	// Only the quotes of the latest tick rest in the book
+	for _, report := range first {
+		if _, ok := exch.GetOrder(report.OrderID); ok {
+			t.Errorf("Expected quote %s of the first tick to be cancelled", report.OrderID)
+		}
+	}
+	for _, report := range second {
+		if _, ok := exch.GetOrder(report.OrderID); !ok {
+			t.Errorf("Expected quote %s of the second tick to rest", report.OrderID)
+		}
+	}
+}
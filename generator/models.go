@@ -0,0 +1,304 @@
+package generator
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/rohan/stock-simulator/exchange"
+)
+
+// uniform sends a fixed number of buys and sells every tick, buys priced up to
+// 100 below the last traded price and sells from 25 below to 100 above it
+type uniform struct {
+	rng    *rand.Rand
+	orders int
+	size   int
+}
+
+func newUniform(params Params, rng *rand.Rand) Generator {
+	return &uniform{rng: rng, orders: int(params["orders"]), size: int(params["size"])}
+}
+
+func (gen *uniform) Generate(market Market) Flow {
+	price := int(market.LastTradedPrice)
+	orders := make([]exchange.Transaction, 0, 2*gen.orders)
+	for i := 0; i < gen.orders; i++ {
+		orders = append(orders,
+			newOrder(gen.rng, exchange.BuyTransactionType, uniformBuyPrice(gen.rng, price), quantity(gen.rng, gen.size)),
+			newOrder(gen.rng, exchange.SellTransactionType, uniformSellPrice(gen.rng, price), quantity(gen.rng, gen.size)))
+	}
+	return Flow{Orders: orders}
+}
+
+// uniformBuyPrice generates a random price for a buy order
+// Ensures the price is at least 1 (minimum valid price)
+func uniformBuyPrice(rng *rand.Rand, target int) int {
+	// Set minimum price to max(1, target-100)
+	min := max(1, target-100)
+
+	// Set maximum price to max(target, min+1)
+	maxPrice := max(target, min+1)
+
+	return rng.Intn(maxPrice-min+1) + min
+}
+
+// uniformSellPrice generates a random price for a sell order
+// Ensures the price is at least 1 (minimum valid price)
+func uniformSellPrice(rng *rand.Rand, target int) int {
+	// Set minimum price to max(1, target-25)
+	min := max(1, target-25)
+
+	// Set maximum price to max(target+100, min+1)
+	maxPrice := max(target+100, min+1)
+
+	return rng.Intn(maxPrice-min+1) + min
+}
+
+// referenceTraders are noise traders who believe in a reference price that follows
+// a random process. Every tick the reference moves one step and they send orders
+// of a random side priced within spread of it, so trades happen around it.
+type referenceTraders struct {
+	rng    *rand.Rand
+	spread float64
+	orders int
+	size   int
+	// reference is zero until the first tick starts it at the last traded price
+	reference float64
+	// step moves the reference one tick forward
+	step func(reference float64) float64
+}
+
+func (gen *referenceTraders) Generate(market Market) Flow {
+	if gen.reference == 0 {
+		gen.reference = float64(market.LastTradedPrice)
+	}
+	gen.reference = math.Max(1, gen.step(gen.reference))
+	return Flow{Orders: scatter(gen.rng, gen.reference, gen.spread, gen.orders, gen.size)}
+}
+
+// newRandomWalk moves the reference by a normally distributed step each tick
+func newRandomWalk(params Params, rng *rand.Rand) Generator {
+	step := params["step"]
+	gen := newReferenceTraders(params, rng)
+	gen.step = func(reference float64) float64 {
+		return reference + step*rng.NormFloat64()
+	}
+	return gen
+}
+
+// newMeanReverting moves the reference as an Ornstein-Uhlenbeck process, pulled
+// towards mean by theta of the distance each tick. A mean of zero reverts to the
+// last traded price of the first tick.
+func newMeanReverting(params Params, rng *rand.Rand) Generator {
+	mean, theta, sigma := params["mean"], params["theta"], params["sigma"]
+	gen := newReferenceTraders(params, rng)
+	gen.step = func(reference float64) float64 {
+		if mean == 0 {
+			mean = reference
+		}
+		return reference + theta*(mean-reference) + sigma*rng.NormFloat64()
+	}
+	return gen
+}
+
+// newGeometricBrownian moves the reference as a geometric Brownian motion with
+// drift mu and volatility sigma per tick, so its changes are proportional to it
+func newGeometricBrownian(params Params, rng *rand.Rand) Generator {
+	mu, sigma := params["mu"], params["sigma"]
+	gen := newReferenceTraders(params, rng)
+	gen.step = func(reference float64) float64 {
+		return reference * math.Exp(mu-sigma*sigma/2+sigma*rng.NormFloat64())
+	}
+	return gen
+}
+
+func newReferenceTraders(params Params, rng *rand.Rand) *referenceTraders {
+	return &referenceTraders{
+		rng:    rng,
+		spread: params["spread"],
+		orders: int(params["orders"]),
+		size:   int(params["size"]),
+	}
+}
+
+// poisson sends buys and sells that arrive at independent Poisson rates per tick,
+// priced within spread of the last traded price. A market fraction of them are
+// market orders.
+type poisson struct {
+	rng      *rand.Rand
+	buyRate  float64
+	sellRate float64
+	spread   float64
+	market   float64
+	size     int
+}
+
+func newPoisson(params Params, rng *rand.Rand) Generator {
+	return &poisson{
+		rng:      rng,
+		buyRate:  params["buyRate"],
+		sellRate: params["sellRate"],
+		spread:   params["spread"],
+		market:   params["market"],
+		size:     int(params["size"]),
+	}
+}
+
+func (gen *poisson) Generate(market Market) Flow {
+	orders := make([]exchange.Transaction, 0)
+	for _, side := range []struct {
+		txnType string
+		rate    float64
+	}{
+		{exchange.BuyTransactionType, gen.buyRate},
+		{exchange.SellTransactionType, gen.sellRate},
+	} {
+		for i := arrivals(gen.rng, side.rate); i > 0; i-- {
+			order := newOrder(gen.rng, side.txnType, price(gen.rng, float64(market.LastTradedPrice), gen.spread), quantity(gen.rng, gen.size))
+			if gen.rng.Float64() < gen.market {
+				order.OrderType = exchange.MarketOrderType
+				order.Amount = 0
+			}
+			orders = append(orders, order)
+		}
+	}
+	return Flow{Orders: orders}
+}
+
+// arrivals draws the number of arrivals of a Poisson process with the given rate
+func arrivals(rng *rand.Rand, rate float64) int {
+	limit := math.Exp(-rate)
+	n := 0
+	for p := rng.Float64(); p > limit; p *= rng.Float64() {
+		n++
+	}
+	return n
+}
+
+// momentum traders follow the trend: when the last traded price has moved by at
+// least threshold over lookback ticks they send immediate-or-cancel orders in the
+// same direction, priced aggression beyond the last traded price
+type momentum struct {
+	rng        *rand.Rand
+	lookback   int
+	threshold  float64
+	orders     int
+	aggression int
+	size       int
+	history    []exchange.TransactionAmtDataType
+}
+
+func newMomentum(params Params, rng *rand.Rand) Generator {
+	return &momentum{
+		rng:        rng,
+		lookback:   int(params["lookback"]),
+		threshold:  params["threshold"],
+		orders:     int(params["orders"]),
+		aggression: int(params["aggression"]),
+		size:       int(params["size"]),
+	}
+}
+
+func (gen *momentum) Generate(market Market) Flow {
+	gen.history = append(gen.history, market.LastTradedPrice)
+	if len(gen.history) > gen.lookback+1 {
+		gen.history = gen.history[1:]
+	}
+	if len(gen.history) <= gen.lookback {
+		return Flow{}
+	}
+
+	limit := int(market.LastTradedPrice)
+	change := float64(market.LastTradedPrice - gen.history[0])
+	var txnType string
+	switch {
+	case change > 0 && change >= gen.threshold:
+		txnType, limit = exchange.BuyTransactionType, limit+gen.aggression
+	case change < 0 && -change >= gen.threshold:
+		txnType, limit = exchange.SellTransactionType, max(1, limit-gen.aggression)
+	default:
+		return Flow{}
+	}
+
+	orders := make([]exchange.Transaction, gen.orders)
+	for i := range orders {
+		orders[i] = newOrder(gen.rng, txnType, limit, quantity(gen.rng, gen.size))
+		orders[i].OrderType = exchange.ImmediateOrCancelOrderType
+	}
+	return Flow{Orders: orders}
+}
+
+// marketMaker quotes levels of bids and asks around the last traded price every
+// tick, spread apart at the touch and step apart behind it, after cancelling the
+// quotes of the previous tick
+type marketMaker struct {
+	rng    *rand.Rand
+	spread int
+	levels int
+	step   int
+	size   int
+	quotes []string
+}
+
+func newMarketMaker(params Params, rng *rand.Rand) Generator {
+	return &marketMaker{
+		rng:    rng,
+		spread: int(params["spread"]),
+		levels: int(params["levels"]),
+		step:   int(params["step"]),
+		size:   int(params["size"]),
+	}
+}
+
+func (gen *marketMaker) Generate(market Market) Flow {
+	flow := Flow{Cancels: gen.quotes}
+	bid := int(market.LastTradedPrice) - gen.spread/2
+	ask := bid + gen.spread
+
+	gen.quotes = make([]string, 0, 2*gen.levels)
+	for i := 0; i < gen.levels; i++ {
+		offset := i * gen.step
+		orders := []exchange.Transaction{newOrder(gen.rng, exchange.SellTransactionType, ask+offset, gen.size)}
+		if bid-offset >= 1 {
+			orders = append(orders, newOrder(gen.rng, exchange.BuyTransactionType, bid-offset, gen.size))
+		}
+		for _, order := range orders {
+			gen.quotes = append(gen.quotes, order.ID)
+			flow.Orders = append(flow.Orders, order)
+		}
+	}
+	return flow
+}
+
+// scatter returns orders of a random side priced within spread of reference
+func scatter(rng *rand.Rand, reference, spread float64, orders, size int) []exchange.Transaction {
+	scattered := make([]exchange.Transaction, orders)
+	for i := range scattered {
+		txnType := exchange.BuyTransactionType
+		if rng.Intn(2) == 1 {
+			txnType = exchange.SellTransactionType
+		}
+		scattered[i] = newOrder(rng, txnType, price(rng, reference, spread), quantity(rng, size))
+	}
+	return scattered
+}
+
+// price draws a price uniformly within spread of reference, rounded to a whole
+// price of at least 1
+func price(rng *rand.Rand, reference, spread float64) int {
+	return max(1, int(math.Round(reference+spread*(2*rng.Float64()-1))))
+}
+
+// quantity draws a quantity from 1 to size
+func quantity(rng *rand.Rand, size int) int {
+	return rng.Intn(size) + 1
+}
+
+// newOrder creates a limit order. Its ID is drawn from rng rather than the time,
+// so a seeded generator sends the same IDs on every run.
+func newOrder(rng *rand.Rand, txnType string, price, qty int) exchange.Transaction {
+	order := exchange.NewTransactionWithQuantity(txnType, exchange.TransactionAmtDataType(price), exchange.TransactionQtyDataType(qty))
+	order.ID = fmt.Sprintf("%s-%d", txnType, rng.Int63())
+	return order
+}
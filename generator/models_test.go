@@ -0,0 +1,269 @@
+package generator
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/rohan/stock-simulator/exchange"
+)
+
+func TestUniformPrices(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	testCases := []struct {
+		name        string
+		targetPrice int
+		minExpected int
+		maxExpected int
+		testFunc    func(*rand.Rand, int) int
+	}{
+		{
+			name:        "Buy price generation",
+			targetPrice: 100,
+			minExpected: 1,
+			maxExpected: 100,
+			testFunc:    uniformBuyPrice,
+		},
+		{
+			name:        "Sell price generation",
+			targetPrice: 100,
+			minExpected: 75,
+			maxExpected: 200,
+			testFunc:    uniformSellPrice,
+		},
+		{
+			name:        "Buy price generation with low target",
+			targetPrice: 10,
+			minExpected: 1,
+			maxExpected: 10,
+			testFunc:    uniformBuyPrice,
+		},
+		{
+			name:        "Sell price generation with low target",
+			targetPrice: 10,
+			minExpected: 1,
+			maxExpected: 110,
+			testFunc:    uniformSellPrice,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Run the function multiple times to check range
+			for i := 0; i < 100; i++ {
+				result := tc.testFunc(rng, tc.targetPrice)
+				if result < tc.minExpected || result > tc.maxExpected {
+					t.Errorf("Expected result between %d and %d, got %d",
+						tc.minExpected, tc.maxExpected, result)
+				}
+			}
+		})
+	}
+}
+
+// generate runs a generator for ticks ticks at a fixed last traded price
+func generate(t *testing.T, spec Spec, ltp exchange.TransactionAmtDataType, ticks int) []Flow {
+	gen, err := New(spec, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatalf("Failed to create %s: %v", spec, err)
+	}
+	flows := make([]Flow, ticks)
+	for i := range flows {
+		flows[i] = gen.Generate(Market{Symbol: "AAPL", LastTradedPrice: ltp})
+	}
+	return flows
+}
+
+func TestModelsGenerateValidOrders(t *testing.T) {
+	for _, name := range Models() {
+		t.Run(name, func(t *testing.T) {
+			for _, flow := range generate(t, Spec{Model: name, Params: Params{"size": 3}}, 2, 200) {
+				for _, order := range flow.Orders {
+					if order.Amount < 1 && order.OrderType != exchange.MarketOrderType {
+						t.Fatalf("Expected a price of at least 1, got %+v", order)
+					}
+					if order.Quantity < 1 || order.Quantity > 3 {
+						t.Fatalf("Expected a quantity from 1 to 3, got %+v", order)
+					}
+					if order.ID == "" {
+						t.Fatalf("Expected an order ID, got %+v", order)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestModelsAreReproducible(t *testing.T) {
+	for _, name := range Models() {
+		t.Run(name, func(t *testing.T) {
+			spec := Spec{Model: name}
+			first, second := generate(t, spec, 50, 50), generate(t, spec, 50, 50)
+			for i := range first {
+				if !reflect.DeepEqual(first[i].Cancels, second[i].Cancels) {
+					t.Fatalf("Expected cancels %v at tick %d, got %v", first[i].Cancels, i, second[i].Cancels)
+				}
+				if len(first[i].Orders) != len(second[i].Orders) {
+					t.Fatalf("Expected %d orders at tick %d, got %d", len(first[i].Orders), i, len(second[i].Orders))
+				}
+				for j, order := range first[i].Orders {
+					other := second[i].Orders[j]
+					if order.ID != other.ID || order.Type != other.Type || order.OrderType != other.OrderType || order.Amount != other.Amount || order.Quantity != other.Quantity {
+						t.Fatalf("Expected %+v at tick %d, got %+v", order, i, other)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestUniform(t *testing.T) {
+	flows := generate(t, DefaultSpec, 100, 1)
+	buys := 0
+	for _, order := range flows[0].Orders {
+		if order.Type == exchange.BuyTransactionType {
+			buys++
+		}
+	}
+	if len(flows[0].Orders) != 10 || buys != 5 {
+		t.Errorf("Expected 5 buys and 5 sells, got %d orders with %d buys", len(flows[0].Orders), buys)
+	}
+}
+
+func TestReferenceModels(t *testing.T) {
+	// averagePrice returns the mean limit price of the orders of the last ticks
+	averagePrice := func(flows []Flow) float64 {
+		total, count := 0.0, 0
+		for _, flow := range flows {
+			for _, order := range flow.Orders {
+				total += float64(order.Amount)
+				count++
+			}
+		}
+		return total / float64(count)
+	}
+
+	testCases := []struct {
+		name     string
+		spec     Spec
+		min, max float64
+	}{
+		{
+			name: "Random walk without steps stays put",
+			spec: Spec{Model: "randomwalk", Params: Params{"step": 0}},
+			min:  99.5, max: 100.5,
+		},
+		{
+			name: "Mean reversion pulls towards the mean",
+			spec: Spec{Model: "meanrevert", Params: Params{"mean": 150, "theta": 0.5, "sigma": 0}},
+			min:  149, max: 151,
+		},
+		{
+			name: "Geometric Brownian motion drifts",
+			spec: Spec{Model: "gbm", Params: Params{"mu": 0.01, "sigma": 0}},
+			min:  100 * math.Exp(1.9), max: 100 * math.Exp(2.01),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			flows := generate(t, tc.spec, 100, 200)
+			if average := averagePrice(flows[190:]); average < tc.min || average > tc.max {
+				t.Errorf("Expected an average price between %.1f and %.1f, got %.1f", tc.min, tc.max, average)
+			}
+		})
+	}
+}
+
+func TestPoisson(t *testing.T) {
+	flows := generate(t, Spec{Model: "poisson", Params: Params{"buyRate": 3, "sellRate": 1, "market": 1}}, 100, 1000)
+	buys, sells := 0, 0
+	for _, flow := range flows {
+		for _, order := range flow.Orders {
+			if order.OrderType != exchange.MarketOrderType {
+				t.Fatalf("Expected only market orders, got %+v", order)
+			}
+			if order.Type == exchange.BuyTransactionType {
+				buys++
+			} else {
+				sells++
+			}
+		}
+	}
+	// The number of arrivals per tick averages the rate
+	if buys < 2800 || buys > 3200 || sells < 900 || sells > 1100 {
+		t.Errorf("Expected about 3000 buys and 1000 sells, got %d and %d", buys, sells)
+	}
+}
+
+func TestMomentum(t *testing.T) {
+	gen, _ := New(Spec{Model: "momentum", Params: Params{"lookback": 2, "threshold": 3, "aggression": 1}}, rand.New(rand.NewSource(1)))
+
+	testCases := []struct {
+		ltp           exchange.TransactionAmtDataType
+		expectedType  string
+		expectedLimit exchange.TransactionAmtDataType
+	}{
+		{100, "", 0},
+		{101, "", 0},
+		// Up 2 over two ticks is below the threshold
+		{102, "", 0},
+		{104, exchange.BuyTransactionType, 105},
+		{101, "", 0},
+		{99, exchange.SellTransactionType, 98},
+	}
+
+	for _, tc := range testCases {
+		flow := gen.Generate(Market{LastTradedPrice: tc.ltp})
+		if tc.expectedType == "" {
+			if len(flow.Orders) != 0 {
+				t.Errorf("At %d expected no orders, got %+v", tc.ltp, flow.Orders)
+			}
+			continue
+		}
+		if len(flow.Orders) != 2 {
+			t.Fatalf("At %d expected 2 orders, got %+v", tc.ltp, flow.Orders)
+		}
+		order := flow.Orders[0]
+		if order.Type != tc.expectedType || order.Amount != tc.expectedLimit || order.OrderType != exchange.ImmediateOrCancelOrderType {
+			t.Errorf("At %d expected an IOC %s at %d, got %+v", tc.ltp, tc.expectedType, tc.expectedLimit, order)
+		}
+	}
+}
+
+func TestMarketMaker(t *testing.T) {
+	gen, _ := New(Spec{Model: "marketmaker", Params: Params{"spread": 4, "levels": 2, "step": 3}}, rand.New(rand.NewSource(1)))
+
+	first := gen.Generate(Market{LastTradedPrice: 100})
+	if len(first.Cancels) != 0 {
+		t.Errorf("Expected nothing to cancel at the first tick, got %v", first.Cancels)
+	}
+	prices := make(map[exchange.TransactionAmtDataType]string)
+	for _, order := range first.Orders {
+		prices[order.Amount] = order.Type
+	}
+	expected := map[exchange.TransactionAmtDataType]string{
+		98: exchange.BuyTransactionType, 95: exchange.BuyTransactionType,
+		102: exchange.SellTransactionType, 105: exchange.SellTransactionType,
+	}
+	if len(prices) != len(expected) {
+		t.Fatalf("Expected quotes %v, got %v", expected, prices)
+	}
+	for price, side := range expected {
+		if prices[price] != side {
+			t.Errorf("Expected a %s quote at %d, got %v", side, price, prices)
+		}
+	}
+
+	// The next tick replaces every quote of the first
+	second := gen.Generate(Market{LastTradedPrice: 110})
+	if len(second.Cancels) != len(first.Orders) {
+		t.Fatalf("Expected %d cancels, got %d", len(first.Orders), len(second.Cancels))
+	}
+	for i, order := range first.Orders {
+		if second.Cancels[i] != order.ID {
+			t.Errorf("Expected cancel of %s, got %s", order.ID, second.Cancels[i])
+		}
+	}
+}
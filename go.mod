@@ -2,4 +2,4 @@ module github.com/rohan/stock-simulator
 
 go 1.21.4
 
-require github.com/gorilla/websocket v1.5.3 // indirect
+require github.com/gorilla/websocket v1.5.3
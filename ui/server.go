@@ -2,24 +2,65 @@ package ui
 
 import (
 	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
 	"github.com/rohan/stock-simulator/exchange"
+	"strconv"
+	"strings"
 	"time"
 )
 
 // Server represents the UI server
 type Server struct {
 	wsManager *exchange.WebSocketManager
-	exchange  *exchange.Exchange
-	logger    *exchange.Logger
+	registry  *exchange.InstrumentRegistry
+	// exchange is the default instrument served by the unscoped API routes
+	exchange *exchange.Exchange
+	logger   *exchange.Logger
+	// clock stamps messages and drives the periodic broadcasts
+	clock exchange.Clock
 }
 
-// NewServer creates a new UI server
+// NewServer creates a new UI server for a single instrument
 func NewServer(exch *exchange.Exchange) *Server {
+	logger := exchange.NewLogger("UIServer")
+	logger.SetClock(exch.Clock())
+	registry := exchange.NewInstrumentRegistry()
+	if err := registry.Register(exch); err != nil {
+		logger.Error("Failed to register instrument: " + err.Error())
+	}
+	wsManager := exchange.NewWebSocketManager()
+	wsManager.SetClock(exch.Clock())
+
 	return &Server{
-		wsManager: exchange.NewWebSocketManager(),
+		wsManager: wsManager,
+		registry:  registry,
 		exchange:  exch,
-		logger:    exchange.NewLogger("UIServer"),
+		logger:    logger,
+		clock:     exch.Clock(),
+	}
+}
+
+// NewRegistryServer creates a new UI server for every instrument in the registry.
+// The registry's default instrument is served by the unscoped API routes.
+func NewRegistryServer(registry *exchange.InstrumentRegistry) *Server {
+	clock := registry.Clock()
+	logger := exchange.NewLogger("UIServer")
+	logger.SetClock(clock)
+	wsManager := exchange.NewWebSocketManager()
+	wsManager.SetClock(clock)
+	// Instruments recovered from the journal start with the price history of their trades
+	for _, exch := range registry.Exchanges() {
+		wsManager.RestorePriceHistory(exch.Symbol, exch.GetTrades(0))
+	}
+
+	return &Server{
+		wsManager: wsManager,
+		registry:  registry,
+		exchange:  registry.Default(),
+		logger:    logger,
+		clock:     clock,
 	}
 }
 
@@ -30,32 +71,57 @@ func (s *Server) Start(port string) {
 
 	// WebSocket endpoint
 	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		s.wsManager.HandleWebSocket(w, r, s.exchange)
+		s.wsManager.HandleWebSocket(w, r, s.registry)
 	})
 
 	// API endpoint to get the current price
 	http.HandleFunc("/api/price", func(w http.ResponseWriter, r *http.Request) {
-		price := s.exchange.LastTradedPrice
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"price": price,
-		})
+		s.servePrice(w, r, s.exchange)
 	})
 
 	// API endpoint to get price history
 	http.HandleFunc("/api/history", func(w http.ResponseWriter, r *http.Request) {
-		history := s.wsManager.GetPriceHistory()
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(history)
+		s.serveHistory(w, r, s.exchange)
 	})
 
 	// API endpoint to get the current order book
 	http.HandleFunc("/api/orderbook", func(w http.ResponseWriter, r *http.Request) {
-		orderBook := s.exchange.GetOrderBook()
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(orderBook)
+		s.serveOrderBook(w, r, s.exchange)
+	})
+
+	// API endpoint to get the quantity resting at each price level
+	http.HandleFunc("/api/depth", func(w http.ResponseWriter, r *http.Request) {
+		s.serveDepth(w, r, s.exchange)
 	})
 
+	// API endpoint to get the candles built from the trades
+	http.HandleFunc("/api/candles", func(w http.ResponseWriter, r *http.Request) {
+		s.serveCandles(w, r, s.exchange)
+	})
+
+	// API endpoint to get the most recent trades
+	http.HandleFunc("/api/trades", s.handleTrades)
+
+	// API endpoint to submit (POST) an order
+	http.HandleFunc("/api/orders", s.handleOrders)
+
+	// API endpoint to cancel (DELETE) or amend (PATCH) a resting order
+	http.HandleFunc("/api/orders/", s.handleOrder)
+
+	// API endpoint to get the WebSocket client and slow-consumer counters
+	http.HandleFunc("/api/websocket/stats", s.handleWebSocketStats)
+
+	// API endpoint to list the traded symbols
+	http.HandleFunc("/api/symbols", s.handleSymbols)
+
+	// API endpoints to list (GET) and open (POST) trader accounts and to
+	// read an account's positions and order history
+	http.HandleFunc("/api/accounts", s.handleAccounts)
+	http.HandleFunc("/api/accounts/", s.handleAccount)
+
+	// Symbol scoped versions of the endpoints above, e.g. /api/AAPL/price
+	http.HandleFunc("/api/", s.handleSymbolRoute)
+
 	// Start the server
 	s.logger.Info("Starting UI server on port " + port)
 	go func() {
@@ -69,17 +135,474 @@ func (s *Server) Start(port string) {
 	go s.broadcastOrderBookPeriodically()
 }
 
-// broadcastOrderBookPeriodically broadcasts the order book every second
+// handleWebSocketStats returns the connected client count and the counters of
+// messages that could not be delivered to slow clients
+func (s *Server) handleWebSocketStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.wsManager.Stats())
+}
+
+// WebSocketStats returns the WebSocket client and slow-consumer counters
+func (s *Server) WebSocketStats() map[string]int64 {
+	return s.wsManager.Stats()
+}
+
+// handleSymbols lists the symbols traded on the server and the default one
+func (s *Server) handleSymbols(w http.ResponseWriter, r *http.Request) {
+	defaultSymbol := ""
+	if s.exchange != nil {
+		defaultSymbol = s.exchange.Symbol
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"symbols": s.registry.Symbols(),
+		"default": defaultSymbol,
+	})
+}
+
+// handleSymbolRoute serves /api/{symbol}/price, /api/{symbol}/history,
+// /api/{symbol}/orderbook, /api/{symbol}/depth, /api/{symbol}/candles,
+// /api/{symbol}/trades, /api/{symbol}/orders and /api/{symbol}/orders/{id}
+func (s *Server) handleSymbolRoute(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/api/"), "/", 3)
+	if len(parts) < 2 {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	exch, ok := s.registry.Get(parts[0])
+	if !ok {
+		writeError(w, http.StatusNotFound, exchange.ErrUnknownSymbol.Error()+": "+parts[0])
+		return
+	}
+
+	switch {
+	case len(parts) == 2 && parts[1] == "price":
+		s.servePrice(w, r, exch)
+	case len(parts) == 2 && parts[1] == "history":
+		s.serveHistory(w, r, exch)
+	case len(parts) == 2 && parts[1] == "orderbook":
+		s.serveOrderBook(w, r, exch)
+	case len(parts) == 2 && parts[1] == "depth":
+		s.serveDepth(w, r, exch)
+	case len(parts) == 2 && parts[1] == "candles":
+		s.serveCandles(w, r, exch)
+	case len(parts) == 2 && parts[1] == "trades":
+		s.serveTrades(w, r, exch)
+	case len(parts) == 2 && parts[1] == "orders":
+		s.serveSubmitOrder(w, r, exch)
+	case len(parts) == 3 && parts[1] == "orders":
+		s.serveOrder(w, r, exch, parts[2])
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// servePrice returns the Last Traded Price of an instrument
+func (s *Server) servePrice(w http.ResponseWriter, r *http.Request, exch *exchange.Exchange) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"symbol": exch.Symbol,
+		"price":  exch.LastTradedPrice,
+	})
+}
+
+// serveHistory returns the recent price updates of an instrument
+func (s *Server) serveHistory(w http.ResponseWriter, r *http.Request, exch *exchange.Exchange) {
+	history := s.wsManager.GetSymbolPriceHistory(exch.Symbol)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// serveOrderBook returns the current order book of an instrument
+func (s *Server) serveOrderBook(w http.ResponseWriter, r *http.Request, exch *exchange.Exchange) {
+	orderBook := exch.GetOrderBook()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orderBook)
+}
+
+// serveDepth returns the price levels of an instrument's book, best price first.
+// The optional depth query parameter limits the levels of each side; without it,
+// or with a depth of 0, every level is returned.
+func (s *Server) serveDepth(w http.ResponseWriter, r *http.Request, exch *exchange.Exchange) {
+	depth := 0
+	if value := r.URL.Query().Get("depth"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			writeError(w, http.StatusBadRequest, "depth must be a non-negative integer")
+			return
+		}
+		depth = parsed
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(exch.GetDepth(depth))
+}
+
+// defaultCandleInterval is the interval returned by /api/candles without an interval parameter
+const defaultCandleInterval = exchange.Interval1m
+
+// serveCandles returns the candles of an instrument for one interval, oldest first.
+// The optional from and to query parameters, as RFC 3339 times or Unix seconds,
+// limit the candles to those starting at or after from and before to.
+func (s *Server) serveCandles(w http.ResponseWriter, r *http.Request, exch *exchange.Exchange) {
+	query := r.URL.Query()
+
+	interval := defaultCandleInterval
+	if value := query.Get("interval"); value != "" {
+		parsed, err := exchange.ParseCandleInterval(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		interval = parsed
+	}
+
+	from, err := parseTime(query.Get("from"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid from: "+err.Error())
+		return
+	}
+	to, err := parseTime(query.Get("to"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid to: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(exch.GetCandles(interval, from, to))
+}
+
+// parseTime parses an RFC 3339 time or a number of Unix seconds. An empty value is the zero time.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// defaultTradesLimit is the number of trades returned by /api/trades without a limit parameter
+const defaultTradesLimit = 50
+
+// handleTrades returns the most recent trades of the default instrument
+func (s *Server) handleTrades(w http.ResponseWriter, r *http.Request) {
+	s.serveTrades(w, r, s.exchange)
+}
+
+// serveTrades returns the most recent trades of an instrument, oldest first.
+// The optional limit query parameter sets how many are returned.
+func (s *Server) serveTrades(w http.ResponseWriter, r *http.Request, exch *exchange.Exchange) {
+	limit := defaultTradesLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = parsed
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(exch.GetTrades(limit))
+}
+
+// SubmitOrderRequest is the JSON body accepted when submitting an order. The order
+// type defaults to LIMIT and the price is ignored for MARKET orders.
+type SubmitOrderRequest struct {
+	Side      string `json:"side"`
+	Price     int    `json:"price"`
+	Quantity  int    `json:"quantity"`
+	OrderType string `json:"orderType"`
+	AccountID string `json:"accountId"`
+}
+
+// handleOrders submits an order to the default instrument
+func (s *Server) handleOrders(w http.ResponseWriter, r *http.Request) {
+	s.serveSubmitOrder(w, r, s.exchange)
+}
+
+// serveSubmitOrder validates a submitted order and sends it to an instrument. Accepted
+// orders are answered with 201 Created and rejected ones with 422 Unprocessable
+// Entity, both with the order's report. An order whose trades halted the exchange
+// is answered with 503 Service Unavailable and the report of what was applied.
+func (s *Server) serveSubmitOrder(w http.ResponseWriter, r *http.Request, exch *exchange.Exchange) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var request SubmitOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	txn, err := request.transaction()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := exch.Submit(txn)
+	status := http.StatusCreated
+	if errors.Is(err, exchange.ErrExchangeHalted) {
+		status = http.StatusServiceUnavailable
+	} else if err != nil {
+		status = http.StatusUnprocessableEntity
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// transaction validates the request and converts it to an order
+func (request SubmitOrderRequest) transaction() (exchange.Transaction, error) {
+	side := strings.ToUpper(request.Side)
+	if side != exchange.BuyTransactionType && side != exchange.SellTransactionType {
+		return exchange.Transaction{}, errors.New("side must be BUY or SELL")
+	}
+
+	orderType := strings.ToUpper(request.OrderType)
+	if orderType == "" {
+		orderType = exchange.LimitOrderType
+	}
+	switch orderType {
+	case exchange.LimitOrderType, exchange.MarketOrderType,
+		exchange.ImmediateOrCancelOrderType, exchange.FillOrKillOrderType:
+	default:
+		return exchange.Transaction{}, errors.New("orderType must be LIMIT, MARKET, IOC or FOK")
+	}
+
+	if request.Quantity < 1 || request.Quantity > math.MaxInt32 {
+		return exchange.Transaction{}, errors.New("quantity must be a positive integer")
+	}
+	if request.Price > math.MaxInt32 || (orderType != exchange.MarketOrderType && request.Price < 1) {
+		return exchange.Transaction{}, errors.New("price must be a positive integer")
+	}
+
+	txn := exchange.NewTransactionWithQuantity(side,
+		exchange.TransactionAmtDataType(request.Price), exchange.TransactionQtyDataType(request.Quantity))
+	txn.OrderType = orderType
+	txn.AccountID = request.AccountID
+	return txn, nil
+}
+
+// AmendOrderRequest is the JSON body accepted when amending an order
+type AmendOrderRequest struct {
+	Price    int `json:"price"`
+	Quantity int `json:"quantity"`
+}
+
+// validate checks that the new price and quantity fit in an order
+func (request AmendOrderRequest) validate() error {
+	if request.Quantity < 1 || request.Quantity > math.MaxInt32 {
+		return errors.New("quantity must be a positive integer")
+	}
+	if request.Price < 1 || request.Price > math.MaxInt32 {
+		return errors.New("price must be a positive integer")
+	}
+	return nil
+}
+
+// handleOrder cancels or amends the default instrument's order whose ID follows /api/orders/
+func (s *Server) handleOrder(w http.ResponseWriter, r *http.Request) {
+	s.serveOrder(w, r, s.exchange, strings.TrimPrefix(r.URL.Path, "/api/orders/"))
+}
+
+// serveOrder cancels (DELETE) or amends (PATCH) a resting order of an instrument.
+// Amendments refused by the risk checks are answered with 422 Unprocessable Entity,
+// as rejected orders are.
+func (s *Server) serveOrder(w http.ResponseWriter, r *http.Request, exch *exchange.Exchange, id string) {
+	if id == "" || strings.Contains(id, "/") {
+		writeError(w, http.StatusNotFound, "order id required")
+		return
+	}
+
+	var report exchange.OrderReport
+	var err error
+	switch r.Method {
+	case http.MethodDelete:
+		report, err = exch.CancelOrder(id)
+	case http.MethodPatch:
+		var request AmendOrderRequest
+		if decodeErr := json.NewDecoder(r.Body).Decode(&request); decodeErr != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body: "+decodeErr.Error())
+			return
+		}
+		if invalid := request.validate(); invalid != nil {
+			writeError(w, http.StatusBadRequest, invalid.Error())
+			return
+		}
+		report, err = exch.AmendOrder(id,
+			exchange.TransactionAmtDataType(request.Price), exchange.TransactionQtyDataType(request.Quantity))
+	default:
+		w.Header().Set("Allow", "DELETE, PATCH")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if errors.Is(err, exchange.ErrOrderNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if errors.Is(err, exchange.ErrExchangeHalted) {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	var rejection *exchange.Rejection
+	if errors.As(err, &rejection) {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// OpenAccountRequest is the JSON body accepted when opening an account
+type OpenAccountRequest struct {
+	ID   string `json:"id"`
+	Cash int64  `json:"cash"`
+}
+
+// handleAccounts lists the open accounts (GET) or opens a new one (POST)
+func (s *Server) handleAccounts(w http.ResponseWriter, r *http.Request) {
+	accounts := s.registry.Accounts()
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"accounts": accounts.IDs(),
+		})
+	case http.MethodPost:
+		var request OpenAccountRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+			return
+		}
+		if request.Cash < 0 {
+			writeError(w, http.StatusBadRequest, "cash must not be negative")
+			return
+		}
+
+		err := accounts.Open(request.ID, request.Cash)
+		if errors.Is(err, exchange.ErrDuplicateAccount) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		summary, _ := s.registry.AccountSummary(request.ID)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(summary)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleAccount serves /api/accounts/{id} with the account's cash, positions and
+// profit and loss, and /api/accounts/{id}/orders with its order history
+func (s *Server) handleAccount(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/accounts/"), "/")
+	if parts[0] == "" || len(parts) > 2 || (len(parts) == 2 && parts[1] != "orders") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var result interface{}
+	var err error
+	if len(parts) == 2 {
+		result, err = s.registry.Accounts().Orders(parts[0])
+	} else {
+		result, err = s.registry.AccountSummary(parts[0])
+	}
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// writeError writes a JSON error response with the given status code
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": message,
+	})
+}
+
+// broadcastOrderBookPeriodically broadcasts the order book of every instrument with
+// subscribers every second, skipping books that have not changed since the last
+// broadcast. New subscribers receive the book when they subscribe.
 func (s *Server) broadcastOrderBookPeriodically() {
-	ticker := time.NewTicker(1 * time.Second)
+	sent := make(map[string]uint64)
+	ticker := s.clock.NewTicker(1 * time.Second)
 	for {
-		<-ticker.C
-		orderBook := s.exchange.GetOrderBook()
-		s.wsManager.BroadcastOrderBook(orderBook)
+		<-ticker.C()
+		for _, exch := range s.registry.Exchanges() {
+			if !s.wsManager.HasSubscribers(exchange.BookChannel, exch.Symbol) {
+				continue
+			}
+			sequence := exch.BookSequence()
+			if last, ok := sent[exch.Symbol]; ok && last == sequence {
+				continue
+			}
+			sent[exch.Symbol] = sequence
+			orderBook := exch.GetOrderBook()
+			s.wsManager.BroadcastOrderBook(orderBook)
+		}
 	}
 }
 
-// BroadcastPriceUpdate broadcasts a price update to all connected clients
+// BroadcastPriceUpdate broadcasts a price update of the default instrument to its subscribers
 func (s *Server) BroadcastPriceUpdate(price int) {
-	s.wsManager.BroadcastPriceUpdate(price)
+	s.wsManager.BroadcastSymbolPriceUpdate(s.exchange.Symbol, price)
+}
+
+// BroadcastSymbolPriceUpdate broadcasts a price update to the subscribers of a symbol
+func (s *Server) BroadcastSymbolPriceUpdate(symbol string, price int) {
+	s.wsManager.BroadcastSymbolPriceUpdate(symbol, price)
+}
+
+// BroadcastTrade broadcasts an executed trade to the subscribers of its symbol
+func (s *Server) BroadcastTrade(trade exchange.Trade) {
+	s.wsManager.BroadcastTrade(trade)
+}
+
+// BroadcastBookUpdate sends the price levels changed on a book to the subscribers of its levels
+func (s *Server) BroadcastBookUpdate(update exchange.BookUpdate) {
+	s.wsManager.BroadcastBookUpdate(update)
+}
+
+// BroadcastCandle sends an updated candle to the subscribers of its symbol's candles
+func (s *Server) BroadcastCandle(candle exchange.Candle) {
+	s.wsManager.BroadcastCandle(candle)
+}
+
+// BroadcastOrderReport sends an order report to the subscribers of its account's orders
+func (s *Server) BroadcastOrderReport(report exchange.OrderReport) {
+	s.wsManager.BroadcastOrderReport(report)
 }
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -31,6 +33,25 @@ func TestNewServer(t *testing.T) {
 	}
 }
 
+func TestNewServerKeepsAccounts(t *testing.T) {
+	exch := exchange.NewExchange(100)
+	accounts := exchange.NewAccountManager()
+	accounts.Open("alice", 1000)
+	exch.SetAccounts(accounts)
+
+	server := NewServer(&exch)
+	if exch.Accounts() != accounts {
+		t.Fatalf("Expected the exchange to keep its accounts")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/accounts/alice", nil)
+	rr := httptest.NewRecorder()
+	server.handleAccount(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected alice to be served, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
 func TestAPIEndpoints(t *testing.T) {
 	// Create a test exchange
 	exch := exchange.NewExchange(100)
@@ -196,15 +217,426 @@ func TestBroadcastOrderBookPeriodically(t *testing.T) {
 	// This test is more of a smoke test to ensure the function doesn't panic
 	// Create a test exchange
 	exch := exchange.NewExchange(100)
+	clock := exchange.NewSimulatedClock(time.Date(2025, 4, 27, 15, 0, 0, 0, time.UTC))
+	exch.SetClock(clock)
 
 	// Create a new server
 	server := NewServer(&exch)
 
-	// Start the broadcast goroutine
+	// Start the broadcast goroutine and let a second pass for at least one broadcast
 	go server.broadcastOrderBookPeriodically()
-
-	// Wait a short time to allow at least one broadcast
-	time.Sleep(100 * time.Millisecond)
+	clock.WaitForTickers(1)
+	clock.Advance(time.Second)
 
 	// No assertions needed - we're just checking that it doesn't panic
 }
+
+func TestOrderEndpoint(t *testing.T) {
+	exch := exchange.NewExchange(100)
+	exch.AddRiskCheck(exchange.MaxOrderSizeCheck(50))
+	server := NewServer(&exch)
+
+	// Rest an order through the exchange so it is indexed
+	go exch.AcceptTrades()
+	order := exchange.NewTransactionWithQuantity(exchange.BuyTransactionType, 90, 10)
+	exch.IncomingTrades <- order
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := exch.GetOrder(order.ID); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Order was not accepted within timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	testCases := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+		orderStatus    exchange.OrderStatus
+	}{
+		{"Amend", http.MethodPatch, "/api/orders/" + order.ID, `{"price": 92, "quantity": 8}`, http.StatusOK, exchange.OrderStatusNew},
+		{"Amend With Bad Body", http.MethodPatch, "/api/orders/" + order.ID, `{`, http.StatusBadRequest, ""},
+		{"Amend With Bad Price", http.MethodPatch, "/api/orders/" + order.ID, `{"price": 0, "quantity": 8}`, http.StatusBadRequest, ""},
+		{"Amend With Oversized Price", http.MethodPatch, "/api/orders/" + order.ID, `{"price": 4294967388, "quantity": 8}`, http.StatusBadRequest, ""},
+		{"Amend With Oversized Quantity", http.MethodPatch, "/api/orders/" + order.ID, `{"price": 92, "quantity": 4294967304}`, http.StatusBadRequest, ""},
+		{"Amend Rejected By Risk Check", http.MethodPatch, "/api/orders/" + order.ID, `{"price": 92, "quantity": 80}`, http.StatusUnprocessableEntity, ""},
+		{"Unsupported Method", http.MethodPost, "/api/orders/" + order.ID, "", http.StatusMethodNotAllowed, ""},
+		{"Cancel", http.MethodDelete, "/api/orders/" + order.ID, "", http.StatusOK, exchange.OrderStatusCancelled},
+		{"Cancel Unknown Order", http.MethodDelete, "/api/orders/" + order.ID, "", http.StatusNotFound, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			rr := httptest.NewRecorder()
+			server.handleOrder(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tc.orderStatus == "" {
+				return
+			}
+
+			var report exchange.OrderReport
+			if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if report.Status != tc.orderStatus {
+				t.Errorf("Expected order status %s, got %s", tc.orderStatus, report.Status)
+			}
+		})
+	}
+}
+
+func TestTradesEndpoint(t *testing.T) {
+	exch := exchange.NewExchange(100)
+	server := NewServer(&exch)
+
+	go exch.AcceptTrades()
+	for i := 0; i < 3; i++ {
+		exch.IncomingTrades <- exchange.NewTransaction(exchange.SellTransactionType, 100)
+		exch.IncomingTrades <- exchange.NewTransaction(exchange.BuyTransactionType, 100)
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(exch.GetTrades(0)) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Trades were not executed within timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	testCases := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedTrades int
+	}{
+		{"Default Limit", "", http.StatusOK, 3},
+		{"With Limit", "?limit=2", http.StatusOK, 2},
+		{"Invalid Limit", "?limit=abc", http.StatusBadRequest, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			server.handleTrades(rr, httptest.NewRequest(http.MethodGet, "/api/trades"+tc.query, nil))
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d", tc.expectedStatus, rr.Code)
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var trades []exchange.Trade
+			if err := json.Unmarshal(rr.Body.Bytes(), &trades); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if len(trades) != tc.expectedTrades {
+				t.Errorf("Expected %d trades, got %d", tc.expectedTrades, len(trades))
+			}
+		})
+	}
+}
+
+func TestSymbolRoutes(t *testing.T) {
+	registry := exchange.NewInstrumentRegistry()
+	aapl, _ := registry.Add("AAPL", 150)
+	msft, _ := registry.Add("MSFT", 300)
+	aapl.BuyQ.Insert(exchange.NewTransaction(exchange.BuyTransactionType, 149))
+	msft.SellQ.Insert(exchange.NewTransaction(exchange.SellTransactionType, 301))
+
+	server := NewRegistryServer(registry)
+
+	testCases := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		validate       func(t *testing.T, body []byte)
+	}{
+		{
+			name:           "Symbol Price",
+			path:           "/api/msft/price",
+			expectedStatus: http.StatusOK,
+			validate: func(t *testing.T, body []byte) {
+				var response map[string]interface{}
+				json.Unmarshal(body, &response)
+				if response["symbol"] != "MSFT" || response["price"] != float64(300) {
+					t.Errorf("Expected MSFT price 300, got %v", response)
+				}
+			},
+		},
+		{
+			name:           "Symbol Order Book",
+			path:           "/api/AAPL/orderbook",
+			expectedStatus: http.StatusOK,
+			validate: func(t *testing.T, body []byte) {
+				var orderBook exchange.OrderBook
+				json.Unmarshal(body, &orderBook)
+				if orderBook.Symbol != "AAPL" || len(orderBook.BuyOrders) != 1 || len(orderBook.SellOrders) != 0 {
+					t.Errorf("Expected the AAPL book with one buy order, got %+v", orderBook)
+				}
+			},
+		},
+		{
+			name:           "Symbol Depth",
+			path:           "/api/AAPL/depth?depth=5",
+			expectedStatus: http.StatusOK,
+			validate: func(t *testing.T, body []byte) {
+				var depth exchange.Depth
+				json.Unmarshal(body, &depth)
+				if depth.Symbol != "AAPL" || len(depth.Bids) != 1 || depth.Bids[0].Price != 149 || len(depth.Asks) != 0 {
+					t.Errorf("Expected the AAPL depth with one bid level at 149, got %+v", depth)
+				}
+			},
+		},
+		{"Negative Depth", "/api/AAPL/depth?depth=-1", http.StatusBadRequest, nil},
+		{
+			name:           "Symbol Candles",
+			path:           "/api/AAPL/candles?interval=5s&from=0&to=2030-01-01T00:00:00Z",
+			expectedStatus: http.StatusOK,
+			validate: func(t *testing.T, body []byte) {
+				var candles []exchange.Candle
+				if err := json.Unmarshal(body, &candles); err != nil || len(candles) != 0 {
+					t.Errorf("Expected no candles, got %s", body)
+				}
+			},
+		},
+		{"Unknown Candle Interval", "/api/AAPL/candles?interval=2m", http.StatusBadRequest, nil},
+		{"Invalid Candle Range", "/api/AAPL/candles?from=yesterday", http.StatusBadRequest, nil},
+		{
+			name:           "Symbol Trades",
+			path:           "/api/AAPL/trades",
+			expectedStatus: http.StatusOK,
+			validate: func(t *testing.T, body []byte) {
+				var trades []exchange.Trade
+				if err := json.Unmarshal(body, &trades); err != nil {
+					t.Errorf("Failed to parse response: %v", err)
+				}
+			},
+		},
+		{"Unknown Symbol", "/api/GOOG/price", http.StatusNotFound, nil},
+		{"Unknown Resource", "/api/AAPL/unknown", http.StatusNotFound, nil},
+		{"Missing Order ID", "/api/AAPL/orders/", http.StatusNotFound, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			server.handleSymbolRoute(rr, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d", tc.expectedStatus, rr.Code)
+			}
+			if tc.validate != nil {
+				tc.validate(t, rr.Body.Bytes())
+			}
+		})
+	}
+
+	// The symbols endpoint lists every instrument with the first one as default
+	rr := httptest.NewRecorder()
+	server.handleSymbols(rr, httptest.NewRequest(http.MethodGet, "/api/symbols", nil))
+	var response struct {
+		Symbols []string `json:"symbols"`
+		Default string   `json:"default"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	if len(response.Symbols) != 2 || response.Default != "AAPL" {
+		t.Errorf("Expected 2 symbols with AAPL as default, got %+v", response)
+	}
+}
+
+func TestAccountEndpoints(t *testing.T) {
+	registry := exchange.NewInstrumentRegistry()
+	registry.Add("SIM", 100)
+	server := NewRegistryServer(registry)
+
+	// Open an account
+	rr := httptest.NewRecorder()
+	server.handleAccounts(rr, httptest.NewRequest(http.MethodPost, "/api/accounts",
+		strings.NewReader(`{"id": "alice", "cash": 1000}`)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d", http.StatusCreated, rr.Code)
+	}
+
+	// Opening it again conflicts
+	rr = httptest.NewRecorder()
+	server.handleAccounts(rr, httptest.NewRequest(http.MethodPost, "/api/accounts",
+		strings.NewReader(`{"id": "alice", "cash": 1000}`)))
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d", http.StatusConflict, rr.Code)
+	}
+
+	testCases := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		validate       func(t *testing.T, body []byte)
+	}{
+		{
+			name:           "Account List",
+			path:           "/api/accounts",
+			expectedStatus: http.StatusOK,
+			validate: func(t *testing.T, body []byte) {
+				var response struct {
+					Accounts []string `json:"accounts"`
+				}
+				json.Unmarshal(body, &response)
+				if len(response.Accounts) != 1 || response.Accounts[0] != "alice" {
+					t.Errorf("Expected the alice account, got %+v", response)
+				}
+			},
+		},
+		{
+			name:           "Account Summary",
+			path:           "/api/accounts/alice",
+			expectedStatus: http.StatusOK,
+			validate: func(t *testing.T, body []byte) {
+				var summary exchange.AccountSummary
+				json.Unmarshal(body, &summary)
+				if summary.ID != "alice" || summary.Cash != 1000 || summary.Equity != 1000 {
+					t.Errorf("Expected alice with cash 1000, got %+v", summary)
+				}
+			},
+		},
+		{
+			name:           "Order History",
+			path:           "/api/accounts/alice/orders",
+			expectedStatus: http.StatusOK,
+			validate: func(t *testing.T, body []byte) {
+				var orders []exchange.OrderReport
+				if err := json.Unmarshal(body, &orders); err != nil || len(orders) != 0 {
+					t.Errorf("Expected an empty order history, got %s", body)
+				}
+			},
+		},
+		{"Unknown Account", "/api/accounts/bob", http.StatusNotFound, nil},
+		{"Unknown Resource", "/api/accounts/alice/unknown", http.StatusNotFound, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.path == "/api/accounts" {
+				server.handleAccounts(rr, request)
+			} else {
+				server.handleAccount(rr, request)
+			}
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d", tc.expectedStatus, rr.Code)
+			}
+			if tc.validate != nil {
+				tc.validate(t, rr.Body.Bytes())
+			}
+		})
+	}
+}
+
+func TestSubmitOrderEndpoint(t *testing.T) {
+	registry := exchange.NewInstrumentRegistry()
+	aapl, _ := registry.Add("AAPL", 150)
+	registry.AddRiskCheck(exchange.MaxOrderSizeCheck(100))
+	server := NewRegistryServer(registry)
+
+	testCases := []struct {
+		name           string
+		method         string
+		body           string
+		expectedStatus int
+		orderStatus    exchange.OrderStatus
+	}{
+		{"Limit Order", http.MethodPost, `{"side": "sell", "price": 151, "quantity": 10}`, http.StatusCreated, exchange.OrderStatusNew},
+		{"Marketable Order", http.MethodPost, `{"side": "BUY", "price": 151, "quantity": 4, "orderType": "ioc"}`, http.StatusCreated, exchange.OrderStatusFilled},
+		{"Market Order Without Price", http.MethodPost, `{"side": "BUY", "quantity": 2, "orderType": "MARKET"}`, http.StatusCreated, exchange.OrderStatusFilled},
+		{"Risk Rejection", http.MethodPost, `{"side": "BUY", "price": 150, "quantity": 101}`, http.StatusUnprocessableEntity, exchange.OrderStatusRejected},
+		{"Unknown Account", http.MethodPost, `{"side": "BUY", "price": 150, "quantity": 1, "accountId": "bob"}`, http.StatusUnprocessableEntity, exchange.OrderStatusRejected},
+		{"Bad Body", http.MethodPost, `{`, http.StatusBadRequest, ""},
+		{"Bad Side", http.MethodPost, `{"side": "HOLD", "price": 150, "quantity": 1}`, http.StatusBadRequest, ""},
+		{"Bad Order Type", http.MethodPost, `{"side": "BUY", "price": 150, "quantity": 1, "orderType": "STOP"}`, http.StatusBadRequest, ""},
+		{"Bad Price", http.MethodPost, `{"side": "BUY", "price": 0, "quantity": 1}`, http.StatusBadRequest, ""},
+		{"Bad Quantity", http.MethodPost, `{"side": "BUY", "price": 150, "quantity": 0}`, http.StatusBadRequest, ""},
+		{"Unsupported Method", http.MethodGet, "", http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/api/orders", strings.NewReader(tc.body))
+			rr := httptest.NewRecorder()
+			server.handleOrders(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tc.orderStatus == "" {
+				return
+			}
+
+			var report exchange.OrderReport
+			if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if report.OrderID == "" || report.Status != tc.orderStatus {
+				t.Errorf("Expected an order ID with status %s, got %+v", tc.orderStatus, report)
+			}
+		})
+	}
+
+	if sell, ok := aapl.SellQ.Min(); !ok || sell.Remaining() != 4 {
+		t.Errorf("Expected 4 units left on the resting sell order, got %+v", sell)
+	}
+
+	// Orders can also be submitted to a symbol and then cancelled
+	rr := httptest.NewRecorder()
+	server.handleSymbolRoute(rr, httptest.NewRequest(http.MethodPost, "/api/AAPL/orders",
+		strings.NewReader(`{"side": "BUY", "price": 140, "quantity": 1}`)))
+	var report exchange.OrderReport
+	json.Unmarshal(rr.Body.Bytes(), &report)
+	if rr.Code != http.StatusCreated || report.Symbol != "AAPL" {
+		t.Fatalf("Expected an AAPL order to be created, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	server.handleOrder(rr, httptest.NewRequest(http.MethodDelete, "/api/orders/"+report.OrderID, nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected the order to be cancelled, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestSubmitOrderEndpointWhenHalted(t *testing.T) {
+	journal, err := exchange.OpenJournal(filepath.Join(t.TempDir(), "journal.log"), exchange.JournalOptions{Sync: exchange.SyncNever})
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+	defer journal.Close()
+
+	// Trades stamped after the year 9999 cannot be journaled, so the first one halts the exchange
+	exch := exchange.NewExchange(100)
+	exch.SetClock(exchange.NewSimulatedClock(time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC)))
+	exch.SetJournal(journal)
+	server := NewServer(&exch)
+
+	orders := []struct {
+		body           string
+		expectedStatus int
+	}{
+		{`{"side": "SELL", "price": 100, "quantity": 5}`, http.StatusCreated},
+		{`{"side": "BUY", "price": 100, "quantity": 2}`, http.StatusServiceUnavailable},
+		{`{"side": "BUY", "price": 100, "quantity": 1}`, http.StatusServiceUnavailable},
+	}
+	for _, order := range orders {
+		rr := httptest.NewRecorder()
+		server.handleOrders(rr, httptest.NewRequest(http.MethodPost, "/api/orders", strings.NewReader(order.body)))
+		if rr.Code != order.expectedStatus {
+			t.Errorf("Expected status code %d for %s, got %d: %s", order.expectedStatus, order.body, rr.Code, rr.Body.String())
+		}
+	}
+}